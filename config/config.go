@@ -0,0 +1,510 @@
+// Package config loads the conventions of the webserver, its renderer and the
+// logger from YAML, JSON or TOML files and GIA_* environment variables so
+// services can be reconfigured without a recompile.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+	"github.com/go-gia/go-infrastructure/webserver/render"
+)
+
+type (
+	// Config is the document layout of a configuration file. Every section is
+	// optional; omitted values keep the package defaults.
+	Config struct {
+		Webserver Webserver `json:"webserver"`
+		Render    Render    `json:"render"`
+		Logger    Logger    `json:"logger"`
+	}
+
+	// Webserver mirrors webserver.Conventions.
+	Webserver struct {
+		EnableStaticFileServer bool              `json:"enableStaticFileServer"`
+		StaticFilePath         string            `json:"staticFilePath"`
+		StaticFiles            map[string]string `json:"staticFiles"`
+		SystemTemplates        map[string]string `json:"systemTemplates"`
+		RequestDurationWarning Duration          `json:"requestDurationWarning"`
+		TrustedProxies         []string          `json:"trustedProxies"`
+		ForwardedHeader        string            `json:"forwardedHeader"`
+		CSRF                   CSRF              `json:"csrf"`
+		SecurityHeaders        SecurityHeaders   `json:"securityHeaders"`
+		Health                 Health            `json:"health"`
+		Metrics                Metrics           `json:"metrics"`
+		Cookies                Cookies           `json:"cookies"`
+		LogLevels              LogLevels         `json:"logLevels"`
+		AccessLog              AccessLog         `json:"accessLog"`
+	}
+
+	// CSRF mirrors webserver.CSRFConventions.
+	CSRF struct {
+		CookieName string `json:"cookieName"`
+		FieldName  string `json:"fieldName"`
+		HeaderName string `json:"headerName"`
+	}
+
+	// SecurityHeaders mirrors webserver.SecurityHeadersConventions.
+	SecurityHeaders struct {
+		HSTSMaxAge            Duration `json:"hstsMaxAge"`
+		HSTSIncludeSubdomains bool     `json:"hstsIncludeSubdomains"`
+		HSTSPreload           bool     `json:"hstsPreload"`
+		ContentTypeNosniff    bool     `json:"contentTypeNosniff"`
+		FrameOptions          string   `json:"frameOptions"`
+		ReferrerPolicy        string   `json:"referrerPolicy"`
+		PermissionsPolicy     string   `json:"permissionsPolicy"`
+		ContentSecurityPolicy string   `json:"contentSecurityPolicy"`
+		CSPReportOnly         bool     `json:"cspReportOnly"`
+		CSPReportPath         string   `json:"cspReportPath"`
+	}
+
+	// Health mirrors webserver.HealthConventions.
+	Health struct {
+		HealthPath    string   `json:"healthPath"`
+		ReadinessPath string   `json:"readinessPath"`
+		LivenessPath  string   `json:"livenessPath"`
+		CheckTimeout  Duration `json:"checkTimeout"`
+		ShutdownDelay Duration `json:"shutdownDelay"`
+	}
+
+	// Metrics mirrors webserver.MetricsConventions.
+	Metrics struct {
+		Path      string `json:"path"`
+		Namespace string `json:"namespace"`
+	}
+
+	// LogLevels mirrors webserver.LogLevelConventions.
+	LogLevels struct {
+		Path string `json:"path"`
+	}
+
+	// AccessLog mirrors webserver.AccessLogConventions.
+	AccessLog struct {
+		Headers           bool     `json:"headers"`
+		RedactHeaders     []string `json:"redactHeaders"`
+		RedactQueryParams []string `json:"redactQueryParams"`
+	}
+
+	// Cookies mirrors context.CookieConventions. Keys are secrets and are best
+	// supplied through GIA_WEBSERVER_COOKIES_KEYS rather than a file.
+	Cookies struct {
+		Path     string   `json:"path"`
+		Domain   string   `json:"domain"`
+		MaxAge   int      `json:"maxAge"`
+		Secure   bool     `json:"secure"`
+		HTTPOnly bool     `json:"httpOnly"`
+		SameSite string   `json:"sameSite"`
+		Keys     []string `json:"keys"`
+	}
+
+	// Render mirrors render.Conventions.
+	Render struct {
+		TemplateDirectory  string `json:"templateDirectory"`
+		LogDebugMessages   bool   `json:"logDebugMessages"`
+		LogErrorMessages   bool   `json:"logErrorMessages"`
+		LogTemplateResults bool   `json:"logTemplateResults"`
+		CacheTemplates     bool   `json:"cacheTemplates"`
+		DelimPrefix        string `json:"delimPrefix"`
+		DelimSuffix        string `json:"delimSuffix"`
+		// Layout is the view views are rendered into, Layouts the layouts
+		// of views by name prefix.
+		Layout            string            `json:"layout"`
+		Layouts           map[string]string `json:"layouts"`
+		PartialsDirectory string            `json:"partialsDirectory"`
+	}
+
+	// Logger describes logger.Settings. Output selects the output type and the
+	// remaining fields apply to the types that support them.
+	Logger struct {
+		// Output is one of stdout, stderr, disk, loggly, syslog, journald or
+		// discard.
+		Output string   `json:"output"`
+		Level  string   `json:"level"`
+		Format string   `json:"format"`
+		Path   string   `json:"path"`
+		Token  string   `json:"token"`
+		Domain string   `json:"domain"`
+		Tags   []string `json:"tags"`
+		Trace  bool     `json:"trace"`
+		// TraceModules enables or disables tracing for named loggers. It is
+		// only read from files, not from the environment.
+		TraceModules map[string]bool `json:"traceModules"`
+		// Format is one of text, logfmt, json, ecs, gelf or template, which
+		// executes Template. TimeFormat and TimeZone apply to every output.
+		Template   string `json:"template"`
+		TimeFormat string `json:"timeFormat"`
+		TimeZone   string `json:"timeZone"`
+		// Network, Address and Facility configure the syslog output. Address
+		// is also the path of the journald socket and AppName identifies the
+		// application to both.
+		Network  string `json:"network"`
+		Address  string `json:"address"`
+		Facility string `json:"facility"`
+		AppName  string `json:"appName"`
+		// MaxSize, RotateEvery, MaxBackups, MaxAge, Compress and
+		// ReopenOnSIGHUP configure rotation of the disk output.
+		MaxSize        int64    `json:"maxSize"`
+		RotateEvery    Duration `json:"rotateEvery"`
+		MaxBackups     int      `json:"maxBackups"`
+		MaxAge         Duration `json:"maxAge"`
+		Compress       bool     `json:"compress"`
+		ReopenOnSIGHUP bool     `json:"reopenOnSighup"`
+		Async          Async    `json:"async"`
+		Sampling       Sampling `json:"sampling"`
+		// StackTraceLevel attaches stack traces to errors logged at this
+		// level and above.
+		StackTraceLevel string `json:"stackTraceLevel"`
+		// ShutdownTimeout bounds the shutdown hooks run before a fatal
+		// message exits the process.
+		ShutdownTimeout Duration `json:"shutdownTimeout"`
+		// Modules overrides the level of named loggers, for example
+		// webserver.render: debug.
+		Modules   map[string]string `json:"modules"`
+		Redaction Redaction         `json:"redaction"`
+	}
+
+	// Async mirrors logger.AsyncSettings.
+	Async struct {
+		BufferSize int    `json:"bufferSize"`
+		Writers    int    `json:"writers"`
+		Policy     string `json:"policy"`
+		SampleRate int    `json:"sampleRate"`
+	}
+
+	// Sampling mirrors logger.SamplingSettings. Levels and modules are only
+	// read from files, not from the environment.
+	Sampling struct {
+		Levels        map[string]SamplingRule            `json:"levels"`
+		Modules       map[string]map[string]SamplingRule `json:"modules"`
+		DedupInterval Duration                           `json:"dedupInterval"`
+	}
+
+	// SamplingRule mirrors logger.Sampling.
+	SamplingRule struct {
+		Interval   Duration `json:"interval"`
+		First      int      `json:"first"`
+		Thereafter int      `json:"thereafter"`
+	}
+
+	// Redaction mirrors logger.RedactionSettings.
+	Redaction struct {
+		Fields      []string `json:"fields"`
+		Patterns    []string `json:"patterns"`
+		Replacement string   `json:"replacement"`
+	}
+
+	// Duration is a time.Duration read from strings such as "250ms" or "5s".
+	// Plain numbers are read as seconds.
+	Duration time.Duration
+)
+
+// Logger output types.
+const (
+	OutputStdout   = "stdout"
+	OutputStderr   = "stderr"
+	OutputDisk     = "disk"
+	OutputLoggly   = "loggly"
+	OutputSyslog   = "syslog"
+	OutputJournald = "journald"
+	OutputDiscard  = "discard"
+)
+
+// sameSiteModes maps configuration values to http.SameSite modes.
+var sameSiteModes = map[string]http.SameSite{
+	"":        http.SameSiteDefaultMode,
+	"default": http.SameSiteDefaultMode,
+	"lax":     http.SameSiteLaxMode,
+	"strict":  http.SameSiteStrictMode,
+	"none":    http.SameSiteNoneMode,
+}
+
+// Defaults returns a Config populated from the current package level
+// webserver.Settings and render.Settings, logging text to stdout at info.
+func Defaults() *Config {
+	ws := webserver.Settings
+	r := render.Settings
+	if ws.Render != nil {
+		r = *ws.Render
+	}
+
+	c := &Config{
+		Webserver: Webserver{
+			EnableStaticFileServer: ws.EnableStaticFileServer,
+			StaticFilePath:         ws.StaticFilePath,
+			StaticFiles:            map[string]string{},
+			SystemTemplates:        map[string]string{},
+			RequestDurationWarning: Duration(ws.RequestDurationWarning),
+			TrustedProxies:         append([]string{}, ws.TrustedProxies...),
+			ForwardedHeader:        ws.ForwardedHeader,
+			CSRF:                   CSRF(ws.CSRF),
+			SecurityHeaders: SecurityHeaders{
+				HSTSMaxAge:            Duration(ws.SecurityHeaders.HSTSMaxAge),
+				HSTSIncludeSubdomains: ws.SecurityHeaders.HSTSIncludeSubdomains,
+				HSTSPreload:           ws.SecurityHeaders.HSTSPreload,
+				ContentTypeNosniff:    ws.SecurityHeaders.ContentTypeNosniff,
+				FrameOptions:          ws.SecurityHeaders.FrameOptions,
+				ReferrerPolicy:        ws.SecurityHeaders.ReferrerPolicy,
+				PermissionsPolicy:     ws.SecurityHeaders.PermissionsPolicy,
+				ContentSecurityPolicy: ws.SecurityHeaders.ContentSecurityPolicy,
+				CSPReportOnly:         ws.SecurityHeaders.CSPReportOnly,
+				CSPReportPath:         ws.SecurityHeaders.CSPReportPath,
+			},
+			Health: Health{
+				HealthPath:    ws.Health.HealthPath,
+				ReadinessPath: ws.Health.ReadinessPath,
+				LivenessPath:  ws.Health.LivenessPath,
+				CheckTimeout:  Duration(ws.Health.CheckTimeout),
+				ShutdownDelay: Duration(ws.Health.ShutdownDelay),
+			},
+			Metrics: Metrics{
+				Path:      ws.Metrics.Path,
+				Namespace: ws.Metrics.Namespace,
+			},
+			Cookies: Cookies{
+				Path:     ws.Cookies.Path,
+				Domain:   ws.Cookies.Domain,
+				MaxAge:   ws.Cookies.MaxAge,
+				Secure:   ws.Cookies.Secure,
+				HTTPOnly: ws.Cookies.HTTPOnly,
+				SameSite: sameSiteName(ws.Cookies.SameSite),
+			},
+			LogLevels: LogLevels(ws.LogLevels),
+			AccessLog: AccessLog{
+				Headers:           ws.AccessLog.Headers,
+				RedactHeaders:     append([]string{}, ws.AccessLog.RedactHeaders...),
+				RedactQueryParams: append([]string{}, ws.AccessLog.RedactQueryParams...),
+			},
+		},
+		Render: Render(r),
+		Logger: Logger{
+			Output:  OutputStdout,
+			Level:   "info",
+			Format:  "text",
+			Modules: map[string]string{},
+		},
+	}
+
+	for k, v := range ws.SystemTemplates {
+		c.Webserver.SystemTemplates[k] = v
+	}
+
+	return c
+}
+
+// WebserverConventions returns webserver.Conventions built from the
+// configuration. Static files are not part of the conventions; use
+// ServerOptions to register them.
+func (c *Config) WebserverConventions() webserver.Conventions {
+	conventions := webserver.Settings
+	r := c.RenderConventions()
+
+	w := c.Webserver
+	conventions.Render = &r
+	conventions.EnableStaticFileServer = w.EnableStaticFileServer
+	conventions.StaticFilePath = w.StaticFilePath
+	conventions.SystemTemplates = map[string]string{}
+	for k, v := range w.SystemTemplates {
+		conventions.SystemTemplates[k] = v
+	}
+	conventions.RequestDurationWarning = time.Duration(w.RequestDurationWarning)
+	conventions.TrustedProxies = append([]string{}, w.TrustedProxies...)
+	conventions.ForwardedHeader = w.ForwardedHeader
+	conventions.CSRF = webserver.CSRFConventions(w.CSRF)
+	conventions.SecurityHeaders = webserver.SecurityHeadersConventions{
+		HSTSMaxAge:            time.Duration(w.SecurityHeaders.HSTSMaxAge),
+		HSTSIncludeSubdomains: w.SecurityHeaders.HSTSIncludeSubdomains,
+		HSTSPreload:           w.SecurityHeaders.HSTSPreload,
+		ContentTypeNosniff:    w.SecurityHeaders.ContentTypeNosniff,
+		FrameOptions:          w.SecurityHeaders.FrameOptions,
+		ReferrerPolicy:        w.SecurityHeaders.ReferrerPolicy,
+		PermissionsPolicy:     w.SecurityHeaders.PermissionsPolicy,
+		ContentSecurityPolicy: w.SecurityHeaders.ContentSecurityPolicy,
+		CSPReportOnly:         w.SecurityHeaders.CSPReportOnly,
+		CSPReportPath:         w.SecurityHeaders.CSPReportPath,
+	}
+	conventions.Health = webserver.HealthConventions{
+		HealthPath:    w.Health.HealthPath,
+		ReadinessPath: w.Health.ReadinessPath,
+		LivenessPath:  w.Health.LivenessPath,
+		CheckTimeout:  time.Duration(w.Health.CheckTimeout),
+		ShutdownDelay: time.Duration(w.Health.ShutdownDelay),
+	}
+	conventions.Metrics.Path = w.Metrics.Path
+	conventions.Metrics.Namespace = w.Metrics.Namespace
+	conventions.LogLevels = webserver.LogLevelConventions(w.LogLevels)
+	conventions.AccessLog = webserver.AccessLogConventions{
+		Headers:           w.AccessLog.Headers,
+		RedactHeaders:     append([]string{}, w.AccessLog.RedactHeaders...),
+		RedactQueryParams: append([]string{}, w.AccessLog.RedactQueryParams...),
+	}
+
+	keys := make([][]byte, len(w.Cookies.Keys))
+	for i, key := range w.Cookies.Keys {
+		keys[i] = []byte(key)
+	}
+	conventions.Cookies = context.CookieConventions{
+		Path:     w.Cookies.Path,
+		Domain:   w.Cookies.Domain,
+		MaxAge:   w.Cookies.MaxAge,
+		Secure:   w.Cookies.Secure,
+		HTTPOnly: w.Cookies.HTTPOnly,
+		SameSite: sameSiteModes[strings.ToLower(w.Cookies.SameSite)],
+		Keys:     keys,
+	}
+
+	return conventions
+}
+
+// ServerOptions returns the options to pass to webserver.New so the server
+// uses the configuration, including its static file directories.
+func (c *Config) ServerOptions() []webserver.Option {
+	options := []webserver.Option{webserver.WithConventions(c.WebserverConventions())}
+	for url, path := range c.Webserver.StaticFiles {
+		options = append(options, webserver.WithStaticFiles(url, path))
+	}
+	return options
+}
+
+// RenderConventions returns render.Conventions built from the configuration.
+func (c *Config) RenderConventions() render.Conventions {
+	return render.Conventions(c.Render)
+}
+
+// LoggerSettings returns logger.Settings built from the configuration.
+func (c *Config) LoggerSettings() logger.Settings {
+	l := c.Logger
+	settings := logger.Settings{
+		Trace:           l.Trace,
+		TraceModules:    map[string]bool{},
+		StackTraceLevel: l.StackTraceLevel,
+		ShutdownTimeout: time.Duration(l.ShutdownTimeout),
+		TimeFormat:      l.TimeFormat,
+		TimeZone:        l.TimeZone,
+		Modules:         map[string]string{},
+		Async:           logger.AsyncSettings(l.Async),
+		Sampling: logger.SamplingSettings{
+			Levels:        samplingRules(l.Sampling.Levels),
+			Modules:       map[string]map[string]logger.Sampling{},
+			DedupInterval: time.Duration(l.Sampling.DedupInterval),
+		},
+		Redaction: logger.RedactionSettings{
+			Fields:      append([]string{}, l.Redaction.Fields...),
+			Patterns:    append([]string{}, l.Redaction.Patterns...),
+			Replacement: l.Redaction.Replacement,
+		},
+	}
+	for module, level := range l.Modules {
+		settings.Modules[module] = level
+	}
+	for module, enabled := range l.TraceModules {
+		settings.TraceModules[module] = enabled
+	}
+	for module, rules := range l.Sampling.Modules {
+		settings.Sampling.Modules[module] = samplingRules(rules)
+	}
+
+	switch strings.ToLower(l.Output) {
+	case OutputStdout:
+		settings.Output = logger.Stdout{Level: l.Level, Format: l.Format, Template: l.Template}
+	case OutputStderr:
+		settings.Output = logger.Stderr{Level: l.Level, Format: l.Format, Template: l.Template}
+	case OutputDisk:
+		settings.Output = logger.Disk{
+			Path:           l.Path,
+			Level:          l.Level,
+			Format:         l.Format,
+			Template:       l.Template,
+			MaxSize:        l.MaxSize,
+			RotateEvery:    time.Duration(l.RotateEvery),
+			MaxBackups:     l.MaxBackups,
+			MaxAge:         time.Duration(l.MaxAge),
+			Compress:       l.Compress,
+			ReopenOnSIGHUP: l.ReopenOnSIGHUP,
+		}
+	case OutputLoggly:
+		settings.Output = logger.LogglySettings{Level: l.Level, Token: l.Token, Domain: l.Domain, Tags: l.Tags}
+	case OutputSyslog:
+		settings.Output = logger.Syslog{
+			Level:    l.Level,
+			Network:  l.Network,
+			Address:  l.Address,
+			Facility: l.Facility,
+			AppName:  l.AppName,
+		}
+	case OutputJournald:
+		settings.Output = logger.Journald{Level: l.Level, Socket: l.Address, Identifier: l.AppName}
+	case OutputDiscard:
+		settings.Output = logger.Stdiscard{}
+	}
+
+	return settings
+}
+
+// samplingRules converts sampling rules keyed by level name.
+func samplingRules(rules map[string]SamplingRule) map[string]logger.Sampling {
+	converted := make(map[string]logger.Sampling, len(rules))
+	for level, rule := range rules {
+		converted[level] = logger.Sampling{
+			Interval:   time.Duration(rule.Interval),
+			First:      rule.First,
+			Thereafter: rule.Thereafter,
+		}
+	}
+	return converted
+}
+
+// UnmarshalJSON reads durations from strings such as "1m30s" or numbers of
+// seconds.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+// MarshalJSON writes the duration as a string such as "1m30s".
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// String returns the duration formatted like time.Duration.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) set(v interface{}) error {
+	switch value := v.(type) {
+	case string:
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+			*d = Duration(seconds * float64(time.Second))
+			return nil
+		}
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("invalid duration " + strconv.Quote(value) + `; expected a value such as "250ms" or "5s"`)
+		}
+		*d = Duration(parsed)
+	case float64:
+		*d = Duration(value * float64(time.Second))
+	default:
+		return errors.New("invalid duration; expected a string such as \"250ms\" or a number of seconds")
+	}
+	return nil
+}
+
+func sameSiteName(mode http.SameSite) string {
+	for name, m := range sameSiteModes {
+		if name != "" && m == mode {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+func TestLoadWithOverlay(t *testing.T) {
+	c, err := Load("testdata/app.yaml", "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Logger.Level != "warn" {
+		t.Errorf("Expected the overlay level warn, got %q", c.Logger.Level)
+	}
+	if c.Logger.Format != "json" {
+		t.Errorf("Expected the base format json to be kept, got %q", c.Logger.Format)
+	}
+	if time.Duration(c.Webserver.RequestDurationWarning) != 500*time.Millisecond {
+		t.Errorf("Expected a 500ms duration warning, got %s", c.Webserver.RequestDurationWarning)
+	}
+	if c.Webserver.CSRF.CookieName != "_token" || c.Webserver.CSRF.FieldName != "_csrf" {
+		t.Errorf("Expected the CSRF cookie name to be overridden and the field name kept, got %+v", c.Webserver.CSRF)
+	}
+
+	conventions := c.WebserverConventions()
+	if conventions.Render.TemplateDirectory != "views/" {
+		t.Errorf("Expected the template directory views/, got %q", conventions.Render.TemplateDirectory)
+	}
+	if conventions.Health.ShutdownDelay != 0 {
+		t.Errorf("Expected no shutdown delay, got %s", conventions.Health.ShutdownDelay)
+	}
+
+	if params := conventions.AccessLog.RedactQueryParams; len(params) != 1 || params[0] != "session" {
+		t.Errorf("Expected the redacted query parameters to be replaced, got %v", params)
+	}
+	if !conventions.AccessLog.Headers || len(conventions.AccessLog.RedactHeaders) == 0 {
+		t.Errorf("Expected the access log headers to keep their defaults, got %+v", conventions.AccessLog)
+	}
+	if !c.LoggerSettings().TraceModules["webserver.render"] {
+		t.Error("Expected tracing to be enabled for webserver.render")
+	}
+	if zone := c.LoggerSettings().TimeZone; zone != "UTC" {
+		t.Errorf("Expected the UTC time zone, got %q", zone)
+	}
+	if fields := c.LoggerSettings().Redaction.Fields; len(fields) != 2 || fields[1] != "apiKey" {
+		t.Errorf("Expected the redacted fields, got %v", fields)
+	}
+
+	sampling := c.LoggerSettings().Sampling
+	if sampling.DedupInterval != time.Second {
+		t.Errorf("Expected a 1s dedup interval, got %s", sampling.DedupInterval)
+	}
+	if rule := sampling.Levels["debug"]; rule.Interval != time.Second || rule.First != 10 || rule.Thereafter != 100 {
+		t.Errorf("Expected debug messages to be sampled, got %+v", rule)
+	}
+	if rule := sampling.Modules["webserver"]["debug"]; rule.Interval != time.Minute || rule.First != 1 {
+		t.Errorf("Expected webserver debug messages to be sampled, got %+v", rule)
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	c, err := Load("testdata/app.json", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := c.WebserverConventions().Cookies
+	if cookies.SameSite != http.SameSiteStrictMode || cookies.MaxAge != 3600 {
+		t.Errorf("Expected strict cookies with a max age of 3600, got %+v", cookies)
+	}
+	if _, ok := c.LoggerSettings().Output.(logger.Stderr); !ok {
+		t.Errorf("Expected a stderr output, got %T", c.LoggerSettings().Output)
+	}
+
+	c, err = Load("testdata/app.toml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Webserver.Metrics.Path != "/internal/metrics" {
+		t.Errorf("Expected the metrics path /internal/metrics, got %q", c.Webserver.Metrics.Path)
+	}
+	disk, ok := c.LoggerSettings().Output.(logger.Disk)
+	if !ok || disk.Path != "/var/log/app.log" {
+		t.Errorf("Expected a disk output to /var/log/app.log, got %+v", c.LoggerSettings().Output)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	c := Defaults()
+	err := applyEnv(c, []string{
+		"GIA_LOGGER_LEVEL=debug",
+		"GIA_WEBSERVER_SECURITY_HEADERS_HSTS_MAX_AGE=1h",
+		"GIA_WEBSERVER_TRUSTED_PROXIES=10.0.0.0/8, 192.168.0.1",
+		"GIA_WEBSERVER_STATIC_FILES=/css=public/css,/js=public/js",
+		"GIA_WEBSERVER_COOKIES_HTTP_ONLY=false",
+		"GIA_RENDER_CACHE_TEMPLATES=false",
+		"PATH=/usr/bin",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Logger.Level != "debug" {
+		t.Errorf("Expected level debug, got %q", c.Logger.Level)
+	}
+	if time.Duration(c.Webserver.SecurityHeaders.HSTSMaxAge) != time.Hour {
+		t.Errorf("Expected an HSTS max age of 1h, got %s", c.Webserver.SecurityHeaders.HSTSMaxAge)
+	}
+	if len(c.Webserver.TrustedProxies) != 2 || c.Webserver.TrustedProxies[1] != "192.168.0.1" {
+		t.Errorf("Expected two trusted proxies, got %v", c.Webserver.TrustedProxies)
+	}
+	if c.Webserver.StaticFiles["/js"] != "public/js" {
+		t.Errorf("Expected /js to be served from public/js, got %v", c.Webserver.StaticFiles)
+	}
+	if c.Webserver.Cookies.HTTPOnly || c.Render.CacheTemplates {
+		t.Error("Expected the boolean variables to be applied")
+	}
+
+	err = applyEnv(Defaults(), []string{"GIA_WEBSERVER_HEALTH_CHECK_TIMEOUT=soon"})
+	if err == nil || !strings.Contains(err.Error(), "GIA_WEBSERVER_HEALTH_CHECK_TIMEOUT") {
+		t.Errorf("Expected an error naming the variable, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	_, err := Load("testdata/invalid.yaml", "")
+	v, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected a *ValidationError, got %v", err)
+	}
+
+	for _, key := range []string{"logger.level", "logger.path", "logger.sampling.levels.debug.interval", "logger.redaction.patterns", "logger.timeZone", "webserver.trustedProxies", "webserver.cookies.sameSite"} {
+		found := false
+		for _, problem := range v.Problems {
+			if strings.HasPrefix(problem, key+": ") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected a problem with %s in %v", key, v.Problems)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	if _, err := Load("testdata/unknown.json", ""); err == nil || !strings.Contains(err.Error(), "levle") {
+		t.Errorf("Expected the unknown key to be reported, got %v", err)
+	}
+	if _, err := Load("testdata/app.ini", ""); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestWatcherReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.json")
+	if err := ioutil.WriteFile(path, []byte(`{"logger": {"level": "info"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var reloadErr error
+	w, err := Watch(path, "", time.Hour, func(err error) { reloadErr = err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	var previous, current string
+	w.OnReload(func(p *Config, c *Config) {
+		previous, current = p.Logger.Level, c.Logger.Level
+	})
+
+	ioutil.WriteFile(path, []byte(`{"logger": {"level": "debug"}}`), 0644)
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if previous != "info" || current != "debug" || w.Config().Logger.Level != "debug" {
+		t.Errorf("Expected a reload from info to debug, got %q to %q", previous, current)
+	}
+
+	ioutil.WriteFile(path, []byte(`{"logger": {"level": "chatty"}}`), 0644)
+	if err := w.Reload(); err == nil || reloadErr == nil {
+		t.Error("Expected the invalid configuration to be reported")
+	}
+	if w.Config().Logger.Level != "debug" {
+		t.Errorf("Expected the previous configuration to be kept, got %q", w.Config().Logger.Level)
+	}
+}
+
+func TestWatchInvalidInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if _, err := Watch("testdata/unknown.json", "", interval, nil); err != ErrConfigInvalidInterval {
+			t.Errorf("Expected %v for %v, got %v", ErrConfigInvalidInterval, interval, err)
+		}
+	}
+}
+
+func TestApplyReloadableDiscard(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.json")
+	if err := ioutil.WriteFile(path, []byte(`{"logger": {"output": "discard", "level": "", "modules": {"webserver": "debug"}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Load(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := logger.New(logger.Settings{Output: logger.Stdiscard{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.SetLevel("warn")
+	if err := c.ApplyReloadable(nil, log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Level() != "warn" || log.ModuleLevels()["webserver"] != "debug" {
+		t.Errorf("Expected the level to be kept and the module level applied, got %s and %v", log.Level(), log.ModuleLevels())
+	}
+
+	c.Logger.Level = "chatty"
+	if err := c.Validate(); err == nil {
+		t.Error("Expected an invalid level to be rejected for the discard output")
+	}
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// EnvPrefix prefixes every environment variable read by Load, for example
+	// GIA_LOGGER_LEVEL or GIA_WEBSERVER_CSRF_COOKIE_NAME.
+	EnvPrefix = "GIA"
+	// EnvName names the environment variable selecting the overlay when Load
+	// is not given an environment.
+	EnvName = EnvPrefix + "_ENV"
+)
+
+// ErrConfigUnsupportedFormat is returned for files that are not YAML, JSON or
+// TOML.
+var ErrConfigUnsupportedFormat = errors.New("Unsupported configuration format; use .yaml, .yml, .json or .toml.")
+
+// Load reads the configuration file at path on top of Defaults. If env, or
+// the GIA_ENV environment variable when env is empty, names an environment
+// the overlay next to path is merged over it: app.yaml is overlaid by
+// app.prod.yaml for the "prod" environment. A missing overlay is not an
+// error. GIA_* environment variables are applied last and the result is
+// validated.
+//
+// An empty path loads only the defaults and the environment variables.
+func Load(path string, env string) (*Config, error) {
+	c := Defaults()
+
+	files, err := Files(path, env)
+	if err != nil {
+		return nil, err
+	}
+
+	document := map[string]interface{}{}
+	for _, file := range files {
+		values, err := readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		merge(document, values)
+	}
+
+	if err := decode(document, c); err != nil {
+		return nil, err
+	}
+	if err := applyEnv(c, os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Files returns the files Load reads for path and env, in the order they are
+// merged. Overlays that do not exist are omitted.
+func Files(path string, env string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if env == "" {
+		env = os.Getenv(EnvName)
+	}
+
+	files := []string{path}
+	if env == "" {
+		return files, nil
+	}
+
+	ext := filepath.Ext(path)
+	overlay := strings.TrimSuffix(path, ext) + "." + env + ext
+	if _, err := os.Stat(overlay); err == nil {
+		files = append(files, overlay)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// readFile parses a YAML, JSON or TOML file into a generic document.
+func readFile(path string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	document := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var values map[interface{}]interface{}
+		if err = yaml.Unmarshal(b, &values); err == nil {
+			document = normalize(values).(map[string]interface{})
+		}
+	case ".json":
+		err = json.Unmarshal(b, &document)
+	case ".toml":
+		_, err = toml.Decode(string(b), &document)
+	default:
+		return nil, fmt.Errorf("%s: %s", path, ErrConfigUnsupportedFormat)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return document, nil
+}
+
+// normalize converts the map[interface{}]interface{} values produced by the
+// YAML parser into map[string]interface{} so documents can be merged and
+// encoded as JSON.
+func normalize(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			m[fmt.Sprint(k)] = normalize(v)
+		}
+		return m
+	case []interface{}:
+		for i := range value {
+			value[i] = normalize(value[i])
+		}
+	}
+	return v
+}
+
+// merge copies src into dst. Nested sections are merged key by key; any
+// other value, including lists, replaces the value in dst.
+func merge(dst map[string]interface{}, src map[string]interface{}) {
+	for k, v := range src {
+		section, ok := v.(map[string]interface{})
+		existing, exists := dst[k].(map[string]interface{})
+		if ok && exists {
+			merge(existing, section)
+			continue
+		}
+		dst[k] = v
+	}
+}
+
+// decode fills c from the document, rejecting unknown keys so typos are
+// reported rather than ignored.
+func decode(document map[string]interface{}, c *Config) error {
+	b, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+	return nil
+}
+
+// applyEnv sets the fields of c named by GIA_* variables in environ. Variable
+// names are the upper snake case path of a field's key, so webserver.csrf
+// .cookieName is GIA_WEBSERVER_CSRF_COOKIE_NAME. Lists are comma separated
+// and maps are comma separated key=value pairs.
+func applyEnv(c *Config, environ []string) error {
+	values := make(map[string]string)
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 && strings.HasPrefix(kv, EnvPrefix+"_") {
+			values[kv[:i]] = kv[i+1:]
+		}
+	}
+	return setFromEnv(reflect.ValueOf(c).Elem(), EnvPrefix, values)
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+func setFromEnv(v reflect.Value, prefix string, values map[string]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		name := prefix + "_" + envName(strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+
+		if field.Kind() == reflect.Struct {
+			if err := setFromEnv(field, name, values); err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		if err := setValue(field, value); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func setValue(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		var d Duration
+		if err := d.set(value); err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("invalid boolean " + strconv.Quote(value))
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("invalid integer " + strconv.Quote(value))
+		}
+		field.SetInt(n)
+	case reflect.Slice:
+		list := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	case reflect.Map:
+		m := map[string]string{}
+		if field.Type() != reflect.TypeOf(m) {
+			return errors.New("cannot be set from the environment")
+		}
+		for _, pair := range strings.Split(value, ",") {
+			if pair = strings.TrimSpace(pair); pair == "" {
+				continue
+			}
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				return errors.New("invalid entry " + strconv.Quote(pair) + "; expected key=value")
+			}
+			m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		field.Set(reflect.ValueOf(m))
+	}
+	return nil
+}
+
+// envName converts a camel case key such as hstsMaxAge to HSTS_MAX_AGE.
+func envName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(rune(key[i-1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,241 @@
+package config
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+)
+
+// ValidationError lists every problem found in a configuration. Each problem
+// is prefixed with the key it concerns, for example "logger.level".
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "Invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+func (e *ValidationError) add(key string, problem string) {
+	e.Problems = append(e.Problems, key+": "+problem)
+}
+
+// Validate checks the configuration and returns a *ValidationError listing
+// every problem found, or nil.
+func (c *Config) Validate() error {
+	e := &ValidationError{}
+
+	c.validateLogger(e)
+	c.validateWebserver(e)
+	c.validateRender(e)
+
+	if len(e.Problems) > 0 {
+		return e
+	}
+	return nil
+}
+
+func (c *Config) validateLogger(e *ValidationError) {
+	l := c.Logger
+
+	output := strings.ToLower(l.Output)
+	switch output {
+	case OutputStdout, OutputStderr, OutputDisk, OutputLoggly, OutputSyslog, OutputJournald, OutputDiscard:
+	default:
+		e.add("logger.output", "unknown output "+strconv.Quote(l.Output)+"; use stdout, stderr, disk, loggly, syslog, journald or discard")
+		return
+	}
+
+	// The discard output needs no level, but one that is set is applied on
+	// reload and must be valid.
+	if !(output == OutputDiscard && l.Level == "") && logger.ValidateLevel(l.Level) != nil {
+		e.add("logger.level", "unknown level "+strconv.Quote(l.Level)+"; use panic, fatal, error, warn, info, debug or trace")
+	}
+	for _, module := range sortedKeys(l.Modules) {
+		if logger.ValidateLevel(l.Modules[module]) != nil {
+			e.add("logger.modules."+module, "unknown level "+strconv.Quote(l.Modules[module])+"; use panic, fatal, error, warn, info, debug or trace")
+		}
+	}
+
+	if l.StackTraceLevel != "" && logger.ValidateLevel(l.StackTraceLevel) != nil {
+		e.add("logger.stackTraceLevel", "unknown level "+strconv.Quote(l.StackTraceLevel)+"; use panic, fatal, error, warn, info, debug or trace")
+	}
+
+	if l.ShutdownTimeout < 0 {
+		e.add("logger.shutdownTimeout", "must not be negative")
+	}
+
+	for _, pattern := range l.Redaction.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			e.add("logger.redaction.patterns", "invalid pattern "+strconv.Quote(pattern)+": "+err.Error())
+		}
+	}
+
+	switch l.Format {
+	case "", logger.FormatText, logger.FormatLogfmt, logger.FormatJSON, logger.FormatECS, logger.FormatGELF:
+	case logger.FormatTemplate:
+		if _, err := template.New("entry").Parse(l.Template); err != nil || l.Template == "" {
+			e.add("logger.template", "the template format needs a valid text/template")
+		}
+	default:
+		e.add("logger.format", "unknown format "+strconv.Quote(l.Format)+"; use text, logfmt, json, ecs, gelf or template")
+	}
+	if l.TimeZone != "" {
+		if _, err := time.LoadLocation(l.TimeZone); err != nil {
+			e.add("logger.timeZone", "unknown time zone "+strconv.Quote(l.TimeZone))
+		}
+	}
+
+	switch l.Async.Policy {
+	case "", logger.AsyncBlock, logger.AsyncDropLowest, logger.AsyncSample:
+	default:
+		e.add("logger.async.policy", "unknown policy "+strconv.Quote(l.Async.Policy)+"; use block, drop or sample")
+	}
+	if l.Async.BufferSize < 0 {
+		e.add("logger.async.bufferSize", "must not be negative")
+	}
+
+	validateSampling(e, "logger.sampling.levels", l.Sampling.Levels)
+	modules := make([]string, 0, len(l.Sampling.Modules))
+	for module := range l.Sampling.Modules {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	for _, module := range modules {
+		validateSampling(e, "logger.sampling.modules."+module, l.Sampling.Modules[module])
+	}
+	if l.Sampling.DedupInterval < 0 {
+		e.add("logger.sampling.dedupInterval", "must not be negative")
+	}
+
+	switch output {
+	case OutputDisk:
+		if l.Path == "" {
+			e.add("logger.path", "required for the disk output")
+		}
+		if l.MaxSize < 0 || l.MaxBackups < 0 || l.RotateEvery < 0 || l.MaxAge < 0 {
+			e.add("logger", "maxSize, rotateEvery, maxBackups and maxAge must not be negative")
+		}
+	case OutputLoggly:
+		if l.Token == "" {
+			e.add("logger.token", "required for the loggly output")
+		}
+		if l.Domain == "" {
+			e.add("logger.domain", "required for the loggly output")
+		}
+	case OutputSyslog:
+		switch l.Network {
+		case "", "udp", "tcp", "tls", "unix", "unixgram":
+		default:
+			e.add("logger.network", "unknown network "+strconv.Quote(l.Network)+"; use udp, tcp, tls, unix or unixgram")
+		}
+		if l.Network == "tcp" || l.Network == "tls" {
+			if l.Address == "" {
+				e.add("logger.address", "required for the "+l.Network+" network")
+			}
+		}
+	}
+}
+
+func (c *Config) validateWebserver(e *ValidationError) {
+	w := c.Webserver
+
+	if _, err := context.ParseTrustedProxies(w.TrustedProxies); err != nil {
+		e.add("webserver.trustedProxies", err.Error())
+	}
+	switch w.ForwardedHeader {
+	case "", context.HeaderXForwardedFor, context.HeaderForwarded:
+	default:
+		e.add("webserver.forwardedHeader", "must be "+context.HeaderXForwardedFor+" or "+context.HeaderForwarded)
+	}
+
+	durations := []struct {
+		key   string
+		value Duration
+	}{
+		{"webserver.requestDurationWarning", w.RequestDurationWarning},
+		{"webserver.securityHeaders.hstsMaxAge", w.SecurityHeaders.HSTSMaxAge},
+		{"webserver.health.checkTimeout", w.Health.CheckTimeout},
+		{"webserver.health.shutdownDelay", w.Health.ShutdownDelay},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			e.add(d.key, "must not be negative")
+		}
+	}
+
+	if w.CSRF.CookieName == "" {
+		e.add("webserver.csrf.cookieName", "must not be empty")
+	}
+	if w.CSRF.FieldName == "" {
+		e.add("webserver.csrf.fieldName", "must not be empty")
+	}
+
+	if _, ok := sameSiteModes[strings.ToLower(w.Cookies.SameSite)]; !ok {
+		e.add("webserver.cookies.sameSite", "unknown mode "+strconv.Quote(w.Cookies.SameSite)+"; use default, lax, strict or none")
+	}
+	if strings.ToLower(w.Cookies.SameSite) == "none" && !w.Cookies.Secure {
+		e.add("webserver.cookies.sameSite", "none requires secure cookies")
+	}
+	if w.Cookies.MaxAge < 0 {
+		e.add("webserver.cookies.maxAge", "must not be negative")
+	}
+
+	for _, url := range sortedKeys(w.StaticFiles) {
+		if info, err := os.Stat(w.StaticFiles[url]); err != nil || !info.IsDir() {
+			e.add("webserver.staticFiles."+url, "directory "+strconv.Quote(w.StaticFiles[url])+" does not exist")
+		}
+	}
+}
+
+func (c *Config) validateRender(e *ValidationError) {
+	r := c.Render
+
+	if r.TemplateDirectory != "" && !strings.HasSuffix(r.TemplateDirectory, "/") {
+		e.add("render.templateDirectory", "must end with a slash")
+	}
+	if r.DelimPrefix == "" || r.DelimSuffix == "" {
+		e.add("render.delimPrefix", "both template delimiters must be set")
+	}
+	if r.PartialsDirectory != "" && !strings.HasSuffix(r.PartialsDirectory, "/") {
+		e.add("render.partialsDirectory", "must end with a slash")
+	}
+}
+
+// validateSampling checks sampling rules keyed by level name.
+func validateSampling(e *ValidationError, key string, rules map[string]SamplingRule) {
+	levels := make([]string, 0, len(rules))
+	for level := range rules {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+
+	for _, level := range levels {
+		rule := rules[level]
+		if logger.ValidateLevel(level) != nil {
+			e.add(key+"."+level, "unknown level "+strconv.Quote(level)+"; use panic, fatal, error, warn, info, debug or trace")
+		}
+		if rule.Interval <= 0 {
+			e.add(key+"."+level+".interval", "must be positive")
+		}
+		if rule.First < 0 || rule.Thereafter < 0 {
+			e.add(key+"."+level, "first and thereafter must not be negative")
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
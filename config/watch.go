@@ -0,0 +1,187 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver"
+)
+
+// ErrConfigInvalidInterval is returned by Watch for an interval that is not
+// positive.
+var ErrConfigInvalidInterval = errors.New("Please make sure the watch interval is greater than zero.")
+
+// Watcher reloads a configuration when its files change. Only the fields
+// that are safe to change at runtime should be applied from a reload; see
+// ApplyReloadable.
+type Watcher struct {
+	path     string
+	env      string
+	interval time.Duration
+
+	mu       sync.RWMutex
+	current  *Config
+	modified map[string]time.Time
+	onReload []func(previous *Config, current *Config)
+	onError  func(error)
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// Watch loads the configuration like Load and polls its files every interval
+// for changes. A configuration that fails to load or validate is reported to
+// onError, which may be nil, and the previous configuration is kept. The
+// interval must be greater than zero.
+func Watch(path string, env string, interval time.Duration, onError func(error)) (*Watcher, error) {
+	if interval <= 0 {
+		return nil, ErrConfigInvalidInterval
+	}
+
+	c, err := Load(path, env)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		path:     path,
+		env:      env,
+		interval: interval,
+		current:  c,
+		onError:  onError,
+		stop:     make(chan struct{}),
+	}
+	w.modified = w.modTimes()
+
+	go w.poll()
+
+	return w, nil
+}
+
+// Config returns the configuration most recently loaded.
+func (w *Watcher) Config() *Config {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	return w.current
+}
+
+// OnReload registers fn to be called with the previous and the new
+// configuration after every successful reload.
+func (w *Watcher) OnReload(fn func(previous *Config, current *Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.onReload = append(w.onReload, fn)
+}
+
+// Reload loads the configuration immediately, regardless of whether its files
+// changed.
+func (w *Watcher) Reload() error {
+	c, err := Load(w.path, w.env)
+	if err != nil {
+		if w.onError != nil {
+			w.onError(err)
+		}
+		return err
+	}
+
+	w.mu.Lock()
+	previous := w.current
+	w.current = c
+	callbacks := append([]func(*Config, *Config){}, w.onReload...)
+	w.mu.Unlock()
+
+	for _, fn := range callbacks {
+		fn(previous, c)
+	}
+	return nil
+}
+
+// Stop ends polling.
+func (w *Watcher) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+}
+
+func (w *Watcher) poll() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			modified := w.modTimes()
+			if sameModTimes(w.modified, modified) {
+				continue
+			}
+			w.modified = modified
+			w.Reload()
+		}
+	}
+}
+
+// modTimes returns the modification times of the files Load reads. An
+// overlay that appears or disappears changes the set and triggers a reload.
+func (w *Watcher) modTimes() map[string]time.Time {
+	times := make(map[string]time.Time)
+	files, err := Files(w.path, w.env)
+	if err != nil {
+		return times
+	}
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			times[file] = info.ModTime()
+		}
+	}
+	return times
+}
+
+func sameModTimes(a map[string]time.Time, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, t := range a {
+		if !b[file].Equal(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplyReloadable applies the fields of the configuration that can change
+// while the application runs: template caching on s and the log levels of
+// log. Either may be nil. An empty level, which the discard output allows,
+// keeps the current level. Module levels missing from the configuration are
+// removed. Every other field requires a restart.
+func (c *Config) ApplyReloadable(s *webserver.Server, log logger.Leveler) error {
+	if s != nil {
+		s.SetTemplateCaching(c.Render.CacheTemplates)
+	}
+	if log == nil {
+		return nil
+	}
+
+	if c.Logger.Level != "" {
+		if err := log.SetLevel(c.Logger.Level); err != nil {
+			return err
+		}
+	}
+	for module := range log.ModuleLevels() {
+		if _, ok := c.Logger.Modules[module]; !ok {
+			log.SetModuleLevel(module, "")
+		}
+	}
+	for module, level := range c.Logger.Modules {
+		if err := log.SetModuleLevel(module, level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
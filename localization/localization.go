@@ -32,6 +32,11 @@ func (e Error) Error() string {
 	return e.Err.Error()
 }
 
+// Unwrap returns the underlying error.
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
 // NewError returns a new localized error.
 func NewError(message string) *Error {
 	return &Error{Err: errors.New(message)}
@@ -0,0 +1,259 @@
+package logger
+
+import (
+	"sync"
+)
+
+// Policies applied by asynchronous logging when its buffer is full.
+const (
+	// AsyncBlock makes the logging call wait for space in the buffer.
+	AsyncBlock = "block"
+	// AsyncDropLowest discards the least severe entry, either a buffered
+	// entry less severe than the new one or the new entry itself.
+	AsyncDropLowest = "drop"
+	// AsyncSample keeps one in SampleRate of the entries that do not fit and
+	// waits for space for those; the others are discarded.
+	AsyncSample = "sample"
+)
+
+// AsyncSettings configures asynchronous logging. Entries are handed to a
+// bounded buffer and written to the outputs by background goroutines, so
+// slow outputs do not add latency to the logging call. Error, Fatal and Panic
+// entries are never discarded, whatever the Policy.
+type AsyncSettings struct {
+	// BufferSize is the number of entries buffered. Zero, the default, logs
+	// synchronously.
+	BufferSize int
+	// Writers is the number of goroutines writing to the outputs. The default
+	// is one; more than one may reorder entries.
+	Writers int
+	// Policy is AsyncBlock, AsyncDropLowest or AsyncSample. The default is
+	// AsyncBlock.
+	Policy string
+	// SampleRate is used by AsyncSample. The default is 10.
+	SampleRate int
+}
+
+// AsyncStats reports the state of asynchronous logging.
+type AsyncStats struct {
+	Buffered int
+	Capacity int
+	// Dropped counts the entries discarded because the buffer was full, by
+	// level name.
+	Dropped map[string]uint64
+}
+
+// asyncQueue is a ring buffer of entries drained by background writers.
+type asyncQueue struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	idle     *sync.Cond
+
+	entries []Entry
+	head    int
+	count   int
+	// pending counts the entries buffered or being written.
+	pending int
+	// running counts the writers, which return once the queue is stopped
+	// and empty.
+	running int
+	stopped bool
+
+	policy     string
+	sampleRate uint64
+	overflowed uint64
+	dropped    [TraceLevel + 1]uint64
+
+	dispatch func(Entry)
+}
+
+func newAsyncQueue(settings AsyncSettings, dispatch func(Entry)) (*asyncQueue, error) {
+	switch settings.Policy {
+	case "":
+		settings.Policy = AsyncBlock
+	case AsyncBlock, AsyncDropLowest, AsyncSample:
+	default:
+		return nil, ErrLogInvalidAsyncPolicy
+	}
+	if settings.Writers <= 0 {
+		settings.Writers = 1
+	}
+	if settings.SampleRate <= 0 {
+		settings.SampleRate = 10
+	}
+
+	q := &asyncQueue{
+		entries:    make([]Entry, settings.BufferSize),
+		policy:     settings.Policy,
+		sampleRate: uint64(settings.SampleRate),
+		dispatch:   dispatch,
+		running:    settings.Writers,
+	}
+	q.notEmpty = sync.NewCond(&q.mu)
+	q.notFull = sync.NewCond(&q.mu)
+	q.idle = sync.NewCond(&q.mu)
+
+	for i := 0; i < settings.Writers; i++ {
+		go q.run()
+	}
+
+	return q, nil
+}
+
+// push buffers entry, applying the policy if the buffer is full. Once the
+// queue is stopped entries are dispatched synchronously.
+func (q *asyncQueue) push(entry Entry) {
+	q.mu.Lock()
+	buffered := q.buffer(entry)
+	q.mu.Unlock()
+
+	if !buffered {
+		q.dispatch(entry)
+	}
+}
+
+// buffer adds entry to the buffer, applying the policy if it is full. It
+// returns false, leaving the entry to the caller, when the queue is stopped.
+// The caller holds mu.
+func (q *asyncQueue) buffer(entry Entry) bool {
+	for q.count == len(q.entries) && !q.stopped {
+		if entry.Level <= ErrorLevel || q.policy == AsyncBlock {
+			q.notFull.Wait()
+			continue
+		}
+
+		if q.policy == AsyncDropLowest {
+			i := q.leastSevere(entry.Level)
+			if i < 0 {
+				q.dropped[entry.Level]++
+				return true
+			}
+			q.dropped[q.at(i).Level]++
+			q.remove(i)
+			break
+		}
+
+		// AsyncSample
+		q.overflowed++
+		if q.overflowed%q.sampleRate != 0 {
+			q.dropped[entry.Level]++
+			return true
+		}
+		for q.count == len(q.entries) && !q.stopped {
+			q.notFull.Wait()
+		}
+	}
+	if q.stopped {
+		return false
+	}
+
+	q.entries[(q.head+q.count)%len(q.entries)] = entry
+	q.count++
+	q.pending++
+	q.notEmpty.Signal()
+	return true
+}
+
+// run writes buffered entries until the queue is stopped and empty.
+func (q *asyncQueue) run() {
+	for {
+		q.mu.Lock()
+		for q.count == 0 && !q.stopped {
+			q.notEmpty.Wait()
+		}
+		if q.count == 0 {
+			q.running--
+			q.idle.Broadcast()
+			q.mu.Unlock()
+			return
+		}
+		entry := q.entries[q.head]
+		q.entries[q.head] = Entry{}
+		q.head = (q.head + 1) % len(q.entries)
+		q.count--
+		q.notFull.Signal()
+		q.mu.Unlock()
+
+		q.dispatch(entry)
+
+		q.mu.Lock()
+		q.pending--
+		if q.pending == 0 {
+			q.idle.Broadcast()
+		}
+		q.mu.Unlock()
+	}
+}
+
+// drain waits until every buffered entry has been written.
+func (q *asyncQueue) drain() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.pending > 0 {
+		q.idle.Wait()
+	}
+}
+
+// stop writes the buffered entries and stops the writers. Entries pushed
+// afterwards are dispatched synchronously.
+func (q *asyncQueue) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.stopped = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+	for q.running > 0 {
+		q.idle.Wait()
+	}
+}
+
+// stats returns the buffer usage and drop counters.
+func (q *asyncQueue) stats() AsyncStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := AsyncStats{
+		Buffered: q.count,
+		Capacity: len(q.entries),
+		Dropped:  make(map[string]uint64),
+	}
+	for level, n := range q.dropped {
+		if n > 0 {
+			stats.Dropped[Level(level).String()] = n
+		}
+	}
+
+	return stats
+}
+
+// at returns the i-th buffered entry, oldest first.
+func (q *asyncQueue) at(i int) Entry {
+	return q.entries[(q.head+i)%len(q.entries)]
+}
+
+// leastSevere returns the index of the oldest of the least severe buffered
+// entries if it is less severe than level, or -1.
+func (q *asyncQueue) leastSevere(level Level) int {
+	index := -1
+	least := level
+	for i := 0; i < q.count; i++ {
+		if l := q.at(i).Level; l > least {
+			index, least = i, l
+		}
+	}
+	return index
+}
+
+// remove drops the i-th buffered entry, closing the gap.
+func (q *asyncQueue) remove(i int) {
+	size := len(q.entries)
+	for ; i < q.count-1; i++ {
+		q.entries[(q.head+i)%size] = q.entries[(q.head+i+1)%size]
+	}
+	q.entries[(q.head+q.count-1)%size] = Entry{}
+	q.count--
+	q.pending--
+}
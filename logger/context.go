@@ -0,0 +1,35 @@
+package logger
+
+import (
+	"context"
+)
+
+// contextKey is the key of the logger in a context.Context.
+type contextKey struct{}
+
+// discardLogger is returned by FromContext when no logger was stored. Like
+// every logger it still exits on Fatal and panics on Panic.
+var discardLogger ContextualLogger = &Context{
+	fields: Fields{},
+	logger: &Log{
+		outputs:   []output{{sink: discardSink{}, level: PanicLevel}},
+		levels:    newLevelRegistry(PanicLevel),
+		lifecycle: newLifecycle(nil, 0),
+		tracing:   newTraceRegistry(Settings{}),
+	},
+}
+
+// NewContext returns a copy of ctx carrying log, so functions further down
+// the call chain log with the same fields.
+func NewContext(ctx context.Context, log ContextualLogger) context.Context {
+	return context.WithValue(ctx, contextKey{}, log)
+}
+
+// FromContext returns the logger stored in ctx by NewContext. Without one it
+// returns a logger that discards every message, so callers need not check.
+func FromContext(ctx context.Context) ContextualLogger {
+	if log, ok := ctx.Value(contextKey{}).(ContextualLogger); ok {
+		return log
+	}
+	return discardLogger
+}
@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/go-gia/go-infrastructure/localization"
+)
+
+const (
+	// maxStackDepth is the number of frames captured for errorStack.
+	maxStackDepth = 32
+	// maxErrorChain bounds the errors walked through Unwrap, in case an
+	// error wraps itself.
+	maxErrorChain = 32
+)
+
+// errorFields returns the fields describing err: its message as error, its
+// type as errorType and the type and message of err and every error it wraps
+// as errorChain. Errors shown to users, localization.Error, are marked with
+// errorLocalized.
+func errorFields(err error) Fields {
+	if err == nil {
+		return Fields{}
+	}
+
+	fields := Fields{
+		"error":      err.Error(),
+		"errorType":  fmt.Sprintf("%T", err),
+		"errorChain": errorChain(err),
+	}
+	if localized(err) {
+		fields["errorLocalized"] = true
+	}
+
+	return fields
+}
+
+// errorChain returns the type and message of err and of the errors it wraps,
+// depth first for errors wrapping several.
+func errorChain(err error) []string {
+	var chain []string
+	walkErrors(err, func(e error) {
+		chain = append(chain, fmt.Sprintf("%T: %s", e, e.Error()))
+	})
+	return chain
+}
+
+// localized reports whether err or an error it wraps is a
+// localization.Error.
+func localized(err error) bool {
+	found := false
+	walkErrors(err, func(e error) {
+		switch e.(type) {
+		case localization.Error, *localization.Error:
+			found = true
+		}
+	})
+	return found
+}
+
+// walkErrors calls fn with err and every error it wraps through Unwrap.
+func walkErrors(err error, fn func(error)) {
+	for depth := 0; err != nil && depth < maxErrorChain; depth++ {
+		fn(err)
+
+		switch e := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, wrapped := range e.Unwrap() {
+				walkErrors(wrapped, fn)
+			}
+			return
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return
+		}
+	}
+}
+
+// captureStack returns the stack of the goroutine as function names and
+// file:line pairs. skip is the number of frames to skip, with 0 identifying
+// the caller of captureStack.
+func captureStack(skip int) string {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		b.WriteString(frame.Function + "\n\t" + frame.File + ":" + strconv.Itoa(frame.Line) + "\n")
+		if !more {
+			break
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,360 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Formats of the Stdout, Stderr and Disk outputs and the Encoding of Remote
+// outputs.
+const (
+	// FormatText is a human readable format, coloured when writing to a
+	// terminal unless the NO_COLOR environment variable is set. Without
+	// colours it is FormatLogfmt.
+	FormatText = "text"
+	// FormatLogfmt writes time, level, msg and the fields as key=value pairs.
+	FormatLogfmt = "logfmt"
+	// FormatJSON writes time, level, msg and the fields as a JSON object.
+	FormatJSON = "json"
+	// FormatECS writes JSON following the Elastic Common Schema.
+	FormatECS = "ecs"
+	// FormatGELF writes JSON following the Graylog Extended Log Format 1.1.
+	FormatGELF = "gelf"
+	// FormatTemplate executes the Template of the output for every entry.
+	FormatTemplate = "template"
+)
+
+// Names of the time, level and message of an entry in the text, logfmt and
+// JSON formats. Fields of the same name are prefixed with "fields.".
+const (
+	TimeKey    = "time"
+	LevelKey   = "level"
+	MessageKey = "msg"
+)
+
+// ecsVersion is the version of the Elastic Common Schema written by
+// FormatECS.
+const ecsVersion = "1.6.0"
+
+// formatter encodes an entry as a line for an output.
+type formatter interface {
+	Format(entry Entry) ([]byte, error)
+}
+
+// TemplateData is the data a FormatTemplate template is executed with. Time
+// is formatted with the TimeFormat of the settings.
+type TemplateData struct {
+	Time    string
+	Level   string
+	Message string
+	Fields  Fields
+}
+
+type (
+	// textFormatter formats entries with the coloured logrus text formatter.
+	textFormatter struct {
+		logger *logrus.Logger
+	}
+
+	// logfmtFormatter writes entries as logfmt.
+	logfmtFormatter struct {
+		timeFormat string
+	}
+
+	// jsonFormatter writes entries as JSON objects.
+	jsonFormatter struct {
+		timeFormat string
+	}
+
+	// ecsFormatter writes entries following the Elastic Common Schema.
+	ecsFormatter struct{}
+
+	// gelfFormatter writes entries following GELF 1.1.
+	gelfFormatter struct {
+		host string
+	}
+
+	// templateFormatter executes a text/template for every entry.
+	templateFormatter struct {
+		template   *template.Template
+		timeFormat string
+	}
+)
+
+// newFormatter returns the formatter of format, or of defaultFormat when
+// format is empty. Text is coloured when colors is set and out is a terminal.
+func newFormatter(format string, defaultFormat string, tmpl string, settings Settings, out io.Writer, colors bool) (formatter, error) {
+	if format == "" {
+		format = defaultFormat
+	}
+	timeFormat := settings.TimeFormat
+	if timeFormat == "" {
+		timeFormat = time.RFC3339
+	}
+
+	switch format {
+	case FormatText:
+		if !colors || !isTerminal(out) || os.Getenv("NO_COLOR") != "" {
+			return logfmtFormatter{timeFormat: timeFormat}, nil
+		}
+		l := logrus.New()
+		l.Out = out
+		l.Formatter = &logrus.TextFormatter{
+			ForceColors:     true,
+			FullTimestamp:   settings.TimeFormat != "",
+			TimestampFormat: timeFormat,
+		}
+		return textFormatter{logger: l}, nil
+	case FormatLogfmt:
+		return logfmtFormatter{timeFormat: timeFormat}, nil
+	case FormatJSON:
+		return jsonFormatter{timeFormat: timeFormat}, nil
+	case FormatECS:
+		return ecsFormatter{}, nil
+	case FormatGELF:
+		host, _ := os.Hostname()
+		return gelfFormatter{host: host}, nil
+	case FormatTemplate:
+		return newTemplateFormatter(tmpl, timeFormat)
+	}
+
+	return nil, ErrLogInvalidFormat
+}
+
+// isTerminal reports whether out is a character device such as a terminal.
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (f textFormatter) Format(entry Entry) ([]byte, error) {
+	return f.logger.Formatter.Format(logrusEntry(f.logger, entry))
+}
+
+// entryFields returns the fields of entry, prefixing those named like the
+// time, level or message with "fields.".
+func entryFields(entry Entry) Fields {
+	fields := make(Fields, len(entry.Fields)+3)
+	for k, v := range entry.Fields {
+		switch k {
+		case TimeKey, LevelKey, MessageKey:
+			k = "fields." + k
+		}
+		fields[k] = v
+	}
+	return fields
+}
+
+// fieldValue returns v in a form encoding/json writes as the value of the
+// field: errors as their message and values that fail to encode as text.
+func fieldValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case error:
+		return value.Error()
+	case json.Marshaler, string, bool, int, int64, float64, nil:
+		return v
+	}
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return v
+}
+
+// sortedKeys returns the keys of fields in order.
+func sortedKeys(fields Fields) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f logfmtFormatter) Format(entry Entry) ([]byte, error) {
+	var b bytes.Buffer
+	writeLogfmt(&b, TimeKey, entry.Time.Format(f.timeFormat))
+	writeLogfmt(&b, LevelKey, entry.Level.String())
+	writeLogfmt(&b, MessageKey, entry.Message)
+
+	fields := entryFields(entry)
+	for _, k := range sortedKeys(fields) {
+		writeLogfmt(&b, k, fields[k])
+	}
+
+	b.WriteByte('\n')
+	return b.Bytes(), nil
+}
+
+// writeLogfmt appends a key=value pair. Keys lose the characters logfmt does
+// not allow; values are quoted when they are empty or contain spaces, quotes,
+// equal signs or control characters.
+func writeLogfmt(b *bytes.Buffer, key string, value interface{}) {
+	if b.Len() > 0 {
+		b.WriteByte(' ')
+	}
+	b.WriteString(strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, key))
+	b.WriteByte('=')
+
+	s, ok := value.(string)
+	if !ok {
+		s = fmt.Sprint(value)
+	}
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || unicode.IsControl(r)
+	}) >= 0 {
+		s = strconv.Quote(s)
+	}
+	b.WriteString(s)
+}
+
+func (f jsonFormatter) Format(entry Entry) ([]byte, error) {
+	fields := entryFields(entry)
+	data := make(map[string]interface{}, len(fields)+3)
+	for k, v := range fields {
+		data[k] = fieldValue(v)
+	}
+	data[TimeKey] = entry.Time.Format(f.timeFormat)
+	data[LevelKey] = entry.Level.String()
+	data[MessageKey] = entry.Message
+
+	return marshalLine(data)
+}
+
+// marshalLine encodes data as a line of JSON.
+func marshalLine(data interface{}) ([]byte, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal fields to JSON, %v", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// ecsFields maps the fields the logger adds to their Elastic Common Schema
+// names.
+var ecsFields = map[string]string{
+	"module":     "log.logger",
+	"error":      "error.message",
+	"errorType":  "error.type",
+	"errorStack": "error.stack_trace",
+	"requestId":  "http.request.id",
+	"method":     "http.request.method",
+	"clientIP":   "client.ip",
+	"traceId":    "trace.id",
+	"spanId":     "span.id",
+}
+
+func (ecsFormatter) Format(entry Entry) ([]byte, error) {
+	data := make(map[string]interface{}, len(entry.Fields)+4)
+	for k, v := range entry.Fields {
+		if name, ok := ecsFields[k]; ok {
+			k = name
+		}
+		data[k] = fieldValue(v)
+	}
+
+	if caller, ok := entry.Fields["caller"].(string); ok {
+		delete(data, "caller")
+		if i := strings.LastIndex(caller, ":"); i > 0 {
+			data["log.origin.file.name"] = caller[:i]
+			if line, err := strconv.Atoi(caller[i+1:]); err == nil {
+				data["log.origin.file.line"] = line
+			}
+		}
+	}
+	data["@timestamp"] = entry.Time.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+	data["log.level"] = entry.Level.String()
+	data["message"] = entry.Message
+	data["ecs.version"] = ecsVersion
+
+	return marshalLine(data)
+}
+
+func (f gelfFormatter) Format(entry Entry) ([]byte, error) {
+	data := make(map[string]interface{}, len(entry.Fields)+5)
+	for k, v := range entry.Fields {
+		if k == "errorStack" {
+			data["full_message"] = fmt.Sprint(v)
+			continue
+		}
+		switch v.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		default:
+			v = fmt.Sprint(v)
+		}
+		data[gelfFieldName(k)] = v
+	}
+
+	data["version"] = "1.1"
+	data["host"] = f.host
+	data["short_message"] = entry.Message
+	data["timestamp"] = float64(entry.Time.UnixNano()/int64(time.Millisecond)) / 1000
+	data["level"] = syslogSeverity(entry.Level)
+
+	return marshalLine(data)
+}
+
+// gelfFieldName returns the name of an additional GELF field: the name
+// prefixed with an underscore and stripped of characters GELF does not allow.
+// The reserved _id becomes _id_.
+func gelfFieldName(name string) string {
+	name = "_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "_id" {
+		name = "_id_"
+	}
+	return name
+}
+
+// newTemplateFormatter parses tmpl, which is executed with TemplateData.
+func newTemplateFormatter(tmpl string, timeFormat string) (formatter, error) {
+	if tmpl == "" {
+		return nil, ErrLogInvalidTemplate
+	}
+	t, err := template.New("entry").Option("missingkey=zero").Parse(tmpl)
+	if err != nil {
+		return nil, ErrLogInvalidTemplate
+	}
+	return templateFormatter{template: t, timeFormat: timeFormat}, nil
+}
+
+func (f templateFormatter) Format(entry Entry) ([]byte, error) {
+	var b bytes.Buffer
+	err := f.template.Execute(&b, TemplateData{
+		Time:    entry.Time.Format(f.timeFormat),
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+		Fields:  entry.Fields,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if b.Len() == 0 || b.Bytes()[b.Len()-1] != '\n' {
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
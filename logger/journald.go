@@ -0,0 +1,119 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Journald is a type of output that sends messages to systemd-journald using
+// its native protocol. Fields are sent as journal fields, with their names
+// upper cased and characters other than letters, digits and underscores
+// replaced, so request_id becomes REQUEST_ID.
+type Journald struct {
+	Level string
+	// Socket is the path of the journald socket. The default is
+	// /run/systemd/journal/socket.
+	Socket string
+	// Identifier is sent as SYSLOG_IDENTIFIER. The default is the name of the
+	// executable.
+	Identifier string
+}
+
+// journaldSink writes entries as datagrams to the journald socket. Messages
+// must fit in a single datagram.
+type journaldSink struct {
+	settings Journald
+	conn     net.Conn
+}
+
+func newJournaldSink(settings Journald) (*journaldSink, error) {
+	if settings.Socket == "" {
+		settings.Socket = "/run/systemd/journal/socket"
+	}
+	if settings.Identifier == "" {
+		settings.Identifier = filepath.Base(os.Args[0])
+	}
+
+	conn, err := net.Dial("unixgram", settings.Socket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &journaldSink{settings: settings, conn: conn}, nil
+}
+
+func (s *journaldSink) Write(entry Entry) error {
+	var b bytes.Buffer
+
+	journaldField(&b, "MESSAGE", entry.Message)
+	journaldField(&b, "PRIORITY", strconv.Itoa(syslogSeverity(entry.Level)))
+	journaldField(&b, "SYSLOG_IDENTIFIER", s.settings.Identifier)
+
+	keys := make([]string, 0, len(entry.Fields))
+	for k := range entry.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		journaldField(&b, journaldFieldName(k), fmt.Sprint(entry.Fields[k]))
+	}
+
+	// Datagrams are written whole, so no lock is needed.
+	_, err := s.conn.Write(b.Bytes())
+	return err
+}
+
+func (s *journaldSink) Flush() error { return nil }
+
+// Close closes the socket. Closing a connection while a datagram is written
+// is safe, so no lock is needed here either.
+func (s *journaldSink) Close() error {
+	return s.conn.Close()
+}
+
+// journaldField appends a field. Values containing a newline are written
+// with their length as a little endian 64 bit integer instead of as
+// NAME=value.
+func journaldField(b *bytes.Buffer, name string, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name + "=" + value + "\n")
+		return
+	}
+
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+// journaldFieldName makes k a valid journal field name: upper case letters,
+// digits and underscores, not starting with an underscore or a digit and at
+// most 64 characters. Leading underscores are reserved for trusted fields and
+// names of the fields the sink sets itself are prefixed with F_.
+func journaldFieldName(k string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, k)
+	name = strings.TrimLeft(name, "_")
+	switch {
+	case name == "", name[0] >= '0' && name[0] <= '9',
+		name == "MESSAGE", name == "PRIORITY", name == "SYSLOG_IDENTIFIER":
+		name = "F_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
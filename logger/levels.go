@@ -0,0 +1,176 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+)
+
+// Level is the severity of a message. Lower levels are more severe; a logger
+// writes the messages at or below its level.
+type Level uint32
+
+// Levels from the most to the least severe.
+const (
+	PanicLevel Level = iota
+	FatalLevel
+	ErrorLevel
+	WarnLevel
+	InfoLevel
+	DebugLevel
+	TraceLevel
+)
+
+var levelNames = []string{"panic", "fatal", "error", "warn", "info", "debug", "trace"}
+
+// ParseLevel returns the Level named by level, case insensitively. "warning"
+// is accepted for warn.
+func ParseLevel(level string) (Level, error) {
+	name := strings.ToLower(level)
+	if name == "warning" {
+		name = "warn"
+	}
+	for i, n := range levelNames {
+		if n == name {
+			return Level(i), nil
+		}
+	}
+	return 0, ErrLogInvalidLevel
+}
+
+// String returns the lower case name of the level.
+func (level Level) String() string {
+	if int(level) < len(levelNames) {
+		return levelNames[level]
+	}
+	return "unknown"
+}
+
+// Leveler is implemented by loggers whose levels can be changed while the
+// application runs.
+type Leveler interface {
+	// Level returns the level of the logger.
+	Level() string
+	// SetLevel changes the level of the logger and of every named logger
+	// without a level of its own.
+	SetLevel(level string) error
+	// ModuleLevels returns the level overrides of named loggers.
+	ModuleLevels() map[string]string
+	// SetModuleLevel overrides the level of the named logger and its
+	// children. An empty level removes the override.
+	SetModuleLevel(module string, level string) error
+}
+
+// ValidateLevel returns ErrLogInvalidLevel unless level names a level
+// accepted by the outputs, SetLevel and SetModuleLevel.
+func ValidateLevel(level string) error {
+	_, err := ParseLevel(level)
+	return err
+}
+
+// levelRegistry holds the level of a Log and the level overrides of its
+// named loggers.
+type levelRegistry struct {
+	sync.RWMutex
+	level   Level
+	modules map[string]Level
+}
+
+func newLevelRegistry(level Level) *levelRegistry {
+	return &levelRegistry{
+		level:   level,
+		modules: make(map[string]Level),
+	}
+}
+
+// effective returns the level of the named logger: the override of the
+// closest module, "webserver" for "webserver.render", or the Log level.
+func (r *levelRegistry) effective(name string) Level {
+	r.RLock()
+	defer r.RUnlock()
+
+	for name != "" {
+		if level, ok := r.modules[name]; ok {
+			return level
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+
+	return r.level
+}
+
+// Named returns a logger for a module of the application, such as
+// "webserver.render". Named loggers share the outputs of l, log the module
+// name and can be given their own level with SetModuleLevel. Naming a named
+// logger joins the names with a dot.
+func (l *Log) Named(name string) *Log {
+	child := *l
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	child.name = name
+
+	return &child
+}
+
+// Level returns the level of l, which is the level of its module for named
+// loggers.
+func (l *Log) Level() string {
+	return l.levels.effective(l.name).String()
+}
+
+// SetLevel changes the level of the Log and every named logger without an
+// override. On a named logger it overrides the level of its module instead,
+// like SetModuleLevel. It is safe to call while logging.
+func (l *Log) SetLevel(level string) error {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if l.name != "" {
+		return l.SetModuleLevel(l.name, level)
+	}
+
+	l.levels.Lock()
+	defer l.levels.Unlock()
+
+	l.levels.level = parsed
+	return nil
+}
+
+// ModuleLevels returns the level overrides of named loggers keyed by module.
+func (l *Log) ModuleLevels() map[string]string {
+	l.levels.RLock()
+	defer l.levels.RUnlock()
+
+	modules := make(map[string]string, len(l.levels.modules))
+	for module, level := range l.levels.modules {
+		modules[module] = level.String()
+	}
+
+	return modules
+}
+
+// SetModuleLevel overrides the level of the named logger module and of its
+// children, so "webserver" also applies to "webserver.render" unless it has
+// an override of its own. An empty level removes the override.
+func (l *Log) SetModuleLevel(module string, level string) error {
+	l.levels.Lock()
+	defer l.levels.Unlock()
+
+	if level == "" {
+		delete(l.levels.modules, module)
+		return nil
+	}
+
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.levels.modules[module] = parsed
+
+	return nil
+}
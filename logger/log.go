@@ -2,22 +2,55 @@ package logger
 
 import (
   "errors"
-  "io/ioutil"
-  "os"
+  "fmt"
   "runtime"
   "strconv"
-
-  "github.com/Sirupsen/logrus"
-  "github.com/sebest/logrusly"
+  "time"
 )
 
 // Settings is container for an interface that is represented by the various
 // types below.
 type Settings struct {
   Output interface{}
+  // Outputs lists further outputs every message is fanned out to, each
+  // filtered by its own Level. Entries may be any of the output types below,
+  // a SinkOutput or a Sink.
+  Outputs []interface{}
+  // Trace sends the titles and args of Log.Trace to the Tracer, which
+  // defaults to a StdOutTracer. TraceModules enables or disables tracing for
+  // named loggers, for example {"webserver.render": true}.
   Trace  bool
+  Tracer Tracer
+  TraceModules map[string]bool
   Debug  bool
   Info   bool
+  // Modules overrides the level of named loggers, for example
+  // {"webserver.render": "debug"}. See Log.Named.
+  Modules map[string]string
+  // Async writes to the outputs in the background when its BufferSize is
+  // set.
+  Async AsyncSettings
+  // Sampling limits how often the same message is logged.
+  Sampling SamplingSettings
+  // StackTraceLevel attaches the stack of the logging call as errorStack to
+  // entries at this level and above which carry an error, such as those of
+  // WithError. Empty disables stack traces.
+  StackTraceLevel string
+  // Redaction masks sensitive fields and patterns in every entry.
+  Redaction RedactionSettings
+  // ExitHandler is called with the exit code after a Fatal message, once the
+  // shutdown hooks ran and the outputs are flushed. The default exits the
+  // process; tests may record the code instead, in which case Fatal returns.
+  ExitHandler func(code int)
+  // ShutdownTimeout bounds how long the shutdown hooks run. The default is
+  // DefaultShutdownTimeout.
+  ShutdownTimeout time.Duration
+  // TimeFormat is the layout, such as time.RFC3339Nano, of the time in the
+  // text, logfmt, json and template formats. The default is time.RFC3339.
+  TimeFormat string
+  // TimeZone is the location entries are timestamped in, such as "UTC" or
+  // "Europe/Berlin". The default is the local time zone.
+  TimeZone string
 }
 
 // LogglySettings is a type of output using the Loggly service.
@@ -29,21 +62,50 @@ type LogglySettings struct {
 }
 
 // Stderr is a type of output that uses the os.Stderr
+//
+// Format is one of the formats such as FormatText, the default, or
+// FormatTemplate, which executes Template for every entry.
 type Stderr struct {
-  Level  string
-  Format string
+  Level    string
+  Format   string
+  Template string
 }
 
 // Stdout is a type of output that uses the os.Stdout
+//
+// Format is one of the formats such as FormatText, the default, or
+// FormatTemplate, which executes Template for every entry.
 type Stdout struct {
-  Level  string
-  Format string
+  Level    string
+  Format   string
+  Template string
 }
 
 // Disk is a type of output that uses the logrus output which writes to disk.
+// The default Format is json. Rotated files are named after Path with the
+// UTC time of rotation, app.log becomes app-2006-01-02T15-04-05.000.log.
 type Disk struct {
-  Path  string
-  Level string
+  Path   string
+  Level  string
+  Format string
+  // Template is executed for every entry when Format is FormatTemplate.
+  Template string
+  // MaxSize rotates the file before it grows beyond MaxSize bytes. Zero
+  // disables rotation by size.
+  MaxSize int64
+  // RotateEvery rotates the file when a period, such as 24 * time.Hour,
+  // ends. Periods are aligned to UTC. Zero disables rotation by time.
+  RotateEvery time.Duration
+  // MaxBackups is the number of rotated files kept. Zero keeps all of them.
+  MaxBackups int
+  // MaxAge removes rotated files older than MaxAge. Zero keeps them
+  // regardless of age.
+  MaxAge time.Duration
+  // Compress gzips rotated files.
+  Compress bool
+  // ReopenOnSIGHUP reopens Path when the process receives SIGHUP so tools
+  // such as logrotate can move the file.
+  ReopenOnSIGHUP bool
 }
 
 // Stdiscard is a type of output that discards everything.
@@ -52,17 +114,32 @@ type Stdiscard struct{}
 // Log provides capabilities to log messages both as color formatted message
 // to stdout for developers and as JSON formatted messages sent to Logstash.
 type Log struct {
-  text     *logrus.Logger
-  hook     *logrusly.LogglyHook
-
-  isLoggly bool
-  debug    bool
-  info     bool
+  outputs []output
+  // queue buffers entries for the outputs when logging asynchronously.
+  queue   *asyncQueue
+  // sampler samples and deduplicates messages when Sampling is configured.
+  sampler *sampler
+  // stacks enables stack traces for errors logged at stackLevel and above.
+  stacks     bool
+  stackLevel Level
+  // redactor masks sensitive data when Redaction is configured.
+  redactor   *redactor
+
+  // name is set on loggers returned by Named and is logged as the module.
+  name     string
+  // levels is shared by a Log and its named loggers.
+  levels   *levelRegistry
+  // lifecycle is shared by a Log and its named loggers.
+  lifecycle *lifecycle
+  // location is the time zone of entries, nil for the local time zone.
+  location  *time.Location
+  // tracing is shared by a Log and its named loggers.
+  tracing   *traceRegistry
 }
 
 // Context wraps the standard Logger methods with additional context.
 type Context struct {
-  fields logrus.Fields
+  fields Fields
   logger *Log
 }
 
@@ -71,268 +148,240 @@ var (
   ErrLogLogglySetup = errors.New("Please make sure your loggly token / domain is setup properly")
 // ErrLogInvalidLevel is an error that is thrown when an invalid string is
 // passed as a level.
-  ErrLogInvalidLevel = errors.New("Please make sure you use a valid level: panic, fatal, error, warn, info, debug")
+  ErrLogInvalidLevel = errors.New("Please make sure you use a valid level: panic, fatal, error, warn, info, debug, trace")
 // ErrLogInvalidPath is an error that is thrown when an invalid path is passed
 // into Disk
   ErrLogInvalidPath = errors.New("Invalid path or permission error.")
 // ErrLogInvalidType is an error that is thrown when settings.Output.(type)
 // doesn't match what we're expecting.
   ErrLogInvalidType = errors.New("Invalid log output type.")
-// Tracer stores an implementation of Tracer
-  tracer Tracer
+// ErrLogInvalidFormat is an error that is thrown when an output's Format is
+// not one of the formats.
+  ErrLogInvalidFormat = errors.New("Please make sure you use a valid format: text, logfmt, json, ecs, gelf, template")
+// ErrLogInvalidTemplate is an error that is thrown when the Template of an
+// output using the template format is empty or can't be parsed.
+  ErrLogInvalidTemplate = errors.New("Please make sure the template of the output is a valid text/template.")
+// ErrLogInvalidTimeZone is an error that is thrown when settings.TimeZone is
+// not a known time zone.
+  ErrLogInvalidTimeZone = errors.New("Please make sure you use a valid time zone such as UTC or Europe/Berlin.")
+// ErrLogInvalidAsyncPolicy is an error that is thrown when
+// settings.Async.Policy is not one of the Async policies.
+  ErrLogInvalidAsyncPolicy = errors.New("Please make sure you use a valid async policy: block, drop, sample")
+// ErrLogInvalidSampling is an error that is thrown when a sampling rule has
+// no Interval or a negative First or Thereafter.
+  ErrLogInvalidSampling = errors.New("Please make sure sampling rules have a positive interval and no negative counts.")
+// ErrLogInvalidNetwork is an error that is thrown when the Network of a
+// Syslog output is not supported.
+  ErrLogInvalidNetwork = errors.New("Please make sure you use a valid syslog network: udp, tcp, tls, unix, unixgram")
+// ErrLogInvalidFacility is an error that is thrown when the Facility of a
+// Syslog output is not a syslog facility.
+  ErrLogInvalidFacility = errors.New("Please make sure you use a valid syslog facility such as user, daemon or local0 to local7")
+// ErrLogInvalidURL is an error that is thrown when the URL of a Remote
+// output is not an http, https, tcp or tls URL.
+  ErrLogInvalidURL = errors.New("Please make sure the remote URL uses http, https, tcp or tls")
+// ErrLogInvalidRemoteFormat is an error that is thrown when the Format of a
+// Remote output is not one of the Remote formats.
+  ErrLogInvalidRemoteFormat = errors.New("Please make sure you use a valid remote format: ndjson, elasticsearch, loki")
+// ErrLogRemoteBacklog is reported when a Remote output discards a batch
+// because too many batches are waiting to be sent.
+  ErrLogRemoteBacklog = errors.New("Too many log batches waiting to be sent.")
+// ErrLogInvalidPattern is an error that is thrown when a pattern of
+// settings.Redaction is not a valid regular expression.
+  ErrLogInvalidPattern = errors.New("Please make sure redaction patterns are valid regular expressions.")
+// ErrLogClosed is returned by outputs that are written to after Log.Close.
+  ErrLogClosed = errors.New("Please make sure the log is not used after it is closed.")
 )
 
 // New creates a Logger
-// Log levels Warn, Error, and Fatal are always logged.
+// Messages below the level of the output are discarded; the default level is
+// debug. Fatal and Panic messages exit or panic even when discarded.
 // If debug, all calls will also log caller informaton.
 //
 // The default format of logs will be JSON. Also supports 'text' which is
 // a easier format for people to understand if you are logging to stdout.
+//
+// With a single output its level is the level of the Log, which SetLevel
+// changes. With several outputs each keeps its own level, the Log starts at
+// the most verbose of them and SetLevel can only make outputs quieter.
 func New(settings Settings) (*Log, error) {
   // Setting up Log.
-  log := &Log{}
-  tracer = NilTracer{}
-
-  // Let's fire up a new logrus
-  text := logrus.New()
-  text.Level = logrus.DebugLevel
-
-  // Default is text, color me pretty if possible.
-  text.Formatter = &logrus.TextFormatter{ForceColors: true}
+  log := &Log{lifecycle: newLifecycle(settings.ExitHandler, settings.ShutdownTimeout)}
+  log.tracing = newTraceRegistry(settings)
 
-  var level logrus.Level
-  var err error
-  var overrideDefaultLevel bool
-
-  switch v := settings.Output.(type) {
-  case LogglySettings:
-    // Validate that the bare minimum of what is needed is present.
-    if v.Token == "" && v.Domain == "" {
-      return &Log{}, ErrLogLogglySetup
+  if settings.TimeZone != "" {
+    location, err := time.LoadLocation(settings.TimeZone)
+    if err != nil {
+      return log, ErrLogInvalidTimeZone
     }
+    log.location = location
+  }
 
-    if v.Level != "" {
-      level, err = logrus.ParseLevel(v.Level)
-      if err != nil {
-        return log, ErrLogInvalidLevel
-      }
-      overrideDefaultLevel = true
-    }
+  configured := settings.Outputs
+  if settings.Output != nil {
+    configured = append([]interface{}{settings.Output}, configured...)
+  }
+  if len(configured) == 0 {
+    return log, ErrLogInvalidType
+  }
 
-    var token, domain string
-    // Change the formatter to JSON, required here.
-    text.Formatter = &logrus.JSONFormatter{}
-    // initialize LogglyHook
-    token = v.Token
-    domain = v.Domain
-    // Create new hook
-    hook := logrusly.NewLogglyHook(token, domain, level)
-    // Add hook tags
-    for _, tag := range v.Tags {
-      hook.Tag(tag)
+  level := PanicLevel
+  for _, o := range configured {
+    out, err := newOutput(o, settings)
+    if err != nil {
+      return log, err
     }
-    // Finally, add the hook to the logrus
-    text.Hooks.Add(hook)
-    // Let's add information to the main log.
-    log.hook = hook
-    log.isLoggly = true
-  case Stderr:
-    text.Out = os.Stderr
-
-    if v.Format == "json" {
-      text.Formatter = &logrus.JSONFormatter{}
+    if out.level > level {
+      level = out.level
     }
+    log.outputs = append(log.outputs, out)
+  }
 
-    if v.Level != "" {
-      level, err = logrus.ParseLevel(v.Level)
-      if err != nil {
-        return log, ErrLogInvalidLevel
-      }
-      overrideDefaultLevel = true
-    }
-  case Stdout:
-    text.Out = os.Stdout
+  if len(log.outputs) == 1 {
+    log.outputs[0].level = TraceLevel
+  }
 
-    if settings.Trace {
-      tracer = StdOutTracer{}
+  log.levels = newLevelRegistry(level)
+  for module, moduleLevel := range settings.Modules {
+    if err := log.SetModuleLevel(module, moduleLevel); err != nil {
+      return log, err
     }
+  }
 
-    if v.Format == "json" {
-      text.Formatter = &logrus.JSONFormatter{}
+  if settings.StackTraceLevel != "" {
+    stackLevel, err := ParseLevel(settings.StackTraceLevel)
+    if err != nil {
+      return log, err
     }
+    log.stacks = true
+    log.stackLevel = stackLevel
+  }
 
-    if v.Level != "" {
-      level, err = logrus.ParseLevel(v.Level)
-      if err != nil {
-        return log, ErrLogInvalidLevel
-      }
-      overrideDefaultLevel = true
-    }
-  case Disk:
-    if v.Path == "" {
-      return log, ErrLogInvalidPath
-    }
+  redactor, err := newRedactor(settings.Redaction)
+  if err != nil {
+    return log, err
+  }
+  log.redactor = redactor
 
-    f, err := os.OpenFile(v.Path, os.O_RDWR | os.O_CREATE | os.O_APPEND, 0666)
+  sampling := settings.Sampling
+  if len(sampling.Levels) > 0 || len(sampling.Modules) > 0 || sampling.DedupInterval > 0 {
+    sampler, err := newSampler(sampling)
     if err != nil {
-      return log, ErrLogInvalidPath
+      return log, err
     }
+    log.sampler = sampler
+  }
 
-    text.Out = f
-    text.Formatter = &logrus.JSONFormatter{}
-
-    if v.Level != "" {
-      level, err = logrus.ParseLevel(v.Level)
-      if err != nil {
-        return log, err
-      }
-      overrideDefaultLevel = true
+  if settings.Async.BufferSize > 0 {
+    queue, err := newAsyncQueue(settings.Async, log.dispatch)
+    if err != nil {
+      return log, err
     }
-  case Stdiscard:
-    text.Out = ioutil.Discard
-  default:
-    // We should assume text unless overriden otherwise.
-    return log, ErrLogInvalidType
+    log.queue = queue
   }
 
-  // All the error checking for level has been handled up above.
-  if overrideDefaultLevel {
-    text.Level = level
-  }
+  return log, nil
+}
 
-  // Log debug / info evaluation
-  if text.Level == logrus.DebugLevel {
-    log.debug = true
-    log.info = true
+// Trace sends a low-level debug message to the Tracer when tracing is
+// enabled for the logger. At the trace level the message is also written to
+// the output with the args as a list.
+func (l *Log) Trace(title string, args ...interface{}) {
+  if l.tracing.on(l.name) {
+    l.trace(title, args)
   }
 
-  if text.Level == logrus.InfoLevel {
-    log.debug = false
-    log.info = true
+  if l.enabled(TraceLevel) {
+    l.write(TraceLevel, Fields{"args": args}, title)
   }
-
-  // Let's attach text to the log.
-  log.text = text
-
-  return log, nil
 }
 
-// Trace sends a low-level debug message to the Tracer
-func (l *Log) Trace(title string, args ...interface{}) {
-  tracer.Trace(title, args)
+// Tracef logs a printf formatted message at the Trace level
+func (l *Log) Tracef(format string, args ...interface{}) {
+  l.write(TraceLevel, nil, fmt.Sprintf(format, args...))
 }
 
 // Debug logs a message at the Debug level
 func (l *Log) Debug(args ...interface{}) {
-  if !l.debug {
-    return
-  }
-
-  l.text.Debugln(appendCallerInfo(args)...)
+  l.write(DebugLevel, nil, sprintln(args...))
 }
 
 // Debugf logs a printf formatted message at the Debug level
 func (l *Log) Debugf(format string, args ...interface{}) {
-  if !l.debug {
-    return
-  }
-
-  l.text.Debugf(format, appendCallerInfo(args)...)
+  l.write(DebugLevel, nil, fmt.Sprintf(format, args...))
 }
 
 // Info logs a message at the Info level
 func (l *Log) Info(args ...interface{}) {
-  if !l.info {
-    return
-  }
-
-  if l.debug {
-    l.text.Infoln(appendCallerInfo(args)...)
-    return
-  }
-
-  l.text.Infoln(args...)
+  l.write(InfoLevel, nil, sprintln(args...))
 }
 
 // Infof logs a printf formatted message at the Info level
 func (l *Log) Infof(format string, args ...interface{}) {
-  if l.debug {
-    f, a := appendCallerInfof(format, args)
-    l.text.Infof(f, a...)
-
-    return
-  }
-
-  l.text.Infof(format, args...)
+  l.write(InfoLevel, nil, fmt.Sprintf(format, args...))
 }
 
 // Warn logs a message at the Warn level
 func (l *Log) Warn(args ...interface{}) {
-  if l.debug {
-    l.text.Warnln(appendCallerInfo(args)...)
-    return
-  }
-
-  l.text.Warnln(args...)
+  l.write(WarnLevel, nil, sprintln(args...))
 }
 
 // Warnf logs a printf formatted message at the Warn level
 func (l *Log) Warnf(format string, args ...interface{}) {
-  if l.debug {
-    l.text.Warnf(format, appendCallerInfo(args)...)
-    return
-  }
-
-  l.text.Warnf(format, args...)
+  l.write(WarnLevel, nil, fmt.Sprintf(format, args...))
 }
 
 // Error logs a message at the Error level
 func (l *Log) Error(args ...interface{}) {
-  if l.debug {
-    l.text.Errorln(appendCallerInfo(args)...)
-    return
-  }
-
-  l.text.Errorln(args...)
+  l.write(ErrorLevel, nil, sprintln(args...))
 }
 
 // Errorf logs a printf formatted message at the Error level
 func (l *Log) Errorf(format string, args ...interface{}) {
-  if l.debug {
-    l.text.Errorf(format, appendCallerInfo(args)...)
-    return
-  }
-
-  l.text.Errorf(format, args...)
+  l.write(ErrorLevel, nil, fmt.Sprintf(format, args...))
 }
 
-// Fatal logs a message at the Fatal level
+// Fatal logs a message at the Fatal level, runs the shutdown hooks, flushes
+// the outputs and exits, even if the level is filtered.
 func (l *Log) Fatal(args ...interface{}) {
-  if l.debug {
-    l.text.Fatalln(appendCallerInfo(args)...)
-    return
-  }
+  l.write(FatalLevel, nil, sprintln(args...))
+}
+
+// Fatalf logs a printf formatted message at the Fatal level and exits like
+// Fatal.
+func (l *Log) Fatalf(format string, args ...interface{}) {
+  l.write(FatalLevel, nil, fmt.Sprintf(format, args...))
+}
+
+// Panic logs a message at the Panic level and panics with it.
+func (l *Log) Panic(args ...interface{}) {
+  l.write(PanicLevel, nil, sprintln(args...))
+}
 
-  l.text.Fatalln(args...)
+// Panicf logs a printf formatted message at the Panic level and panics with
+// it.
+func (l *Log) Panicf(format string, args ...interface{}) {
+  l.write(PanicLevel, nil, fmt.Sprintf(format, args...))
 }
 
-// Flush is a pass-through function that is exposed on logrusly package.
+// Flush writes the entries buffered for asynchronous logging and flushes
+// every output, such as the Loggly client which otherwise holds back up to 5
+// seconds worth of data.
 func (l *Log) Flush() {
-  if l.isLoggly {
-    // If this is loggly, we're passing flush to the client otherwise we lose
-    // 5 seconds worth of data (for not panic/fatal messages) and that's not cool.
-    l.hook.Flush()
+  if l.sampler != nil {
+    if summary := l.sampler.flush(); summary != nil {
+      l.emit(*summary)
+    }
   }
-}
 
-// Fatalf logs a printf formatted message at the Fatal level
-func (l *Log) Fatalf(format string, args ...interface{}) {
-  if l.debug {
-    l.text.Fatalf(format, appendCallerInfo(args)...)
-    return
+  if l.queue != nil {
+    l.queue.drain()
   }
 
-  l.text.Fatalf(format, args...)
+  for _, o := range l.outputs {
+    if err := o.sink.Flush(); err != nil {
+      reportWriteError(err)
+    }
+  }
 }
 
 // Context creates a Context which can either be immediately used or used
@@ -340,72 +389,225 @@ func (l *Log) Fatalf(format string, args ...interface{}) {
 // number of key/value values such as:
 // logger.Context("foo", 123).Debug("msg")
 func (l *Log) Context(fields Fields) ContextualLogger {
-  f := logrus.Fields{}
+  f := Fields{}
 
   for k, v := range fields {
     f[k] = v
   }
 
-  if l.debug {
-    file, line := getCaller(2)
-    fields["caller"] = shortenCaller(file) + ":" + strconv.Itoa(line)
-    //fields["line"] = line
-  }
-
   return &Context{
     fields: f,
     logger: l,
   }
 }
 
+// WithError creates a Context carrying err as structured fields: its message
+// as error, its type as errorType and every error it wraps as errorChain.
+// localization.Error is marked with errorLocalized. See
+// Settings.StackTraceLevel for stack traces.
+func (l *Log) WithError(err error) ContextualLogger {
+  return l.Context(errorFields(err))
+}
+
+// enabled reports whether messages at level are logged by this logger.
+func (l *Log) enabled(level Level) bool {
+  return level <= l.levels.effective(l.name)
+}
+
+// write is the single path every message takes to the outputs. Messages
+// below the effective level are discarded, although Fatal still exits and
+// Panic still panics. At the debug level the caller is added to the fields.
+// It must be called directly by the exported logging methods so the caller
+// is found at a fixed depth.
+func (l *Log) write(level Level, fields Fields, msg string) {
+  if l.enabled(level) {
+    data := make(Fields, len(fields) + 2)
+    for k, v := range fields {
+      data[k] = v
+    }
+    if l.name != "" {
+      data["module"] = l.name
+    }
+    if l.enabled(DebugLevel) {
+      file, line := getCaller(3)
+      data["caller"] = shortenCaller(file) + ":" + strconv.Itoa(line)
+    }
+    if _, ok := data["errorStack"]; !ok && l.stacks && level <= l.stackLevel && data["error"] != nil {
+      data["errorStack"] = captureStack(2)
+    }
+    if l.redactor != nil {
+      msg = l.redactor.message(msg)
+      l.redactor.redactFields(data)
+    }
+
+    now := time.Now()
+    if l.location != nil {
+      now = now.In(l.location)
+    }
+    entry := Entry{
+      Time:    now,
+      Level:   level,
+      Message: msg,
+      Fields:  data,
+    }
+    if l.sampler == nil || level <= FatalLevel || l.sample(entry) {
+      l.emit(entry)
+    }
+  }
+
+  switch level {
+  case FatalLevel:
+    l.exit(1)
+  case PanicLevel:
+    l.Flush()
+    panic(msg)
+  }
+}
+
+// sample reports whether entry survives deduplication and sampling. The
+// summary of a message that was deduplicated until now is logged first.
+func (l *Log) sample(entry Entry) bool {
+  key := entry.Level.String() + "\x00" + l.name + "\x00" + entry.Message
+
+  suppressed, summary := l.sampler.deduplicate(key, entry, l.emit)
+  if summary != nil {
+    l.emit(*summary)
+  }
+  if suppressed {
+    return false
+  }
+
+  return l.sampler.sample(key, l.name, entry.Level, entry.Time)
+}
+
+// emit hands entry to the outputs, through the buffer when logging
+// asynchronously.
+func (l *Log) emit(entry Entry) {
+  if l.queue != nil {
+    l.queue.push(entry)
+    return
+  }
+
+  l.dispatch(entry)
+}
+
+// dispatch writes entry to every output whose level includes it.
+func (l *Log) dispatch(entry Entry) {
+  for _, o := range l.outputs {
+    if entry.Level > o.level {
+      continue
+    }
+    if err := o.sink.Write(entry); err != nil {
+      reportWriteError(err)
+    }
+  }
+}
+
+// AsyncStats returns the buffer usage and the number of entries dropped by
+// asynchronous logging. It is empty when logging synchronously.
+func (l *Log) AsyncStats() AsyncStats {
+  if l.queue == nil {
+    return AsyncStats{Dropped: map[string]uint64{}}
+  }
+
+  return l.queue.stats()
+}
+
+// Trace logs a message at the Trace level
+func (c *Context) Trace(args ...interface{}) {
+  c.logger.write(TraceLevel, c.fields, sprintln(args...))
+}
+
+// Tracef logs a printf formatted message at the Trace level
+func (c *Context) Tracef(format string, args ...interface{}) {
+  c.logger.write(TraceLevel, c.fields, fmt.Sprintf(format, args...))
+}
+
 // Debug logs a message at the Debug level
 func (c *Context) Debug(args ...interface{}) {
-  c.logger.text.WithFields(c.fields).Debugln(args...)
+  c.logger.write(DebugLevel, c.fields, sprintln(args...))
 }
 
 // Debugf logs a printf formatted message at the Debug level
 func (c *Context) Debugf(format string, args ...interface{}) {
-  c.logger.text.WithFields(c.fields).Debugf(format, args...)
+  c.logger.write(DebugLevel, c.fields, fmt.Sprintf(format, args...))
 }
 
 // Info logs a message at the Info level
 func (c *Context) Info(args ...interface{}) {
-  c.logger.text.WithFields(c.fields).Infoln(args...)
+  c.logger.write(InfoLevel, c.fields, sprintln(args...))
 }
 
 // Infof logs a printf formatted message at the Info level
 func (c *Context) Infof(format string, args ...interface{}) {
-  c.logger.text.WithFields(c.fields).Infof(format, args...)
+  c.logger.write(InfoLevel, c.fields, fmt.Sprintf(format, args...))
 }
 
 // Warn logs a message at the Warn level
 func (c *Context) Warn(args ...interface{}) {
-  c.logger.text.WithFields(c.fields).Warnln(args...)
+  c.logger.write(WarnLevel, c.fields, sprintln(args...))
 }
 
 // Warnf logs a printf formatted message at the Warn level
 func (c *Context) Warnf(format string, args ...interface{}) {
-  c.logger.text.WithFields(c.fields).Warnf(format, args...)
+  c.logger.write(WarnLevel, c.fields, fmt.Sprintf(format, args...))
 }
 
 // Error logs a message at the Error level
 func (c *Context) Error(args ...interface{}) {
-  c.logger.text.WithFields(c.fields).Errorln(args...)
+  c.logger.write(ErrorLevel, c.fields, sprintln(args...))
 }
 
 // Errorf logs a printf formatted message at the Error level
 func (c *Context) Errorf(format string, args ...interface{}) {
-  c.logger.text.WithFields(c.fields).Errorf(format, args...)
+  c.logger.write(ErrorLevel, c.fields, fmt.Sprintf(format, args...))
 }
 
-// Fatal logs a message at the Fatal level
+// Fatal logs a message at the Fatal level, runs the shutdown hooks, flushes
+// the outputs and exits, even if the level is filtered.
 func (c *Context) Fatal(args ...interface{}) {
-  c.logger.text.WithFields(c.fields).Fatalln(args...)
+  c.logger.write(FatalLevel, c.fields, sprintln(args...))
 }
 
-// Fatalf logs a printf formatted message at the Fatal level
+// Fatalf logs a printf formatted message at the Fatal level and exits like
+// Fatal.
 func (c *Context) Fatalf(format string, args ...interface{}) {
-  c.logger.text.WithFields(c.fields).Fatalf(format, args...)
+  c.logger.write(FatalLevel, c.fields, fmt.Sprintf(format, args...))
+}
+
+// Panic logs a message at the Panic level and panics with it.
+func (c *Context) Panic(args ...interface{}) {
+  c.logger.write(PanicLevel, c.fields, sprintln(args...))
+}
+
+// Panicf logs a printf formatted message at the Panic level and panics with
+// it.
+func (c *Context) Panicf(format string, args ...interface{}) {
+  c.logger.write(PanicLevel, c.fields, fmt.Sprintf(format, args...))
+}
+
+// WithError returns a Context with the fields describing err added to the
+// fields of c. See Log.WithError.
+func (c *Context) WithError(err error) ContextualLogger {
+  return c.With(errorFields(err))
+}
+
+// With returns a Context with fields added to the fields of c, replacing
+// fields of the same name. c is not changed.
+func (c *Context) With(fields Fields) ContextualLogger {
+  f := make(Fields, len(c.fields) + len(fields))
+
+  for k, v := range c.fields {
+    f[k] = v
+  }
+  for k, v := range fields {
+    f[k] = v
+  }
+
+  return &Context{
+    fields: f,
+    logger: c.logger,
+  }
 }
 
 // getCallerInfo returns file and line information for the code that likly logged
@@ -422,29 +624,11 @@ func getCaller(depth int) (file string, line int) {
   return file, line
 }
 
-func appendCallerInfof(format string, args ...interface{}) (string, []interface{}) {
-  file, line := getCaller(3)
-  //args = append(args,file,line)
-
-  return format + " %s:%d", append(args, shortenCaller(file), line)
-}
-
-// appendCallerInfo appends the provided arguments with file and line information from
-func appendCallerInfo(args ...interface{}) []interface{} {
-  file, line := getCaller(3)
-
-  size := len(args)
-
-  result := make([]interface{}, size + 1)
-
-  for i := 0; i < size; i++ {
-    result[i] = args[i]
-  }
-
-  result[size] = shortenCaller(file) + ":" + strconv.Itoa(line)
-
-  return result
-
+// sprintln formats args like the Println family of logrus, which always
+// separates operands with spaces, without the trailing newline.
+func sprintln(args ...interface{}) string {
+  msg := fmt.Sprintln(args...)
+  return msg[:len(msg)-1]
 }
 
 func shortenCaller(file string) string {
@@ -6,6 +6,7 @@ type Fields map[string]interface{}
 // Logger logs messages at different severity levels.
 type Logger interface {
 	Trace(title string, args ...interface{})
+	Tracef(format string, args ...interface{})
 	Debug(args ...interface{})
 	Debugf(format string, args ...interface{})
 	Info(args ...interface{})
@@ -16,13 +17,18 @@ type Logger interface {
 	Errorf(format string, args ...interface{})
 	Fatal(args ...interface{})
 	Fatalf(format string, args ...interface{})
+	Panic(args ...interface{})
+	Panicf(format string, args ...interface{})
 	Context(fields Fields) ContextualLogger
+	WithError(err error) ContextualLogger
 	Flush()
 }
 
 // ContextualLogger provides the same logging methods as Logger but adds
 // additional contextual information.
 type ContextualLogger interface {
+	Trace(args ...interface{})
+	Tracef(format string, args ...interface{})
 	Debug(args ...interface{})
 	Debugf(format string, args ...interface{})
 	Info(args ...interface{})
@@ -33,4 +39,11 @@ type ContextualLogger interface {
 	Errorf(format string, args ...interface{})
 	Fatal(args ...interface{})
 	Fatalf(format string, args ...interface{})
+	Panic(args ...interface{})
+	Panicf(format string, args ...interface{})
+	// With returns a ContextualLogger carrying fields in addition to the
+	// fields of this one.
+	With(fields Fields) ContextualLogger
+	// WithError returns a ContextualLogger carrying err as structured fields.
+	WithError(err error) ContextualLogger
 }
@@ -1,131 +1,412 @@
 package logger
-// NewLogMock returns a new mock logger
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewLogMock returns a new mock logger which records the messages of its
+// level and above instead of writing them. The level is taken from the
+// outputs in settings the way New does: the level of a single output, or the
+// most verbose of several. Nothing is opened or sent.
 func NewLogMock(settings Settings) (*MockLog, error) {
-	mockLog := &MockLog{}
+	mockLog := &MockLog{recorder: &mockRecorder{}}
+
+	configured := settings.Outputs
+	if settings.Output != nil {
+		configured = append([]interface{}{settings.Output}, configured...)
+	}
+	if len(configured) == 0 {
+		return mockLog, ErrLogInvalidType
+	}
 
-	var level string
+	mockLog.level = PanicLevel
+	for _, o := range configured {
+		var level string
 
-	switch v := settings.Output.(type) {
-	case LogglySettings:
-		if level != "" {
+		switch v := o.(type) {
+		case LogglySettings:
 			level = v.Level
-		}
-	case Stderr:
-		if level != "" {
+		case Stderr:
 			level = v.Level
-		}
-	case Stdout:
-		if level != "" {
+		case Stdout:
+			level = v.Level
+		case Disk:
+			level = v.Level
+		case Syslog:
+			level = v.Level
+		case Journald:
+			level = v.Level
+		case Remote:
 			level = v.Level
+		case SinkOutput:
+			level = v.Level
+		case Stdiscard, Sink:
+		default:
+			return mockLog, ErrLogInvalidType
 		}
-	case Disk:
+
+		parsed := DebugLevel
 		if level != "" {
-			level = v.Level
+			var err error
+			if parsed, err = ParseLevel(level); err != nil {
+				return mockLog, err
+			}
+		}
+		if parsed > mockLog.level {
+			mockLog.level = parsed
 		}
-	default:
-		return mockLog, ErrLogInvalidType
 	}
 
-	if level == "debug" {
-		mockLog.debug = true
-		mockLog.info = true
+	return mockLog, nil
+}
+
+// MockLog is a Logger for tests. It records every message of its level and
+// above, together with its fields and caller, so tests can assert on them.
+// Fatal does not exit; Panic panics like Log does. It is safe for concurrent
+// use, and contexts created from it record into it.
+type MockLog struct {
+	level    Level
+	recorder *mockRecorder
+}
+
+// MockEntry is a message recorded by a MockLog. Args holds the arguments the
+// message was formatted from and Caller the file and line that logged it.
+type MockEntry struct {
+	Entry
+	Args   []interface{}
+	Caller string
+}
+
+// TestReporter is the part of *testing.T used by AssertEntry.
+type TestReporter interface {
+	Errorf(format string, args ...interface{})
+}
+
+type mockRecorder struct {
+	sync.Mutex
+	entries []MockEntry
+	hooks   []ShutdownHook
+}
+
+// Entries returns the recorded entries, oldest first.
+func (l *MockLog) Entries() []MockEntry {
+	l.recorder.Lock()
+	defer l.recorder.Unlock()
+
+	entries := make([]MockEntry, len(l.recorder.entries))
+	copy(entries, l.recorder.entries)
+	return entries
+}
+
+// FindEntries returns the recorded entries at level whose message contains
+// msgSubstr and whose fields include every field in fields.
+func (l *MockLog) FindEntries(level Level, msgSubstr string, fields Fields) []MockEntry {
+	var found []MockEntry
+	for _, entry := range l.Entries() {
+		if entry.matches(level, msgSubstr, fields) {
+			found = append(found, entry)
+		}
 	}
-	if level == "info" {
-		mockLog.debug = false
-		mockLog.info = true
+	return found
+}
+
+// HasEntry reports whether an entry at level was recorded whose message
+// contains msgSubstr and whose fields include every field in fields. Field
+// values are compared with reflect.DeepEqual.
+func (l *MockLog) HasEntry(level Level, msgSubstr string, fields Fields) bool {
+	return len(l.FindEntries(level, msgSubstr, fields)) > 0
+}
+
+// AssertEntry reports an error on t listing the recorded entries unless
+// HasEntry finds a match. It returns whether it found one.
+func (l *MockLog) AssertEntry(t TestReporter, level Level, msgSubstr string, fields Fields) bool {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
 	}
 
-	mockLog.text = new(Logger)
+	if l.HasEntry(level, msgSubstr, fields) {
+		return true
+	}
 
-	return mockLog, nil
+	var recorded []string
+	for _, entry := range l.Entries() {
+		recorded = append(recorded, entry.String())
+	}
+	t.Errorf("Expected a %s entry containing %q with fields %v, recorded:\n%s", level, msgSubstr, fields, strings.Join(recorded, "\n"))
+	return false
 }
 
-// MockLog mock object
-type MockLog struct {
-	text *Logger
+// Reset discards the recorded entries.
+func (l *MockLog) Reset() {
+	l.recorder.Lock()
+	defer l.recorder.Unlock()
 
-	// behavior flags
-	isLoggly bool
-	debug    bool
-	info     bool
+	l.recorder.entries = nil
+}
+
+// String formats the entry for test failures.
+func (e MockEntry) String() string {
+	return fmt.Sprintf("%s %q %v (%s)", e.Level, e.Message, e.Fields, e.Caller)
+}
+
+func (e MockEntry) matches(level Level, msgSubstr string, fields Fields) bool {
+	if e.Level != level || !strings.Contains(e.Message, msgSubstr) {
+		return false
+	}
+	for k, v := range fields {
+		actual, ok := e.Fields[k]
+		if !ok || !reflect.DeepEqual(actual, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// record keeps a message if its level is enabled and panics for the Panic
+// level. Like Log.write, it must be called directly by the exported logging
+// methods so the caller is found at a fixed depth.
+func (l *MockLog) record(level Level, fields Fields, msg string, args []interface{}) {
+	if level <= l.level {
+		data := make(Fields, len(fields))
+		for k, v := range fields {
+			data[k] = v
+		}
+		file, line := getCaller(3)
+
+		entry := MockEntry{
+			Entry: Entry{
+				Time:    time.Now(),
+				Level:   level,
+				Message: msg,
+				Fields:  data,
+			},
+			Args:   args,
+			Caller: shortenCaller(file) + ":" + strconv.Itoa(line),
+		}
+
+		l.recorder.Lock()
+		l.recorder.entries = append(l.recorder.entries, entry)
+		l.recorder.Unlock()
+	}
+
+	if level == PanicLevel {
+		panic(msg)
+	}
 }
 
 // Flush inside mock logger
 func (l *MockLog) Flush() {}
 
+// OnShutdown registers a hook run by Shutdown. Fatal does not run the hooks.
+func (l *MockLog) OnShutdown(hook ShutdownHook) {
+	l.recorder.Lock()
+	defer l.recorder.Unlock()
+
+	l.recorder.hooks = append(l.recorder.hooks, hook)
+}
+
+// Shutdown runs the registered hooks once, in the reverse order of their
+// registration, and records the errors they return.
+func (l *MockLog) Shutdown() {
+	l.recorder.Lock()
+	hooks := l.recorder.hooks
+	l.recorder.hooks = nil
+	l.recorder.Unlock()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](context.Background()); err != nil {
+			l.WithError(err).Error("Shutdown hook failed")
+		}
+	}
+}
+
 // Trace inside mock logger
-func (l *MockLog) Trace(title string, args ...interface{}) {}
+func (l *MockLog) Trace(title string, args ...interface{}) {
+	l.record(TraceLevel, Fields{"args": args}, title, args)
+}
+
+// Tracef inside mock logger
+func (l *MockLog) Tracef(format string, args ...interface{}) {
+	l.record(TraceLevel, nil, fmt.Sprintf(format, args...), args)
+}
 
 // Debug inside mock logger
-func (l *MockLog) Debug(args ...interface{}) {}
+func (l *MockLog) Debug(args ...interface{}) {
+	l.record(DebugLevel, nil, sprintln(args...), args)
+}
 
 // Debugf inside mock logger
-func (l *MockLog) Debugf(format string, args ...interface{}) {}
+func (l *MockLog) Debugf(format string, args ...interface{}) {
+	l.record(DebugLevel, nil, fmt.Sprintf(format, args...), args)
+}
 
 // Info inside mock logger
-func (l *MockLog) Info(args ...interface{}) {}
+func (l *MockLog) Info(args ...interface{}) {
+	l.record(InfoLevel, nil, sprintln(args...), args)
+}
 
 // Infof inside mock logger
-func (l *MockLog) Infof(format string, args ...interface{}) {}
+func (l *MockLog) Infof(format string, args ...interface{}) {
+	l.record(InfoLevel, nil, fmt.Sprintf(format, args...), args)
+}
 
 // Warn inside mock logger
-func (l *MockLog) Warn(args ...interface{}) {}
+func (l *MockLog) Warn(args ...interface{}) {
+	l.record(WarnLevel, nil, sprintln(args...), args)
+}
 
 // Warnf inside mock logger
-func (l *MockLog) Warnf(format string, args ...interface{}) {}
+func (l *MockLog) Warnf(format string, args ...interface{}) {
+	l.record(WarnLevel, nil, fmt.Sprintf(format, args...), args)
+}
 
 // Error inside mock logger
-func (l *MockLog) Error(args ...interface{}) {}
+func (l *MockLog) Error(args ...interface{}) {
+	l.record(ErrorLevel, nil, sprintln(args...), args)
+}
 
 // Errorf inside mock logger
-func (l *MockLog) Errorf(format string, args ...interface{}) {}
+func (l *MockLog) Errorf(format string, args ...interface{}) {
+	l.record(ErrorLevel, nil, fmt.Sprintf(format, args...), args)
+}
+
+// Fatal inside mock logger, which does not exit
+func (l *MockLog) Fatal(args ...interface{}) {
+	l.record(FatalLevel, nil, sprintln(args...), args)
+}
 
-// Fatal inside mock logger
-func (l *MockLog) Fatal(args ...interface{}) {}
+// Fatalf inside mock logger, which does not exit
+func (l *MockLog) Fatalf(format string, args ...interface{}) {
+	l.record(FatalLevel, nil, fmt.Sprintf(format, args...), args)
+}
+
+// Panic inside mock logger
+func (l *MockLog) Panic(args ...interface{}) {
+	l.record(PanicLevel, nil, sprintln(args...), args)
+}
 
-// Fatalf inside mock logger
-func (l *MockLog) Fatalf(format string, args ...interface{}) {}
+// Panicf inside mock logger
+func (l *MockLog) Panicf(format string, args ...interface{}) {
+	l.record(PanicLevel, nil, fmt.Sprintf(format, args...), args)
+}
 
 // Context inside mock logger
 func (l *MockLog) Context(fields Fields) ContextualLogger {
+	f := Fields{}
+	for k, v := range fields {
+		f[k] = v
+	}
+
 	return &MockContext{
-		fields: fields,
+		fields: f,
 		logger: l,
 	}
 }
 
+// WithError inside mock logger
+func (l *MockLog) WithError(err error) ContextualLogger {
+	return l.Context(errorFields(err))
+}
+
 // MockContext mock
 type MockContext struct {
 	fields Fields
 	logger *MockLog
 }
 
+// Trace inside mock logger
+func (c *MockContext) Trace(args ...interface{}) {
+	c.logger.record(TraceLevel, c.fields, sprintln(args...), args)
+}
+
+// Tracef inside mock logger
+func (c *MockContext) Tracef(format string, args ...interface{}) {
+	c.logger.record(TraceLevel, c.fields, fmt.Sprintf(format, args...), args)
+}
+
 // Debug inside mock logger
-func (c *MockContext) Debug(args ...interface{}) {}
+func (c *MockContext) Debug(args ...interface{}) {
+	c.logger.record(DebugLevel, c.fields, sprintln(args...), args)
+}
 
 // Debugf inside mock logger
-func (c *MockContext) Debugf(format string, args ...interface{}) {}
+func (c *MockContext) Debugf(format string, args ...interface{}) {
+	c.logger.record(DebugLevel, c.fields, fmt.Sprintf(format, args...), args)
+}
 
 // Info inside mock logger
-func (c *MockContext) Info(args ...interface{}) {}
+func (c *MockContext) Info(args ...interface{}) {
+	c.logger.record(InfoLevel, c.fields, sprintln(args...), args)
+}
 
 // Infof inside mock logger
-func (c *MockContext) Infof(format string, args ...interface{}) {}
+func (c *MockContext) Infof(format string, args ...interface{}) {
+	c.logger.record(InfoLevel, c.fields, fmt.Sprintf(format, args...), args)
+}
 
 // Warn inside mock logger
-func (c *MockContext) Warn(args ...interface{}) {}
+func (c *MockContext) Warn(args ...interface{}) {
+	c.logger.record(WarnLevel, c.fields, sprintln(args...), args)
+}
 
 // Warnf inside mock logger
-func (c *MockContext) Warnf(format string, args ...interface{}) {}
+func (c *MockContext) Warnf(format string, args ...interface{}) {
+	c.logger.record(WarnLevel, c.fields, fmt.Sprintf(format, args...), args)
+}
 
 // Error inside mock logger
-func (c *MockContext) Error(args ...interface{}) {}
+func (c *MockContext) Error(args ...interface{}) {
+	c.logger.record(ErrorLevel, c.fields, sprintln(args...), args)
+}
 
 // Errorf inside mock logger
-func (c *MockContext) Errorf(format string, args ...interface{}) {}
+func (c *MockContext) Errorf(format string, args ...interface{}) {
+	c.logger.record(ErrorLevel, c.fields, fmt.Sprintf(format, args...), args)
+}
 
-// Fatal inside mock logger
-func (c *MockContext) Fatal(args ...interface{}) {}
+// Fatal inside mock logger, which does not exit
+func (c *MockContext) Fatal(args ...interface{}) {
+	c.logger.record(FatalLevel, c.fields, sprintln(args...), args)
+}
 
-// Fatalf inside mock logger
-func (c *MockContext) Fatalf(format string, args ...interface{}) {}
+// Fatalf inside mock logger, which does not exit
+func (c *MockContext) Fatalf(format string, args ...interface{}) {
+	c.logger.record(FatalLevel, c.fields, fmt.Sprintf(format, args...), args)
+}
+
+// Panic inside mock logger
+func (c *MockContext) Panic(args ...interface{}) {
+	c.logger.record(PanicLevel, c.fields, sprintln(args...), args)
+}
+
+// Panicf inside mock logger
+func (c *MockContext) Panicf(format string, args ...interface{}) {
+	c.logger.record(PanicLevel, c.fields, fmt.Sprintf(format, args...), args)
+}
+
+// With inside mock logger
+func (c *MockContext) With(fields Fields) ContextualLogger {
+	f := Fields{}
+	for k, v := range c.fields {
+		f[k] = v
+	}
+	for k, v := range fields {
+		f[k] = v
+	}
+
+	return &MockContext{
+		fields: f,
+		logger: c.logger,
+	}
+}
+
+// WithError inside mock logger
+func (c *MockContext) WithError(err error) ContextualLogger {
+	return c.With(errorFields(err))
+}
@@ -0,0 +1,249 @@
+package logger
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces sensitive values in logged messages and fields.
+const Redacted = "[REDACTED]"
+
+// Patterns for RedactionSettings.Patterns matching common secrets in
+// messages.
+const (
+	// PatternBearerToken matches the credentials of an Authorization header
+	// such as "Bearer eyJhbGciOi...".
+	PatternBearerToken = `(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`
+	// PatternCardNumber matches payment card numbers of 13 to 19 digits,
+	// optionally grouped by spaces or dashes.
+	PatternCardNumber = `\b(?:\d[ -]?){12,18}\d\b`
+	// PatternEmail matches email addresses.
+	PatternEmail = `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`
+)
+
+// maxRedactDepth bounds how deep nested fields are redacted, in case a value
+// refers to itself.
+const maxRedactDepth = 16
+
+// DefaultRedactedFields lists field names that commonly hold secrets, for use
+// as RedactionSettings.Fields.
+var DefaultRedactedFields = []string{
+	"password", "passwd", "secret", "token", "accessToken", "refreshToken",
+	"apiKey", "authorization", "cookie",
+}
+
+// RedactionSettings masks sensitive data before it reaches the outputs.
+type RedactionSettings struct {
+	// Fields lists the names of fields whose values are replaced, compared
+	// case-insensitively. Fields nested in maps, slices and structs are
+	// redacted too; struct fields are named by their json tag.
+	Fields []string
+	// Patterns lists regular expressions, such as PatternBearerToken, whose
+	// matches are replaced in messages and string fields.
+	Patterns []string
+	// Replacement replaces redacted values. The default is Redacted.
+	Replacement string
+}
+
+// Sensitive wraps a value that must never be logged. It renders as Redacted
+// whichever way it is formatted or encoded.
+type Sensitive string
+
+// String returns Redacted.
+func (Sensitive) String() string { return Redacted }
+
+// GoString returns Redacted, so %#v does not reveal the value either.
+func (Sensitive) GoString() string { return Redacted }
+
+// Format writes Redacted for every verb.
+func (Sensitive) Format(f fmt.State, verb rune) { f.Write([]byte(Redacted)) }
+
+// MarshalJSON encodes Redacted as a JSON string.
+func (Sensitive) MarshalJSON() ([]byte, error) { return []byte(`"` + Redacted + `"`), nil }
+
+// MarshalText returns Redacted.
+func (Sensitive) MarshalText() ([]byte, error) { return []byte(Redacted), nil }
+
+// redactor masks the fields and patterns of RedactionSettings.
+type redactor struct {
+	fields      map[string]bool
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+// newRedactor compiles settings, returning nil when there is nothing to
+// redact.
+func newRedactor(settings RedactionSettings) (*redactor, error) {
+	if len(settings.Fields) == 0 && len(settings.Patterns) == 0 {
+		return nil, nil
+	}
+
+	r := &redactor{
+		fields:      make(map[string]bool, len(settings.Fields)),
+		replacement: settings.Replacement,
+	}
+	if r.replacement == "" {
+		r.replacement = Redacted
+	}
+	for _, name := range settings.Fields {
+		r.fields[strings.ToLower(name)] = true
+	}
+	for _, pattern := range settings.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, ErrLogInvalidPattern
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+// message replaces the patterns in msg.
+func (r *redactor) message(msg string) string {
+	for _, re := range r.patterns {
+		msg = re.ReplaceAllString(msg, r.replacement)
+	}
+	return msg
+}
+
+// redactFields replaces the values of the configured fields and the
+// patterns in the string values of data.
+func (r *redactor) redactFields(data Fields) {
+	for k, v := range data {
+		if redacted, changed := r.field(v, 0, k); changed {
+			data[k] = redacted
+		}
+	}
+}
+
+// values returns a copy of args with their sensitive parts replaced, or args
+// itself when nothing was replaced.
+func (r *redactor) values(args []interface{}) []interface{} {
+	var redacted []interface{}
+	for i, v := range args {
+		value, changed := r.value(v, 0)
+		if !changed {
+			continue
+		}
+		if redacted == nil {
+			redacted = append([]interface{}(nil), args...)
+		}
+		redacted[i] = value
+	}
+	if redacted == nil {
+		return args
+	}
+	return redacted
+}
+
+// field redacts the value v of the field named by one of names.
+func (r *redactor) field(v interface{}, depth int, names ...string) (interface{}, bool) {
+	for _, name := range names {
+		if r.fields[strings.ToLower(name)] {
+			return r.replacement, true
+		}
+	}
+	return r.value(v, depth)
+}
+
+// value returns v with its sensitive parts replaced and whether anything was
+// replaced. Nested maps, slices and structs are copied rather than modified.
+func (r *redactor) value(v interface{}, depth int) (interface{}, bool) {
+	switch s := v.(type) {
+	case nil:
+		return nil, false
+	case Sensitive:
+		return r.replacement, true
+	case string:
+		redacted := r.message(s)
+		return redacted, redacted != s
+	case error:
+		msg := s.Error()
+		if redacted := r.message(msg); redacted != msg {
+			return redacted, true
+		}
+		return v, false
+	case encoding.TextMarshaler:
+		return v, false
+	}
+	if depth >= maxRedactDepth {
+		return v, false
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return v, false
+		}
+		if redacted, changed := r.value(rv.Elem().Interface(), depth+1); changed {
+			return redacted, true
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return v, false
+		}
+		redacted := make(map[string]interface{}, rv.Len())
+		changed := false
+		for _, key := range rv.MapKeys() {
+			value, c := r.field(rv.MapIndex(key).Interface(), depth+1, key.String())
+			redacted[key.String()] = value
+			changed = changed || c
+		}
+		if changed {
+			return redacted, true
+		}
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return v, false
+		}
+		redacted := make([]interface{}, rv.Len())
+		changed := false
+		for i := range redacted {
+			value, c := r.value(rv.Index(i).Interface(), depth+1)
+			redacted[i] = value
+			changed = changed || c
+		}
+		if changed {
+			return redacted, true
+		}
+	case reflect.Struct:
+		return r.structValue(v, rv, depth)
+	}
+
+	return v, false
+}
+
+// structValue redacts the exported fields of a struct, which is returned as a
+// map keyed like encoding/json when any field changed. Fields match the
+// configured names by their json tag or their Go name.
+func (r *redactor) structValue(v interface{}, rv reflect.Value, depth int) (interface{}, bool) {
+	t := rv.Type()
+	redacted := make(map[string]interface{}, t.NumField())
+	changed := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		value, c := r.field(rv.Field(i).Interface(), depth+1, name, f.Name)
+		redacted[name] = value
+		changed = changed || c
+	}
+	if changed {
+		return redacted, true
+	}
+
+	return v, false
+}
@@ -0,0 +1,698 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Formats of the body a Remote output sends.
+const (
+	// RemoteNDJSON sends one JSON object per line.
+	RemoteNDJSON = "ndjson"
+	// RemoteElasticsearch sends a bulk request indexing every entry in Index.
+	RemoteElasticsearch = "elasticsearch"
+	// RemoteLoki sends a push request with a single stream labelled with
+	// Labels.
+	RemoteLoki = "loki"
+)
+
+// Remote is a type of output that ships entries in batches to an HTTP
+// endpoint or streams them to a TCP endpoint. Entries are encoded as JSON
+// objects like those of the Disk output. Failed batches are retried with
+// exponential backoff and, when SpoolDir is set, kept on disk until the
+// endpoint is reachable again.
+type Remote struct {
+	Level string
+	// URL is an http or https URL batches are POSTed to, or a tcp or tls URL
+	// such as tcp://logs.internal:5170 that JSON lines are streamed to.
+	URL string
+	// Format is RemoteNDJSON, RemoteElasticsearch or RemoteLoki. The default
+	// is RemoteNDJSON; TCP endpoints always receive JSON lines.
+	Format string
+	// Encoding is the format of each entry: FormatJSON, FormatECS or
+	// FormatGELF. The default is FormatJSON.
+	Encoding string
+	// Index is the Elasticsearch index. Without it the index in URL is used.
+	Index string
+	// Labels are the labels of the Loki stream. The default labels the
+	// stream with the name of the executable as app.
+	Labels map[string]string
+	// Headers are added to every request, for example for authentication.
+	Headers map[string]string
+	// Gzip compresses the bodies of HTTP requests.
+	Gzip bool
+	// TLS configures https and tls URLs.
+	TLS *tls.Config
+	// BatchSize is the number of entries sent at once. The default is 100.
+	BatchSize int
+	// FlushInterval sends incomplete batches. The default is 1 second.
+	FlushInterval time.Duration
+	// Timeout limits each request or connection attempt. The default is 10
+	// seconds.
+	Timeout time.Duration
+	// MaxRetries is the number of times a batch is retried. The default is 5;
+	// a negative value disables retries.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubling for each
+	// further retry up to MaxBackoff. The defaults are 100 milliseconds and
+	// 30 seconds.
+	RetryBackoff time.Duration
+	MaxBackoff   time.Duration
+	// SpoolDir keeps the batches that could not be sent, or did not fit in
+	// the queue of batches waiting to be sent, until the endpoint accepts a
+	// batch again. Without it such batches are discarded.
+	SpoolDir string
+	// MaxSpoolSize removes the oldest spooled batches beyond MaxSpoolSize
+	// bytes. Zero does not limit the spool.
+	MaxSpoolSize int64
+}
+
+type (
+	// remoteSink batches entries and hands the batches to a background
+	// sender.
+	remoteSink struct {
+		settings Remote
+		url      *url.URL
+		// formatter encodes entries in the Encoding.
+		formatter formatter
+		client    *http.Client
+
+		mu    sync.Mutex
+		lines []remoteLine
+
+		batches chan []remoteLine
+		// pending counts the batches queued or being sent; idle is signalled
+		// under mu once it drops to zero.
+		pending int
+		idle    *sync.Cond
+		// closed is set by Close, after which batches are no longer queued.
+		closed bool
+		// done stops tick and stopped is closed once run returned.
+		done    chan struct{}
+		stopped chan struct{}
+
+		// conn is the connection to a TCP endpoint, used by the sender only.
+		conn net.Conn
+		// spoolSeq tells apart batches spooled in the same nanosecond.
+		spoolSeq uint64
+	}
+
+	// remoteLine is an entry encoded as JSON.
+	remoteLine struct {
+		time time.Time
+		data []byte
+	}
+
+	// remoteStatusError is a response with an unsuccessful status.
+	remoteStatusError struct {
+		code int
+	}
+
+	// remoteBulkError is an Elasticsearch bulk response in which some items
+	// failed.
+	remoteBulkError struct {
+		// retry are the entries whose items failed temporarily.
+		retry []remoteLine
+		// rejected is the number of entries which can not be indexed.
+		rejected int
+		// reason is the error of the first failed item.
+		reason string
+	}
+
+	// bulkResponse is the part of an Elasticsearch bulk response reporting
+	// failed items.
+	bulkResponse struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+)
+
+// remoteQueueSize is the number of batches waiting to be sent before further
+// batches are spooled or discarded.
+const remoteQueueSize = 16
+
+func newRemoteSink(settings Remote, global Settings) (*remoteSink, error) {
+	u, err := url.Parse(settings.URL)
+	if err != nil {
+		return nil, ErrLogInvalidURL
+	}
+	switch u.Scheme {
+	case "http", "https", "tcp", "tls":
+	default:
+		return nil, ErrLogInvalidURL
+	}
+	switch settings.Format {
+	case "":
+		settings.Format = RemoteNDJSON
+	case RemoteNDJSON, RemoteElasticsearch, RemoteLoki:
+	default:
+		return nil, ErrLogInvalidRemoteFormat
+	}
+
+	if settings.Labels == nil {
+		settings.Labels = map[string]string{"app": filepath.Base(os.Args[0])}
+	}
+	if settings.BatchSize <= 0 {
+		settings.BatchSize = 100
+	}
+	if settings.FlushInterval <= 0 {
+		settings.FlushInterval = time.Second
+	}
+	if settings.Timeout <= 0 {
+		settings.Timeout = 10 * time.Second
+	}
+	if settings.MaxRetries == 0 {
+		settings.MaxRetries = 5
+	}
+	if settings.RetryBackoff <= 0 {
+		settings.RetryBackoff = 100 * time.Millisecond
+	}
+	if settings.MaxBackoff <= 0 {
+		settings.MaxBackoff = 30 * time.Second
+	}
+	if settings.SpoolDir != "" {
+		if err := os.MkdirAll(settings.SpoolDir, 0755); err != nil {
+			return nil, ErrLogInvalidPath
+		}
+	}
+
+	switch settings.Encoding {
+	case "", FormatJSON, FormatECS, FormatGELF:
+	default:
+		return nil, ErrLogInvalidFormat
+	}
+	formatter, err := newFormatter(settings.Encoding, FormatJSON, "", global, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &remoteSink{
+		settings:  settings,
+		url:       u,
+		formatter: formatter,
+		client: &http.Client{
+			Timeout:   settings.Timeout,
+			Transport: &http.Transport{TLSClientConfig: settings.TLS, Proxy: http.ProxyFromEnvironment},
+		},
+		batches: make(chan []remoteLine, remoteQueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	s.idle = sync.NewCond(&s.mu)
+
+	go s.run()
+	go s.tick()
+
+	return s, nil
+}
+
+func (s *remoteSink) Write(entry Entry) error {
+	b, err := s.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrLogClosed
+	}
+	s.lines = append(s.lines, remoteLine{time: entry.Time, data: bytes.TrimRight(b, "\n")})
+	if len(s.lines) >= s.settings.BatchSize {
+		s.enqueue()
+	}
+	return nil
+}
+
+// Flush queues the incomplete batch and waits until every queued batch has
+// been sent, spooled or discarded.
+func (s *remoteSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enqueue()
+	for s.pending > 0 {
+		s.idle.Wait()
+	}
+	return nil
+}
+
+// Close sends the buffered entries and stops the background sender. Entries
+// written afterwards are rejected with ErrLogClosed.
+func (s *remoteSink) Close() error {
+	s.Flush()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	close(s.batches)
+	s.mu.Unlock()
+
+	<-s.stopped
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return nil
+}
+
+// enqueue hands the buffered lines to the sender, spooling or discarding
+// them if the queue is full. The caller holds mu.
+func (s *remoteSink) enqueue() {
+	if len(s.lines) == 0 || s.closed {
+		return
+	}
+	batch := s.lines
+	s.lines = nil
+
+	select {
+	case s.batches <- batch:
+		s.pending++
+	default:
+		s.keep(batch, ErrLogRemoteBacklog)
+	}
+}
+
+// tick sends incomplete batches every FlushInterval and, when batches are
+// spooled, gives the sender the chance to send them. It returns on Close.
+func (s *remoteSink) tick() {
+	ticker := time.NewTicker(s.settings.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		if len(s.lines) > 0 {
+			s.enqueue()
+		} else if s.settings.SpoolDir != "" && !s.closed {
+			// An empty batch only resends the spool.
+			select {
+			case s.batches <- []remoteLine{}:
+				s.pending++
+			default:
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// run sends queued batches one at a time until Close. After a batch was sent
+// the spooled batches are resent.
+func (s *remoteSink) run() {
+	defer close(s.stopped)
+
+	for batch := range s.batches {
+		if len(batch) == 0 {
+			s.resend()
+		} else if remaining, err := s.deliver(batch); err != nil {
+			if rejected(err) {
+				reportWriteError(err)
+			} else {
+				s.keep(remaining, err)
+			}
+		} else {
+			s.resend()
+		}
+
+		s.mu.Lock()
+		if s.pending--; s.pending == 0 {
+			s.idle.Broadcast()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// deliver sends batch, retrying failures other than rejected requests with
+// exponential backoff. Entries Elasticsearch rejects are reported and only
+// those that failed temporarily are retried. It returns the entries that
+// could not be sent together with the error.
+func (s *remoteSink) deliver(batch []remoteLine) ([]remoteLine, error) {
+	backoff := s.settings.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.send(batch)
+		if bulk, ok := err.(remoteBulkError); ok {
+			bulk.report()
+			if len(bulk.retry) == 0 {
+				return nil, nil
+			}
+			batch = bulk.retry
+		}
+		if err == nil || attempt >= s.settings.MaxRetries || rejected(err) {
+			return batch, err
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > s.settings.MaxBackoff {
+			backoff = s.settings.MaxBackoff
+		}
+	}
+}
+
+// send makes a single attempt to send batch.
+func (s *remoteSink) send(batch []remoteLine) error {
+	if s.url.Scheme == "tcp" || s.url.Scheme == "tls" {
+		return s.stream(batch)
+	}
+
+	body, contentType, err := s.encode(batch)
+	if err != nil {
+		return err
+	}
+
+	var compressed bytes.Buffer
+	if s.settings.Gzip {
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(body)
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		body = compressed.Bytes()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.settings.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range s.settings.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return remoteStatusError{code: resp.StatusCode}
+	}
+	if s.settings.Format == RemoteElasticsearch {
+		return bulkFailures(batch, resp.Body)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// bulkFailures reads an Elasticsearch bulk response to batch and returns a
+// remoteBulkError if any of its items failed.
+func bulkFailures(batch []remoteLine, body io.Reader) error {
+	var resp bulkResponse
+	if err := json.NewDecoder(body).Decode(&resp); err == io.EOF {
+		// An empty response reports no failed items.
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read the bulk response, %v", err)
+	}
+	if !resp.Errors {
+		return nil
+	}
+
+	var e remoteBulkError
+	for i, item := range resp.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status <= 299 || i >= len(batch) {
+				continue
+			}
+			if rejected(remoteStatusError{code: result.Status}) {
+				e.rejected++
+			} else {
+				e.retry = append(e.retry, batch[i])
+			}
+			if e.reason == "" {
+				e.reason = string(result.Error)
+			}
+		}
+	}
+	if e.rejected == 0 && len(e.retry) == 0 {
+		return nil
+	}
+	return e
+}
+
+// stream writes batch as JSON lines to the TCP endpoint, reconnecting if
+// needed.
+func (s *remoteSink) stream(batch []remoteLine) error {
+	if s.conn == nil {
+		dialer := &net.Dialer{Timeout: s.settings.Timeout}
+		var conn net.Conn
+		var err error
+		if s.url.Scheme == "tls" {
+			conn, err = tls.DialWithDialer(dialer, "tcp", s.url.Host, s.settings.TLS)
+		} else {
+			conn, err = dialer.Dial("tcp", s.url.Host)
+		}
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	var b bytes.Buffer
+	for _, line := range batch {
+		b.Write(line.data)
+		b.WriteByte('\n')
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.settings.Timeout))
+	if _, err := s.conn.Write(b.Bytes()); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// encode returns the body of an HTTP request for batch and its content
+// type.
+func (s *remoteSink) encode(batch []remoteLine) ([]byte, string, error) {
+	var b bytes.Buffer
+
+	switch s.settings.Format {
+	case RemoteElasticsearch:
+		action := []byte(`{"index":{}}`)
+		if s.settings.Index != "" {
+			action, _ = json.Marshal(map[string]interface{}{"index": map[string]string{"_index": s.settings.Index}})
+		}
+		for _, line := range batch {
+			b.Write(action)
+			b.WriteByte('\n')
+			b.Write(line.data)
+			b.WriteByte('\n')
+		}
+		return b.Bytes(), "application/x-ndjson", nil
+
+	case RemoteLoki:
+		values := make([][2]string, len(batch))
+		for i, line := range batch {
+			values[i] = [2]string{strconv.FormatInt(line.time.UnixNano(), 10), string(line.data)}
+		}
+		body, err := json.Marshal(map[string]interface{}{
+			"streams": []interface{}{
+				map[string]interface{}{"stream": s.settings.Labels, "values": values},
+			},
+		})
+		return body, "application/json", err
+
+	default:
+		for _, line := range batch {
+			b.Write(line.data)
+			b.WriteByte('\n')
+		}
+		return b.Bytes(), "application/x-ndjson", nil
+	}
+}
+
+// keep spools batch, or reports err and discards it when there is no spool.
+func (s *remoteSink) keep(batch []remoteLine, err error) {
+	if s.settings.SpoolDir == "" {
+		reportWriteError(fmt.Errorf("%v; discarded %d entries", err, len(batch)))
+		return
+	}
+	if err := s.spool(batch); err != nil {
+		reportWriteError(err)
+	}
+}
+
+// spool writes batch to a new file in SpoolDir, one line per entry preceded
+// by its time in nanoseconds, and enforces MaxSpoolSize.
+func (s *remoteSink) spool(batch []remoteLine) error {
+	var b bytes.Buffer
+	for _, line := range batch {
+		b.WriteString(strconv.FormatInt(line.time.UnixNano(), 10) + " ")
+		b.Write(line.data)
+		b.WriteByte('\n')
+	}
+
+	seq := atomic.AddUint64(&s.spoolSeq, 1)
+	name := fmt.Sprintf("%020d-%06d.spool", time.Now().UnixNano(), seq%1000000)
+
+	path := filepath.Join(s.settings.SpoolDir, name)
+	if err := ioutil.WriteFile(path+".tmp", b.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	if s.settings.MaxSpoolSize <= 0 {
+		return nil
+	}
+	files, err := s.spooled()
+	if err != nil {
+		return err
+	}
+	var size int64
+	for i := len(files) - 1; i >= 0; i-- {
+		if size += files[i].Size(); size > s.settings.MaxSpoolSize {
+			os.Remove(filepath.Join(s.settings.SpoolDir, files[i].Name()))
+		}
+	}
+	return nil
+}
+
+// resend sends the spooled batches, oldest first, until one fails.
+func (s *remoteSink) resend() {
+	if s.settings.SpoolDir == "" {
+		return
+	}
+	files, err := s.spooled()
+	if err != nil {
+		reportWriteError(err)
+		return
+	}
+
+	for _, f := range files {
+		path := filepath.Join(s.settings.SpoolDir, f.Name())
+		batch, err := readSpool(path)
+		if err != nil {
+			reportWriteError(err)
+			os.Remove(path)
+			continue
+		}
+
+		if err := s.send(batch); err != nil {
+			if bulk, ok := err.(remoteBulkError); ok {
+				bulk.report()
+				if len(bulk.retry) > 0 {
+					// Keep the entries that failed temporarily for the next
+					// attempt.
+					if err := s.spool(bulk.retry); err != nil {
+						reportWriteError(err)
+					}
+					os.Remove(path)
+					return
+				}
+			} else if !rejected(err) {
+				return
+			} else {
+				reportWriteError(err)
+			}
+		}
+		os.Remove(path)
+	}
+}
+
+// spooled returns the spooled batches, oldest first.
+func (s *remoteSink) spooled() ([]os.FileInfo, error) {
+	files, err := ioutil.ReadDir(s.settings.SpoolDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var spooled []os.FileInfo
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".spool") {
+			spooled = append(spooled, f)
+		}
+	}
+	sort.Slice(spooled, func(i, j int) bool { return spooled[i].Name() < spooled[j].Name() })
+
+	return spooled, nil
+}
+
+// readSpool reads a batch written by spool.
+func readSpool(path string) ([]remoteLine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var batch []remoteLine
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		nanos, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		batch = append(batch, remoteLine{time: time.Unix(0, nanos), data: []byte(parts[1])})
+	}
+
+	return batch, scanner.Err()
+}
+
+func (e remoteStatusError) Error() string {
+	return "remote log endpoint responded with " + strconv.Itoa(e.code) + " " + http.StatusText(e.code)
+}
+
+func (e remoteBulkError) Error() string {
+	return fmt.Sprintf("elasticsearch failed to index %d entries, %s", e.rejected+len(e.retry), e.reason)
+}
+
+// report reports the entries Elasticsearch rejected, which are discarded.
+func (e remoteBulkError) report() {
+	if e.rejected > 0 {
+		reportWriteError(fmt.Errorf("elasticsearch rejected %d entries, %s; discarded %d entries", e.rejected, e.reason, e.rejected))
+	}
+}
+
+// rejected reports whether err is a response the request cannot succeed
+// after when repeated. Server errors, timeouts and requests to slow down are
+// retried.
+func rejected(err error) bool {
+	e, ok := err.(remoteStatusError)
+	if !ok {
+		return false
+	}
+	return e.code < 500 && e.code != http.StatusRequestTimeout && e.code != http.StatusTooManyRequests
+}
@@ -0,0 +1,328 @@
+package logger
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp inserted into the names of rotated files,
+// app.log becomes app-2006-01-02T15-04-05.000.log.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+type (
+	// rotatingFile is an io.Writer over the file of a Disk output which
+	// rotates it by size and time and prunes the rotated files. Rotated files
+	// are compressed and pruned in the background, one pass at a time.
+	rotatingFile struct {
+		mu       sync.Mutex
+		settings Disk
+		file     *os.File
+		size     int64
+		// rotateAt is the end of the current RotateEvery period.
+		rotateAt time.Time
+
+		// pending counts the background passes not yet finished, guarded by
+		// mu and signalled on milled.
+		pending int
+		milled  *sync.Cond
+		// milling serialises the background passes.
+		milling sync.Mutex
+		// stop stops reopening on SIGHUP, it is nil unless ReopenOnSIGHUP is
+		// set.
+		stop func()
+		// closed is set by Close.
+		closed bool
+	}
+
+	// backup is a rotated file and the time it was rotated.
+	backup struct {
+		path    string
+		rotated time.Time
+	}
+)
+
+// openRotatingFile opens the file of settings for appending.
+func openRotatingFile(settings Disk) (*rotatingFile, error) {
+	r := &rotatingFile{settings: settings}
+	r.milled = sync.NewCond(&r.mu)
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// open opens the configured path, continuing an existing file. The caller
+// holds mu or has exclusive access.
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.settings.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file = f
+	r.size = info.Size()
+	if every := r.settings.RotateEvery; every > 0 {
+		// An existing file written in an earlier period is rotated on the
+		// first write.
+		started := info.ModTime()
+		if info.Size() == 0 {
+			started = time.Now()
+		}
+		r.rotateAt = started.UTC().Truncate(every).Add(every)
+	}
+
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would take it beyond
+// MaxSize or the RotateEvery period has ended.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return 0, ErrLogClosed
+	}
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	bySize := r.settings.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.settings.MaxSize
+	byTime := r.settings.RotateEvery > 0 && !time.Now().Before(r.rotateAt)
+	if bySize || byTime {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+
+	return n, err
+}
+
+// rotate renames the current file with a timestamp, opens a new one and
+// starts a background pass to compress and prune backups. The caller holds
+// mu.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	r.file = nil
+
+	// Rotations within the same millisecond move the timestamp forward so no
+	// backup is overwritten.
+	rotated := time.Now()
+	for {
+		name := backupName(r.settings.Path, rotated)
+		_, err := os.Stat(name)
+		_, gzErr := os.Stat(name + ".gz")
+		if os.IsNotExist(err) && os.IsNotExist(gzErr) {
+			break
+		}
+		rotated = rotated.Add(time.Millisecond)
+	}
+	if err := os.Rename(r.settings.Path, backupName(r.settings.Path, rotated)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	r.pending++
+	go func() {
+		r.milling.Lock()
+		if err := r.millBackups(); err != nil {
+			reportWriteError(err)
+		}
+		r.milling.Unlock()
+
+		r.mu.Lock()
+		r.pending--
+		r.milled.Broadcast()
+		r.mu.Unlock()
+	}()
+
+	return nil
+}
+
+// Reopen closes and reopens the file at the configured path. It is used
+// after an external tool such as logrotate moved the file.
+func (r *rotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrLogClosed
+	}
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+
+	return r.open()
+}
+
+// Flush syncs the file to disk and waits for background compression and
+// pruning to finish.
+func (r *rotatingFile) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var err error
+	if r.file != nil {
+		err = r.file.Sync()
+	}
+	for r.pending > 0 {
+		r.milled.Wait()
+	}
+
+	return err
+}
+
+// Close stops reopening on SIGHUP, waits for background compression and
+// pruning to finish and closes the file.
+func (r *rotatingFile) Close() error {
+	if r.stop != nil {
+		r.stop()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	for r.pending > 0 {
+		r.milled.Wait()
+	}
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+
+	return err
+}
+
+// millBackups compresses rotated files and removes those beyond MaxBackups
+// or older than MaxAge.
+func (r *rotatingFile) millBackups() error {
+	backups, err := r.backups()
+	if err != nil {
+		return err
+	}
+
+	var keep []backup
+	for i, b := range backups {
+		expired := r.settings.MaxAge > 0 && time.Since(b.rotated) > r.settings.MaxAge
+		excess := r.settings.MaxBackups > 0 && i >= r.settings.MaxBackups
+		if expired || excess {
+			if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		keep = append(keep, b)
+	}
+
+	if !r.settings.Compress {
+		return nil
+	}
+	for _, b := range keep {
+		if strings.HasSuffix(b.path, ".gz") {
+			continue
+		}
+		if err := compressFile(b.path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backups returns the rotated files of the output, newest first.
+func (r *rotatingFile) backups() ([]backup, error) {
+	dir := filepath.Dir(r.settings.Path)
+	prefix, ext := backupPrefixAndExt(r.settings.Path)
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backup
+	for _, f := range files {
+		name := strings.TrimSuffix(f.Name(), ".gz")
+		if f.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		rotated, err := time.Parse(backupTimeFormat, name[len(prefix):len(name)-len(ext)])
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, f.Name()), rotated: rotated})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].rotated.After(backups[j].rotated) })
+
+	return backups, nil
+}
+
+// backupName returns the name path is rotated to at t.
+func backupName(path string, t time.Time) string {
+	prefix, ext := backupPrefixAndExt(path)
+	return filepath.Join(filepath.Dir(path), prefix+t.UTC().Format(backupTimeFormat)+ext)
+}
+
+// backupPrefixAndExt splits the base name of path around the timestamp of
+// its backups: "app-" and ".log" for app.log.
+func backupPrefixAndExt(path string) (string, string) {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + "-", ext
+}
+
+// compressFile gzips path to path.gz and removes path.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package logger
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// reopenOnSIGHUP reopens the file whenever the process receives SIGHUP, the
+// signal logrotate and similar tools send after moving a log file, until the
+// file is closed.
+func reopenOnSIGHUP(r *rotatingFile) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	done := make(chan struct{})
+	var once sync.Once
+	r.stop = func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+
+	go func() {
+		for {
+			select {
+			case <-signals:
+				if err := r.Reopen(); err != nil && err != ErrLogClosed {
+					reportWriteError(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,4 @@
+package logger
+
+// reopenOnSIGHUP does nothing as Windows has no SIGHUP.
+func reopenOnSIGHUP(r *rotatingFile) {}
@@ -0,0 +1,235 @@
+package logger
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// SamplingSettings limits how often the same message is logged. Messages
+	// are the same when their level, module and text match; fields are not
+	// compared. Fatal and Panic messages are never sampled or deduplicated.
+	SamplingSettings struct {
+		// Levels maps a level name, such as "debug", to the sampling of
+		// messages at that level.
+		Levels map[string]Sampling
+		// Modules maps a named logger to the sampling of its messages by level
+		// name. Like Settings.Modules, the closest module applies and its
+		// rules replace those of Levels.
+		Modules map[string]map[string]Sampling
+		// DedupInterval collapses a message repeated back to back within the
+		// interval into the first occurrence and a summary such as
+		// "Evaluating static route (repeated 41 times)". Zero disables
+		// deduplication.
+		DedupInterval time.Duration
+	}
+
+	// Sampling logs the First messages of each Interval and then every
+	// Thereafter-th one. A zero Thereafter discards the rest of the interval.
+	Sampling struct {
+		Interval   time.Duration
+		First      int
+		Thereafter int
+	}
+
+	// sampler applies SamplingSettings for a Log and its named loggers.
+	sampler struct {
+		settings SamplingSettings
+
+		mu sync.Mutex
+		// counts holds the number of times each message was seen in the
+		// current interval of its rule.
+		counts map[string]*sampleCount
+
+		// dedup is the message currently being deduplicated.
+		dedup struct {
+			key      string
+			until    time.Time
+			entry    Entry
+			repeated int
+			window   uint64
+		}
+	}
+
+	sampleCount struct {
+		n       int
+		resetAt time.Time
+	}
+)
+
+func newSampler(settings SamplingSettings) (*sampler, error) {
+	if err := validateSampling(settings.Levels); err != nil {
+		return nil, err
+	}
+	for _, rules := range settings.Modules {
+		if err := validateSampling(rules); err != nil {
+			return nil, err
+		}
+	}
+
+	return &sampler{
+		settings: settings,
+		counts:   make(map[string]*sampleCount),
+	}, nil
+}
+
+// validateSampling checks sampling rules keyed by level name.
+func validateSampling(rules map[string]Sampling) error {
+	for level, rule := range rules {
+		if err := ValidateLevel(level); err != nil {
+			return err
+		}
+		if rule.Interval <= 0 || rule.First < 0 || rule.Thereafter < 0 {
+			return ErrLogInvalidSampling
+		}
+	}
+	return nil
+}
+
+// rule returns the sampling for messages of module at level.
+func (s *sampler) rule(module string, level Level) (Sampling, bool) {
+	for name := module; name != ""; {
+		if levels, ok := s.settings.Modules[name]; ok {
+			rule, ok := levels[level.String()]
+			return rule, ok
+		}
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+
+	rule, ok := s.settings.Levels[level.String()]
+	return rule, ok
+}
+
+// sample reports whether the message with key should be logged under its
+// rule.
+func (s *sampler) sample(key string, module string, level Level, now time.Time) bool {
+	rule, ok := s.rule(module, level)
+	if !ok {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counts[key]
+	if !ok || !now.Before(c.resetAt) {
+		c = &sampleCount{resetAt: now.Add(rule.Interval)}
+		s.counts[key] = c
+		s.prune(now)
+	}
+	c.n++
+
+	if c.n <= rule.First {
+		return true
+	}
+	return rule.Thereafter > 0 && (c.n-rule.First)%rule.Thereafter == 0
+}
+
+// prune forgets the counts of messages whose interval ended so the map does
+// not grow with every distinct message. The caller holds mu.
+func (s *sampler) prune(now time.Time) {
+	if len(s.counts) < 1024 {
+		return
+	}
+	for key, c := range s.counts {
+		if !now.Before(c.resetAt) {
+			delete(s.counts, key)
+		}
+	}
+}
+
+// deduplicate reports whether entry repeats the message being deduplicated
+// and must be suppressed. It returns the summary of the previous message to
+// log first, if any. emit is called with the summary once the interval of a
+// suppressed message ends.
+func (s *sampler) deduplicate(key string, entry Entry, emit func(Entry)) (bool, *Entry) {
+	interval := s.settings.DedupInterval
+	if interval <= 0 {
+		return false, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d := &s.dedup
+	if key == d.key && entry.Time.Before(d.until) {
+		d.repeated++
+		if d.repeated == 1 {
+			window := d.window
+			time.AfterFunc(d.until.Sub(entry.Time), func() {
+				if summary := s.endWindow(window); summary != nil {
+					emit(*summary)
+				}
+			})
+		}
+		return true, nil
+	}
+
+	summary := s.summary()
+	d.window++
+	d.key = key
+	d.until = entry.Time.Add(interval)
+	d.entry = entry
+	d.repeated = 0
+
+	return false, summary
+}
+
+// endWindow ends the deduplication window and returns its summary, unless a
+// different message already ended it.
+func (s *sampler) endWindow(window uint64) *Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dedup.window != window {
+		return nil
+	}
+	summary := s.summary()
+	s.dedup.key = ""
+	s.dedup.window++
+
+	return summary
+}
+
+// flush ends the deduplication window and returns its summary.
+func (s *sampler) flush() *Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := s.summary()
+	s.dedup.key = ""
+	s.dedup.window++
+
+	return summary
+}
+
+// summary returns the entry reporting how often the deduplicated message
+// repeated, or nil. The caller holds mu.
+func (s *sampler) summary() *Entry {
+	d := &s.dedup
+	if d.repeated == 0 {
+		return nil
+	}
+
+	fields := make(Fields, len(d.entry.Fields)+1)
+	for k, v := range d.entry.Fields {
+		fields[k] = v
+	}
+	fields["repeated"] = d.repeated
+
+	summary := Entry{
+		Time:    time.Now(),
+		Level:   d.entry.Level,
+		Message: d.entry.Message + " (repeated " + strconv.Itoa(d.repeated) + " times)",
+		Fields:  fields,
+	}
+	d.repeated = 0
+
+	return &summary
+}
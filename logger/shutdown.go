@@ -0,0 +1,116 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// DefaultShutdownTimeout bounds how long the shutdown hooks may run before a
+// Fatal message exits the process.
+const DefaultShutdownTimeout = 10 * time.Second
+
+// ShutdownHook stops part of the application before the process exits, such
+// as webserver.Server.Shutdown. The context is done once the shutdown timeout
+// passes.
+type ShutdownHook func(ctx context.Context) error
+
+// Shutdowner is implemented by loggers that run shutdown hooks before a
+// Fatal message exits the process.
+type Shutdowner interface {
+	// OnShutdown registers hook to run on Shutdown. Hooks run in the reverse
+	// order of their registration.
+	OnShutdown(hook ShutdownHook)
+	// Shutdown runs the registered hooks and flushes the outputs.
+	Shutdown()
+}
+
+// lifecycle holds the exit handler and shutdown hooks shared by a Log and its
+// named loggers.
+type lifecycle struct {
+	sync.Mutex
+	hooks   []ShutdownHook
+	exit    func(code int)
+	timeout time.Duration
+	// closed is set by Close.
+	closed bool
+}
+
+func newLifecycle(exit func(code int), timeout time.Duration) *lifecycle {
+	if exit == nil {
+		exit = logrus.Exit
+	}
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	return &lifecycle{exit: exit, timeout: timeout}
+}
+
+// OnShutdown registers hook to run when the process exits after a Fatal
+// message or when Shutdown is called. Hooks run once, in the reverse order of
+// their registration, and share the ShutdownTimeout.
+func (l *Log) OnShutdown(hook ShutdownHook) {
+	l.lifecycle.Lock()
+	defer l.lifecycle.Unlock()
+	l.lifecycle.hooks = append(l.lifecycle.hooks, hook)
+}
+
+// Shutdown runs the shutdown hooks, logging the errors they return, and then
+// flushes every output. Call it before the application exits normally.
+func (l *Log) Shutdown() {
+	l.lifecycle.Lock()
+	hooks := l.lifecycle.hooks
+	l.lifecycle.hooks = nil
+	l.lifecycle.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.lifecycle.timeout)
+	defer cancel()
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if err := hooks[i](ctx); err != nil {
+			l.WithError(err).Error("Shutdown hook failed")
+		}
+	}
+
+	l.Flush()
+}
+
+// Close flushes every output and stops the goroutines working in the
+// background for the Log, such as the asynchronous writers and the senders of
+// Remote outputs. Outputs that
+// implement io.Closer, including Sinks, are closed. Close returns the first
+// error of the outputs; the Log and its named loggers must not be used
+// afterwards.
+func (l *Log) Close() error {
+	l.lifecycle.Lock()
+	closed := l.lifecycle.closed
+	l.lifecycle.closed = true
+	l.lifecycle.Unlock()
+	if closed {
+		return nil
+	}
+
+	if l.queue != nil {
+		l.queue.stop()
+	}
+	l.Flush()
+
+	var first error
+	for _, o := range l.outputs {
+		if c, ok := o.sink.(io.Closer); ok {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// exit shuts down and exits the process with code through the exit handler.
+func (l *Log) exit(code int) {
+	l.Shutdown()
+	l.lifecycle.exit(code)
+}
@@ -0,0 +1,249 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/sebest/logrusly"
+)
+
+// Entry is a message as it is handed to a Sink. Fields holds the context of
+// the message, including the module of named loggers and, at the debug level,
+// the caller.
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  Fields
+}
+
+// Sink is a destination for log entries. Teams can implement it to log to
+// destinations this package does not provide and pass it in
+// Settings.Outputs, either directly or in a SinkOutput to give it a level.
+// Write is called concurrently and must not modify the entry's Fields, which
+// are shared by every output. Sinks that also implement io.Closer are closed
+// by Log.Close.
+type Sink interface {
+	Write(entry Entry) error
+	Flush() error
+}
+
+// SinkOutput is a type of output that writes to a Sink.
+type SinkOutput struct {
+	Sink  Sink
+	Level string
+}
+
+type (
+	// output is a Sink together with the most verbose level it receives.
+	output struct {
+		sink  Sink
+		level Level
+	}
+
+	// writerSink formats entries with a formatter and writes them to an
+	// io.Writer.
+	writerSink struct {
+		sync.Mutex
+		out       io.Writer
+		formatter formatter
+		// closer closes out when the sink owns it, as it does the rotating
+		// file of a Disk output but not stdout.
+		closer io.Closer
+	}
+
+	// logglySink sends entries to Loggly and, like the logrus logger it
+	// replaces, writes them to stderr as JSON.
+	logglySink struct {
+		*writerSink
+		logger *logrus.Logger
+		hook   *logrusly.LogglyHook
+	}
+
+	discardSink struct{}
+)
+
+// newWriterSink returns a Sink writing to out in one of the formats, such as
+// FormatText. An empty format uses the default for the output and tmpl is the
+// template of FormatTemplate. Text is only coloured when colors is set.
+func newWriterSink(out io.Writer, format string, defaultFormat string, tmpl string, settings Settings, colors bool) (*writerSink, error) {
+	formatter, err := newFormatter(format, defaultFormat, tmpl, settings, out, colors)
+	if err != nil {
+		return nil, err
+	}
+
+	return &writerSink{out: out, formatter: formatter}, nil
+}
+
+func (s *writerSink) Write(entry Entry) error {
+	b, err := s.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	_, err = s.out.Write(b)
+	return err
+}
+
+// Flush flushes writers that buffer or work in the background, such as the
+// rotating file of a Disk output.
+func (s *writerSink) Flush() error {
+	if f, ok := s.out.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close closes the writer when the sink owns it, such as the rotating file of
+// a Disk output.
+func (s *writerSink) Close() error {
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
+
+func newLogglySink(settings LogglySettings, global Settings) (*logglySink, error) {
+	// Validate that the bare minimum of what is needed is present.
+	if settings.Token == "" && settings.Domain == "" {
+		return nil, ErrLogLogglySetup
+	}
+
+	text, err := newWriterSink(os.Stderr, FormatJSON, FormatJSON, "", global, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Levels are filtered before entries reach the hook so it accepts all of
+	// them.
+	hook := logrusly.NewLogglyHook(settings.Token, settings.Domain, logrus.DebugLevel)
+	for _, tag := range settings.Tags {
+		hook.Tag(tag)
+	}
+
+	return &logglySink{writerSink: text, logger: logrus.New(), hook: hook}, nil
+}
+
+func (s *logglySink) Write(entry Entry) error {
+	if err := s.hook.Fire(logrusEntry(s.logger, entry)); err != nil {
+		return err
+	}
+	return s.writerSink.Write(entry)
+}
+
+// Flush passes flush to the Loggly client, otherwise we lose up to 5 seconds
+// worth of data for messages that are not panic or fatal.
+func (s *logglySink) Flush() error {
+	s.hook.Flush()
+	return nil
+}
+
+func (discardSink) Write(Entry) error { return nil }
+
+func (discardSink) Flush() error { return nil }
+
+// logrusEntry converts entry for logrus formatters and hooks. logrus has no
+// trace level, so trace entries are written at debug and marked with a trace
+// field.
+func logrusEntry(l *logrus.Logger, entry Entry) *logrus.Entry {
+	data := make(logrus.Fields, len(entry.Fields)+1)
+	for k, v := range entry.Fields {
+		data[k] = v
+	}
+
+	level := logrus.Level(entry.Level)
+	if entry.Level == TraceLevel {
+		level = logrus.DebugLevel
+		data["trace"] = true
+	}
+
+	return &logrus.Entry{
+		Logger:  l,
+		Data:    data,
+		Time:    entry.Time,
+		Level:   level,
+		Message: entry.Message,
+	}
+}
+
+// newOutput returns the Sink described by one of the output types and the
+// level configured for it, which defaults to debug.
+func newOutput(o interface{}, settings Settings) (output, error) {
+	var sink Sink
+	var level string
+	var err error
+
+	switch v := o.(type) {
+	case LogglySettings:
+		sink, err = newLogglySink(v, settings)
+		level = v.Level
+	case Stderr:
+		sink, err = newWriterSink(os.Stderr, v.Format, FormatText, v.Template, settings, true)
+		level = v.Level
+	case Stdout:
+		sink, err = newWriterSink(os.Stdout, v.Format, FormatText, v.Template, settings, true)
+		level = v.Level
+	case Disk:
+		if v.Path == "" {
+			return output{}, ErrLogInvalidPath
+		}
+		f, openErr := openRotatingFile(v)
+		if openErr != nil {
+			return output{}, ErrLogInvalidPath
+		}
+		if v.ReopenOnSIGHUP {
+			reopenOnSIGHUP(f)
+		}
+		w, formatErr := newWriterSink(f, v.Format, FormatJSON, v.Template, settings, false)
+		if formatErr != nil {
+			f.Close()
+			return output{}, formatErr
+		}
+		w.closer = f
+		sink = w
+		level = v.Level
+	case Syslog:
+		sink, err = newSyslogSink(v)
+		level = v.Level
+	case Journald:
+		sink, err = newJournaldSink(v)
+		level = v.Level
+	case Remote:
+		sink, err = newRemoteSink(v, settings)
+		level = v.Level
+	case Stdiscard:
+		sink = discardSink{}
+	case SinkOutput:
+		sink = v.Sink
+		level = v.Level
+	case Sink:
+		sink = v
+	default:
+		return output{}, ErrLogInvalidType
+	}
+	if err != nil {
+		return output{}, err
+	}
+
+	parsed := DebugLevel
+	if level != "" {
+		if parsed, err = ParseLevel(level); err != nil {
+			return output{}, err
+		}
+	}
+
+	return output{sink: sink, level: parsed}, nil
+}
+
+// reportWriteError mirrors logrus, which reports failed writes on stderr as
+// there is nowhere else to log them.
+func reportWriteError(err error) {
+	fmt.Fprintf(os.Stderr, "Failed to write to log, %v\n", err)
+}
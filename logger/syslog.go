@@ -0,0 +1,261 @@
+package logger
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Syslog is a type of output that sends RFC 5424 messages to a syslog
+// server. Fields are sent as structured data.
+type Syslog struct {
+	Level string
+	// Network is udp, tcp, tls, unix or unixgram. The default is udp. Stream
+	// networks frame messages with their length as described in RFC 6587.
+	Network string
+	// Address is the host:port of the server or the path of its socket. The
+	// default is localhost:514, or /dev/log for the unix networks.
+	Address string
+	// TLS configures the tls network.
+	TLS *tls.Config
+	// Facility is a syslog facility such as user, daemon or local0. The
+	// default is user.
+	Facility string
+	// AppName identifies the application. The default is the name of the
+	// executable.
+	AppName string
+}
+
+// syslogFacilities maps the facility names of RFC 5424 to their codes.
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslogStructuredDataID names the structured data element holding the
+// fields. 32473 is the enterprise number reserved for documentation.
+const syslogStructuredDataID = "fields@32473"
+
+// syslogSink writes entries to a syslog server, reconnecting once when a
+// write over a stream connection fails.
+type syslogSink struct {
+	sync.Mutex
+	settings Syslog
+	facility int
+	hostname string
+	conn     net.Conn
+	// closed is set by Close.
+	closed bool
+}
+
+func newSyslogSink(settings Syslog) (*syslogSink, error) {
+	switch settings.Network {
+	case "":
+		settings.Network = "udp"
+	case "udp", "tcp", "tls", "unix", "unixgram":
+	default:
+		return nil, ErrLogInvalidNetwork
+	}
+	if settings.Address == "" {
+		settings.Address = "localhost:514"
+		if strings.HasPrefix(settings.Network, "unix") {
+			settings.Address = "/dev/log"
+		}
+	}
+	if settings.Facility == "" {
+		settings.Facility = "user"
+	}
+	facility, ok := syslogFacilities[settings.Facility]
+	if !ok {
+		return nil, ErrLogInvalidFacility
+	}
+	if settings.AppName == "" {
+		settings.AppName = filepath.Base(os.Args[0])
+	}
+
+	hostname, _ := os.Hostname()
+	s := &syslogSink{
+		settings: settings,
+		facility: facility,
+		hostname: syslogHeaderValue(hostname, 255),
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// connect dials the server. The caller holds the lock or has exclusive
+// access.
+func (s *syslogSink) connect() error {
+	var conn net.Conn
+	var err error
+
+	switch s.settings.Network {
+	case "tls":
+		conn, err = tls.Dial("tcp", s.settings.Address, s.settings.TLS)
+	default:
+		conn, err = net.Dial(s.settings.Network, s.settings.Address)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+	return nil
+}
+
+// stream reports whether messages are sent over a stream connection and
+// therefore need framing.
+func (s *syslogSink) stream() bool {
+	switch s.settings.Network {
+	case "tcp", "tls", "unix":
+		return true
+	}
+	return false
+}
+
+func (s *syslogSink) Write(entry Entry) error {
+	msg := s.format(entry)
+	if s.stream() {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.closed {
+		return ErrLogClosed
+	}
+	if s.conn != nil {
+		if _, err := s.conn.Write([]byte(msg)); err == nil || !s.stream() {
+			return err
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+	_, err := s.conn.Write([]byte(msg))
+	return err
+}
+
+func (s *syslogSink) Flush() error { return nil }
+
+// Close closes the connection to the server.
+func (s *syslogSink) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// format returns entry as an RFC 5424 message.
+func (s *syslogSink) format(entry Entry) string {
+	var b strings.Builder
+
+	priority := s.facility*8 + syslogSeverity(entry.Level)
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - ",
+		priority,
+		entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname,
+		syslogHeaderValue(s.settings.AppName, 48),
+		os.Getpid(),
+	)
+
+	if len(entry.Fields) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + syslogStructuredDataID)
+		keys := make([]string, 0, len(entry.Fields))
+		for k := range entry.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b.WriteString(" " + syslogParamName(k) + `="` + syslogParamValue(fmt.Sprint(entry.Fields[k])) + `"`)
+		}
+		b.WriteString("]")
+	}
+
+	if entry.Message != "" {
+		b.WriteString(" " + entry.Message)
+	}
+
+	return b.String()
+}
+
+// syslogSeverity maps a level to a syslog severity the way the logrus syslog
+// hook does. journald uses the same values for its priorities.
+func syslogSeverity(level Level) int {
+	switch level {
+	case PanicLevel, FatalLevel:
+		return 2 // critical
+	case ErrorLevel:
+		return 3 // error
+	case WarnLevel:
+		return 4 // warning
+	case InfoLevel:
+		return 6 // informational
+	default:
+		return 7 // debug
+	}
+}
+
+// syslogHeaderValue makes s a valid header field of at most max printable
+// characters, or "-" when it is empty.
+func syslogHeaderValue(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > max {
+		s = s[:max]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// syslogParamName makes k a valid structured data parameter name, which may
+// not contain '=', ' ', ']' or '"' and is at most 32 characters.
+func syslogParamName(k string) string {
+	k = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, k)
+	if len(k) > 32 {
+		k = k[:32]
+	}
+	if k == "" {
+		return "_"
+	}
+	return k
+}
+
+// syslogParamValue escapes '"', '\' and ']' in a parameter value.
+func syslogParamValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(v)
+}
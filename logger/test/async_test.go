@@ -0,0 +1,161 @@
+package test
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+// waitBuffered waits until the writer has taken the first entry and the
+// buffer holds n entries.
+func waitBuffered(t *testing.T, log *logger.Log, n int) {
+	deadline := time.Now().Add(time.Second)
+	for log.AsyncStats().Buffered != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d buffered entries, got %+v", n, log.AsyncStats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAsyncFlushDrains(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{
+		Async: logger.AsyncSettings{BufferSize: 4, Policy: logger.AsyncBlock},
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				log.Info("message")
+			}
+		}()
+	}
+	wg.Wait()
+	log.Flush()
+
+	if len(sink.entries) != 200 || !sink.flushed {
+		t.Errorf("Expected Flush to write all 200 entries and flush the sink, got %d", len(sink.entries))
+	}
+	if stats := log.AsyncStats(); len(stats.Dropped) != 0 {
+		t.Errorf("Expected the block policy to drop nothing, got %v", stats.Dropped)
+	}
+}
+
+func TestAsyncDropLowest(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{
+		Async: logger.AsyncSettings{BufferSize: 4, Policy: logger.AsyncDropLowest},
+	})
+	sink.gate = make(chan struct{})
+
+	log.Info("taken by the writer")
+	waitBuffered(t, log, 0)
+	log.Debug("debug 1")
+	log.Info("info 1")
+	log.Debug("debug 2")
+	log.Info("info 2")
+	// The buffer is full: the warning evicts the oldest debug entry and the
+	// trace entry, the least severe, is discarded.
+	log.Warn("warn")
+	log.Trace("trace")
+
+	close(sink.gate)
+	log.Flush()
+
+	var messages []string
+	for _, e := range sink.entries {
+		messages = append(messages, e.Message)
+	}
+	expected := []string{"taken by the writer", "info 1", "debug 2", "info 2", "warn"}
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, messages)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Fatalf("Expected %v, got %v", expected, messages)
+		}
+	}
+
+	dropped := log.AsyncStats().Dropped
+	if dropped["debug"] != 1 || dropped["trace"] != 1 {
+		t.Errorf("Expected one debug and one trace entry dropped, got %v", dropped)
+	}
+}
+
+func TestAsyncSample(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{
+		Async: logger.AsyncSettings{BufferSize: 4, Policy: logger.AsyncSample, SampleRate: 2},
+	})
+	sink.gate = make(chan struct{})
+
+	log.Info("taken by the writer")
+	waitBuffered(t, log, 0)
+	for i := 0; i < 4; i++ {
+		log.Info("fills the buffer")
+	}
+
+	// With a SampleRate of 2 the first overflowing entry is dropped and the
+	// second waits for space.
+	log.Info("dropped")
+	done := make(chan struct{})
+	go func() {
+		log.Info("sampled")
+		close(done)
+	}()
+
+	close(sink.gate)
+	<-done
+	log.Flush()
+
+	if len(sink.entries) != 6 || sink.entries[5].Message != "sampled" {
+		t.Errorf("Expected the sampled entry to be written last, got %d entries", len(sink.entries))
+	}
+	if log.AsyncStats().Dropped["info"] != 1 {
+		t.Errorf("Expected one info entry dropped, got %v", log.AsyncStats().Dropped)
+	}
+}
+
+func TestAsyncClose(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	log, sink := newSinkLog(t, logger.Settings{
+		Async: logger.AsyncSettings{BufferSize: 4, Writers: 4},
+	})
+	for i := 0; i < 20; i++ {
+		log.Info("message")
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.entries) != 20 {
+		t.Errorf("Expected Close to write all 20 entries, got %d", len(sink.entries))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected Close to stop the writers, %d goroutines left of %d", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	log.Info("after close")
+	if len(sink.entries) != 21 {
+		t.Errorf("Expected entries to be written synchronously after Close, got %d", len(sink.entries))
+	}
+}
+
+func TestAsyncInvalidPolicy(t *testing.T) {
+	_, err := logger.New(logger.Settings{
+		Output: logger.Stdiscard{},
+		Async:  logger.AsyncSettings{BufferSize: 1, Policy: "panic"},
+	})
+	if err != logger.ErrLogInvalidAsyncPolicy {
+		t.Errorf("Expected ErrLogInvalidAsyncPolicy, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+func TestWithChaining(t *testing.T) {
+	sink := &recordingSink{}
+	log, err := logger.New(logger.Settings{Output: logger.SinkOutput{Sink: sink, Level: "info"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := log.Context(logger.Fields{"requestId": "abc", "user": "anonymous"})
+	user := request.With(logger.Fields{"user": "alice"})
+	user.With(logger.Fields{"order": 7}).Info("Order placed")
+	request.Info("Request served")
+
+	if len(sink.entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(sink.entries))
+	}
+	placed := sink.entries[0].Fields
+	if placed["requestId"] != "abc" || placed["user"] != "alice" || placed["order"] != 7 {
+		t.Errorf("Expected the fields of every level of the chain, got %v", placed)
+	}
+	served := sink.entries[1].Fields
+	if served["user"] != "anonymous" || served["order"] != nil {
+		t.Errorf("Expected With not to change its parent, got %v", served)
+	}
+}
+
+func TestLoggerInContext(t *testing.T) {
+	log, err := logger.NewLogMock(logger.Settings{Output: logger.Stdout{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := logger.NewContext(context.Background(), log.Context(logger.Fields{"job": "import"}))
+	logger.FromContext(ctx).With(logger.Fields{"row": 3}).Warn("Skipped row")
+
+	if !log.HasEntry(logger.WarnLevel, "Skipped row", logger.Fields{"job": "import", "row": 3}) {
+		t.Errorf("Expected the logger stored in the context, got %v", log.Entries())
+	}
+
+	// Without a stored logger messages are discarded.
+	logger.FromContext(context.Background()).With(logger.Fields{"row": 4}).Error("Nowhere")
+}
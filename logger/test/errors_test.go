@@ -0,0 +1,109 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/localization"
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+// queryError is a custom error type wrapping its cause.
+type queryError struct {
+	query string
+	err   error
+}
+
+func (e *queryError) Error() string { return "query " + e.query + ": " + e.err.Error() }
+
+func (e *queryError) Unwrap() error { return e.err }
+
+func TestWithError(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{})
+
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("loading user: %w", &queryError{query: "SELECT", err: cause})
+	log.WithError(err).Warn("Falling back to the cache")
+
+	fields := sink.entries[0].Fields
+	if fields["error"] != "loading user: query SELECT: connection refused" {
+		t.Errorf("Expected the error message, got %v", fields["error"])
+	}
+	if fields["errorType"] != "*fmt.wrapError" {
+		t.Errorf("Expected the error type, got %v", fields["errorType"])
+	}
+	chain, _ := fields["errorChain"].([]string)
+	expected := []string{
+		"*fmt.wrapError: loading user: query SELECT: connection refused",
+		"*test.queryError: query SELECT: connection refused",
+		"*errors.errorString: connection refused",
+	}
+	if strings.Join(chain, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the unwrap chain %q, got %q", expected, chain)
+	}
+	if _, ok := fields["errorStack"]; ok {
+		t.Error("Expected no stack trace without a policy")
+	}
+	if _, ok := fields["errorLocalized"]; ok {
+		t.Error("Expected the error not to be localized")
+	}
+}
+
+func TestWithErrorChaining(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{})
+
+	joined := errors.Join(errors.New("disk full"), localization.NewError("Your upload is too large"))
+	log.Context(logger.Fields{"upload": "photo.jpg"}).WithError(joined).Error("Upload failed")
+
+	fields := sink.entries[0].Fields
+	if fields["upload"] != "photo.jpg" {
+		t.Errorf("Expected the fields of the context to be kept, got %v", fields)
+	}
+	if fields["errorLocalized"] != true {
+		t.Errorf("Expected a wrapped localization.Error to be recognised, got %v", fields)
+	}
+	if chain := fields["errorChain"].([]string); len(chain) != 4 {
+		t.Errorf("Expected the joined errors and their causes, got %q", chain)
+	}
+}
+
+func TestStackTracePolicy(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{StackTraceLevel: "error"})
+
+	err := errors.New("timeout")
+	log.WithError(err).Warn("Retrying")
+	log.WithError(err).Error("Giving up")
+	log.Context(logger.Fields{"error": err}).Error("Giving up again")
+	log.Error("No error attached")
+
+	if _, ok := sink.entries[0].Fields["errorStack"]; ok {
+		t.Error("Expected no stack trace below the policy level")
+	}
+	for _, entry := range sink.entries[1:3] {
+		stack, _ := entry.Fields["errorStack"].(string)
+		if !strings.HasPrefix(stack, "github.com/go-gia/go-infrastructure/logger/test.TestStackTracePolicy\n") {
+			t.Errorf("Expected the stack to start at the logging call, got %q", stack)
+		}
+	}
+	if _, ok := sink.entries[3].Fields["errorStack"]; ok {
+		t.Error("Expected no stack trace for entries without an error")
+	}
+
+	if _, err := logger.New(logger.Settings{Output: logger.Stdiscard{}, StackTraceLevel: "loud"}); err == nil {
+		t.Error("Expected an invalid stack trace level to be rejected")
+	}
+}
+
+func TestMockWithError(t *testing.T) {
+	log, err := logger.NewLogMock(logger.Settings{Output: logger.Stdout{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.WithError(localization.NewError("Wrong password")).Info("Login rejected")
+
+	if !log.HasEntry(logger.InfoLevel, "Login rejected", logger.Fields{"error": "Wrong password", "errorLocalized": true}) {
+		t.Errorf("Expected the error fields, got %v", log.Entries())
+	}
+}
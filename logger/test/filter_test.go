@@ -0,0 +1,166 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+// capture redirects the file target points at, os.Stdout or os.Stderr, while
+// fn runs and returns what was written to it.
+func capture(t *testing.T, target **os.File, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := *target
+	*target = w
+	defer func() { *target = original }()
+
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.String()
+	}()
+
+	fn()
+	w.Close()
+	return <-done
+}
+
+// logEveryLevel logs a message named after each level through the Log and
+// through a Context.
+func logEveryLevel(log logger.Logger) {
+	log.Tracef("log-trace")
+	log.Debug("log-debug")
+	log.Infof("log-%s", "info")
+	log.Warn("log-warn")
+	log.Errorf("log-error")
+	func() {
+		defer func() { recover() }()
+		log.Panic("log-panic")
+	}()
+
+	c := log.Context(logger.Fields{"foo": "bar"})
+	c.Trace("context-trace")
+	c.Debugf("context-%s", "debug")
+	c.Info("context-info")
+	c.Warnf("context-warn")
+	c.Error("context-error")
+	func() {
+		defer func() { recover() }()
+		c.Panicf("context-panic")
+	}()
+}
+
+func TestOutputsRespectLevel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	levels := []string{"panic", "fatal", "error", "warn", "info", "debug", "trace"}
+	sinks := make(map[string]*recordingSink)
+	// Outputs without a target are read back after logging.
+	outputs := []struct {
+		name   string
+		output func(level string) interface{}
+		target **os.File
+		read   func(level string) string
+	}{
+		{"stdout", func(level string) interface{} { return logger.Stdout{Level: level} }, &os.Stdout, nil},
+		{"stdout json", func(level string) interface{} { return logger.Stdout{Level: level, Format: "json"} }, &os.Stdout, nil},
+		{"stderr", func(level string) interface{} { return logger.Stderr{Level: level} }, &os.Stderr, nil},
+		{"sink", func(level string) interface{} {
+			sinks[level] = &recordingSink{}
+			return logger.SinkOutput{Sink: sinks[level], Level: level}
+		}, nil, func(level string) string {
+			return strings.Join(sinks[level].messages(), "\n")
+		}},
+		{"disk", func(level string) interface{} {
+			return logger.Disk{Level: level, Path: filepath.Join(dir, level+".log")}
+		}, nil, func(level string) string {
+			b, err := ioutil.ReadFile(filepath.Join(dir, level+".log"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(b)
+		}},
+	}
+
+	for _, o := range outputs {
+		for i, level := range levels {
+			var out string
+			run := func() {
+				log, err := logger.New(logger.Settings{Output: o.output(level)})
+				if err != nil {
+					t.Fatalf("%s at %s: %v", o.name, level, err)
+				}
+				logEveryLevel(log)
+			}
+
+			if o.target != nil {
+				out = capture(t, o.target, run)
+			} else {
+				run()
+				out = o.read(level)
+			}
+
+			for j, messageLevel := range levels {
+				if messageLevel == "fatal" {
+					continue
+				}
+				for _, source := range []string{"log", "context"} {
+					message := source + "-" + messageLevel
+					if logged, expected := strings.Contains(out, message), j <= i; logged != expected {
+						t.Errorf("%s at %s: expected %s logged to be %t", o.name, level, message, expected)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestContextDoesNotModifyFields(t *testing.T) {
+	log, err := logger.New(logger.Settings{Output: logger.Stdiscard{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := logger.Fields{"foo": "bar"}
+	log.Context(fields).Debug("message")
+
+	if len(fields) != 1 {
+		t.Errorf("Expected the fields passed to Context to be left untouched, got %v", fields)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected logger.Level
+		err      error
+	}{
+		{"trace", logger.TraceLevel, nil},
+		{"DEBUG", logger.DebugLevel, nil},
+		{"warning", logger.WarnLevel, nil},
+		{"panic", logger.PanicLevel, nil},
+		{"verbose", 0, logger.ErrLogInvalidLevel},
+	}
+
+	for _, test := range tests {
+		level, err := logger.ParseLevel(test.name)
+		if level != test.expected || err != test.err {
+			t.Errorf("ParseLevel(%q) = %s, %v; expected %s, %v", test.name, level, err, test.expected, test.err)
+		}
+	}
+}
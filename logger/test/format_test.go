@@ -0,0 +1,128 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+// logFormatted logs a warning with fields to stdout in format and returns
+// the line written.
+func logFormatted(t *testing.T, settings logger.Settings, output logger.Stdout) string {
+	output.Level = "info"
+	settings.Output = output
+	return capture(t, &os.Stdout, func() {
+		log, err := logger.New(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		log.Context(logger.Fields{
+			"user":  "ada lovelace",
+			"count": 3,
+			"msg":   "clash",
+			"error": errors.New("disk full"),
+		}).Warn("Low on space")
+	})
+}
+
+func decodeLine(t *testing.T, line string) map[string]interface{} {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		t.Fatalf("Expected a JSON line, got %q", line)
+	}
+	return fields
+}
+
+func TestFormatText(t *testing.T) {
+	line := logFormatted(t, logger.Settings{}, logger.Stdout{})
+	if strings.Contains(line, "\x1b[") {
+		t.Errorf("Expected no colours when not writing to a terminal, got %q", line)
+	}
+	if !strings.Contains(line, `level=warn msg="Low on space"`) {
+		t.Errorf("Expected plain text, got %q", line)
+	}
+}
+
+func TestFormatLogfmt(t *testing.T) {
+	settings := logger.Settings{TimeFormat: "2006-01-02", TimeZone: "UTC"}
+	line := logFormatted(t, settings, logger.Stdout{Format: logger.FormatLogfmt})
+
+	expected := "time=" + time.Now().UTC().Format("2006-01-02") +
+		` level=warn msg="Low on space" count=3 error="disk full" fields.msg=clash user="ada lovelace"` + "\n"
+	if line != expected {
+		t.Errorf("Expected %q, got %q", expected, line)
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	settings := logger.Settings{TimeFormat: time.RFC3339Nano, TimeZone: "Asia/Tokyo"}
+	fields := decodeLine(t, logFormatted(t, settings, logger.Stdout{Format: logger.FormatJSON}))
+
+	if fields["msg"] != "Low on space" || fields["level"] != "warn" || fields["fields.msg"] != "clash" || fields["error"] != "disk full" {
+		t.Errorf("Expected the standard keys and the fields, got %v", fields)
+	}
+	if ts, _ := fields["time"].(string); !strings.HasSuffix(ts, "+09:00") {
+		t.Errorf("Expected the time in the configured time zone, got %v", fields["time"])
+	}
+}
+
+func TestFormatECS(t *testing.T) {
+	fields := decodeLine(t, logFormatted(t, logger.Settings{}, logger.Stdout{Format: logger.FormatECS}))
+
+	if fields["message"] != "Low on space" || fields["log.level"] != "warn" || fields["ecs.version"] == nil {
+		t.Errorf("Expected the ECS base fields, got %v", fields)
+	}
+	if fields["error.message"] != "disk full" || fields["user"] != "ada lovelace" {
+		t.Errorf("Expected the fields under their ECS names, got %v", fields)
+	}
+	if _, err := time.Parse(time.RFC3339, fields["@timestamp"].(string)); err != nil {
+		t.Errorf("Expected an ISO 8601 timestamp, got %v", fields["@timestamp"])
+	}
+}
+
+func TestFormatGELF(t *testing.T) {
+	fields := decodeLine(t, logFormatted(t, logger.Settings{}, logger.Stdout{Format: logger.FormatGELF}))
+
+	if fields["version"] != "1.1" || fields["short_message"] != "Low on space" || fields["level"] != float64(4) {
+		t.Errorf("Expected the GELF fields, got %v", fields)
+	}
+	if fields["_user"] != "ada lovelace" || fields["_count"] != float64(3) || fields["_error"] != "disk full" {
+		t.Errorf("Expected the fields as additional fields, got %v", fields)
+	}
+	if _, ok := fields["timestamp"].(float64); !ok {
+		t.Errorf("Expected a numeric timestamp, got %v", fields["timestamp"])
+	}
+}
+
+func TestFormatTemplate(t *testing.T) {
+	line := logFormatted(t, logger.Settings{}, logger.Stdout{
+		Format:   logger.FormatTemplate,
+		Template: `[{{.Level}}] {{.Message}} user={{index .Fields "user"}}`,
+	})
+	if line != "[warn] Low on space user=ada lovelace\n" {
+		t.Errorf("Expected the executed template, got %q", line)
+	}
+}
+
+func TestFormatInvalid(t *testing.T) {
+	cases := map[string]struct {
+		settings logger.Settings
+		err      error
+	}{
+		"format":      {logger.Settings{Output: logger.Stdout{Format: "xml"}}, logger.ErrLogInvalidFormat},
+		"template":    {logger.Settings{Output: logger.Stdout{Format: logger.FormatTemplate, Template: "{{.Level"}}, logger.ErrLogInvalidTemplate},
+		"no template": {logger.Settings{Output: logger.Disk{Path: os.DevNull, Format: logger.FormatTemplate}}, logger.ErrLogInvalidTemplate},
+		"time zone":   {logger.Settings{Output: logger.Stdiscard{}, TimeZone: "Mars/Olympus_Mons"}, logger.ErrLogInvalidTimeZone},
+		"encoding":    {logger.Settings{Output: logger.Remote{URL: "http://logs.internal", Encoding: "text"}}, logger.ErrLogInvalidFormat},
+	}
+	for name, c := range cases {
+		if _, err := logger.New(c.settings); err != c.err {
+			t.Errorf("Expected %v for the %s, got %v", c.err, name, err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+func TestRuntimeLevels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "levels.log")
+
+	log, err := logger.New(logger.Settings{
+		Output:  logger.Disk{Path: path, Level: "warn"},
+		Modules: map[string]string{"webserver": "debug"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	render := log.Named("webserver").Named("render")
+
+	log.Debug("root debug before")
+	render.Debug("render debug")
+	if err := log.SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	log.Context(logger.Fields{"foo": "bar"}).Debug("root debug after")
+	if err := log.SetModuleLevel("webserver.render", "error"); err != nil {
+		t.Fatal(err)
+	}
+	render.Warn("render warn")
+
+	if err := log.SetLevel("loud"); err != logger.ErrLogInvalidLevel {
+		t.Errorf("Expected ErrLogInvalidLevel, got %v", err)
+	}
+	if render.Level() != "error" || log.Named("webserver").Level() != "debug" {
+		t.Errorf("Expected module levels error and debug, got %s and %s", render.Level(), log.Named("webserver").Level())
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(b)
+	for message, expected := range map[string]bool{
+		"root debug before": false,
+		"render debug":      true,
+		"root debug after":  true,
+		"render warn":       false,
+	} {
+		if strings.Contains(out, message) != expected {
+			t.Errorf("Expected %q logged to be %t in:\n%s", message, expected, out)
+		}
+	}
+	if !strings.Contains(out, `"module":"webserver.render"`) {
+		t.Errorf("Expected named loggers to log their module in:\n%s", out)
+	}
+}
+
+func TestNamedSetLevel(t *testing.T) {
+	log, err := logger.New(logger.Settings{
+		Output:  logger.Stdiscard{},
+		Modules: map[string]string{"webserver": "warn"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.SetLevel("info")
+
+	webserver := log.Named("webserver")
+	if err := webserver.SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	if webserver.Level() != "debug" || log.Level() != "info" {
+		t.Errorf("Expected only the module to change to debug, got %s and %s", webserver.Level(), log.Level())
+	}
+	if levels := log.ModuleLevels(); levels["webserver"] != "debug" {
+		t.Errorf("Expected a module override, got %v", levels)
+	}
+	if err := webserver.SetLevel(""); err != logger.ErrLogInvalidLevel {
+		t.Errorf("Expected ErrLogInvalidLevel, got %v", err)
+	}
+}
+
+func TestSetLevelConcurrently(t *testing.T) {
+	log, err := logger.New(logger.Settings{Output: logger.Stdiscard{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if i%2 == 0 {
+					log.SetLevel("info")
+					log.SetModuleLevel("worker", "debug")
+				} else {
+					log.Named("worker").Debug("working")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -1,6 +1,9 @@
 package test
 
 import (
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/go-gia/go-infrastructure/logger"
@@ -68,3 +71,132 @@ func TestLogglyLogging(t *testing.T) {
 	}
 	log.Context(logger.Fields{"foo": "bar4"}).Debug("Debug")
 }
+
+func TestMockLogRecords(t *testing.T) {
+	log, err := logger.NewLogMock(logger.Settings{Output: logger.Stdout{Level: "info"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Debug("Hidden")
+	log.Infof("Served %s in %dms", "/", 12)
+	log.Context(logger.Fields{"path": "/login", "status": 403}).Warn("Rejected", "request")
+	log.Fatal("Not exiting")
+
+	if n := len(log.Entries()); n != 3 {
+		t.Fatalf("Expected 3 entries above the info level, got %d", n)
+	}
+	if log.HasEntry(logger.DebugLevel, "Hidden", nil) {
+		t.Error("Expected the debug message to be filtered")
+	}
+	if !log.HasEntry(logger.InfoLevel, "Served / in 12ms", nil) {
+		t.Error("Expected the formatted info message")
+	}
+	if !log.HasEntry(logger.WarnLevel, "Rejected request", logger.Fields{"status": 403}) {
+		t.Error("Expected the warning with its fields")
+	}
+	if log.HasEntry(logger.WarnLevel, "Rejected", logger.Fields{"status": 500}) {
+		t.Error("Expected fields to be compared")
+	}
+	log.AssertEntry(t, logger.FatalLevel, "Not exiting", nil)
+
+	entry := log.FindEntries(logger.InfoLevel, "Served", nil)[0]
+	if len(entry.Args) != 2 || entry.Args[1] != 12 {
+		t.Errorf("Expected the format args, got %v", entry.Args)
+	}
+	if !strings.HasPrefix(entry.Caller, "/mock_test.go:") {
+		t.Errorf("Expected the caller in this file, got %q", entry.Caller)
+	}
+
+	log.Reset()
+	if len(log.Entries()) != 0 {
+		t.Error("Expected Reset to discard the entries")
+	}
+}
+
+// failures collects the errors reported by AssertEntry.
+type failures []string
+
+func (f *failures) Errorf(format string, args ...interface{}) {
+	*f = append(*f, fmt.Sprintf(format, args...))
+}
+
+func TestMockLogAssertEntry(t *testing.T) {
+	log, err := logger.NewLogMock(logger.Settings{Output: logger.Stdiscard{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Debug("Evaluating static route")
+
+	var f failures
+	if log.AssertEntry(&f, logger.WarnLevel, "static", nil) {
+		t.Error("Expected no warning to be found")
+	}
+	if len(f) != 1 || !strings.Contains(f[0], "Evaluating static route") {
+		t.Errorf("Expected the failure to list the recorded entries, got %q", f)
+	}
+}
+
+func TestMockLogLevels(t *testing.T) {
+	log, err := logger.NewLogMock(logger.Settings{
+		Outputs: []interface{}{
+			logger.Stderr{Level: "error"},
+			logger.Disk{Path: "unused.log", Level: "debug"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Trace("Hidden")
+	log.Debug("Shown")
+	if log.HasEntry(logger.TraceLevel, "Hidden", nil) || !log.HasEntry(logger.DebugLevel, "Shown", nil) {
+		t.Errorf("Expected the most verbose output level, got %v", log.Entries())
+	}
+
+	if _, err := logger.NewLogMock(logger.Settings{Output: logger.Stdout{Level: "loud"}}); err == nil {
+		t.Error("Expected an invalid level to be rejected")
+	}
+	if _, err := logger.NewLogMock(logger.Settings{}); err != logger.ErrLogInvalidType {
+		t.Errorf("Expected ErrLogInvalidType, got %v", err)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "Stop" {
+				t.Errorf("Expected Panic to panic with the message, got %v", r)
+			}
+		}()
+		log.Panic("Stop")
+	}()
+	if !log.HasEntry(logger.PanicLevel, "Stop", nil) {
+		t.Error("Expected the panic message to be recorded")
+	}
+}
+
+func TestMockLogConcurrent(t *testing.T) {
+	log, err := logger.NewLogMock(logger.Settings{Output: logger.Stdout{Level: "debug"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := log.Context(logger.Fields{"worker": i})
+			for j := 0; j < 100; j++ {
+				ctx.Debug("working")
+				log.HasEntry(logger.DebugLevel, "working", logger.Fields{"worker": i})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := len(log.FindEntries(logger.DebugLevel, "working", nil)); n != 800 {
+		t.Errorf("Expected 800 entries, got %d", n)
+	}
+	if n := len(log.FindEntries(logger.DebugLevel, "working", logger.Fields{"worker": 3})); n != 100 {
+		t.Errorf("Expected 100 entries from worker 3, got %d", n)
+	}
+}
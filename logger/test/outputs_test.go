@@ -0,0 +1,120 @@
+package test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+// recordingSink keeps the entries it receives.
+type recordingSink struct {
+	sync.Mutex
+	entries []logger.Entry
+	flushed bool
+	// gate, when set, blocks every write until it is closed.
+	gate chan struct{}
+}
+
+// newSinkLog returns a Log with settings writing every level to a
+// recordingSink.
+func newSinkLog(t *testing.T, settings logger.Settings) (*logger.Log, *recordingSink) {
+	sink := &recordingSink{}
+	settings.Output = logger.SinkOutput{Sink: sink, Level: "trace"}
+	log, err := logger.New(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log, sink
+}
+
+func (s *recordingSink) Write(entry logger.Entry) error {
+	if s.gate != nil {
+		<-s.gate
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *recordingSink) Flush() error {
+	s.flushed = true
+	return nil
+}
+
+func TestFanOut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+
+	sink := &recordingSink{}
+	var log *logger.Log
+	stdout := capture(t, &os.Stdout, func() {
+		log, err = logger.New(logger.Settings{
+			Outputs: []interface{}{
+				logger.Stdout{Level: "warn", Format: "text"},
+				logger.Disk{Path: path, Level: "debug"},
+				logger.SinkOutput{Sink: sink, Level: "info"},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		log.Debug("debug message")
+		log.Context(logger.Fields{"user": 7}).Info("info message")
+		log.Warn("warn message")
+		log.Flush()
+	})
+
+	if strings.Contains(stdout, "info message") || !strings.Contains(stdout, "warn message") {
+		t.Errorf("Expected only the warning on stdout, got:\n%s", stdout)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected three JSON lines on disk, got:\n%s", b)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || entry["user"] != float64(7) {
+		t.Errorf("Expected the info message as JSON with its fields, got %s", lines[1])
+	}
+
+	if len(sink.entries) != 2 || sink.entries[0].Level != logger.InfoLevel || sink.entries[0].Fields["user"] != 7 {
+		t.Errorf("Expected the info and warn entries in the sink, got %+v", sink.entries)
+	}
+	if !sink.flushed {
+		t.Error("Expected Flush to reach the sink")
+	}
+
+	// With several outputs SetLevel can make them quieter but not more
+	// verbose than their own level.
+	log.SetLevel("error")
+	log.Warn("quiet")
+	log.SetLevel("trace")
+	log.Debug("verbose")
+	if len(sink.entries) != 2 {
+		t.Errorf("Expected the sink to keep its info level, got %+v", sink.entries[2:])
+	}
+}
+
+func TestInvalidFormat(t *testing.T) {
+	_, err := logger.New(logger.Settings{Outputs: []interface{}{logger.Stderr{Format: "xml"}}})
+	if err != logger.ErrLogInvalidFormat {
+		t.Errorf("Expected ErrLogInvalidFormat, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+// credentials is a struct logged as a field.
+type credentials struct {
+	User     string `json:"user"`
+	Password string `json:"pass"`
+	APIKey   string
+}
+
+func TestRedactFields(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{Redaction: logger.RedactionSettings{Fields: logger.DefaultRedactedFields}})
+
+	nested := map[string]interface{}{"name": "gia", "TOKEN": "abc"}
+	log.Context(logger.Fields{
+		"Password": "hunter2",
+		"user":     "ada",
+		"request":  nested,
+		"login":    credentials{User: "ada", Password: "hunter2", APIKey: "k"},
+		"logins":   []*credentials{{User: "bob", Password: "pw"}},
+	}).Info("Signed in")
+
+	fields := sink.entries[0].Fields
+	if fields["Password"] != logger.Redacted || fields["user"] != "ada" {
+		t.Errorf("Expected the password to be redacted, got %v", fields)
+	}
+	request := fields["request"].(map[string]interface{})
+	if request["TOKEN"] != logger.Redacted || request["name"] != "gia" {
+		t.Errorf("Expected the nested token to be redacted, got %v", request)
+	}
+	if nested["TOKEN"] != "abc" {
+		t.Error("Expected the logged map not to be modified")
+	}
+	login := fields["login"].(map[string]interface{})
+	if login["pass"] != logger.Redacted || login["APIKey"] != logger.Redacted || login["user"] != "ada" {
+		t.Errorf("Expected the struct fields to be redacted by json and Go name, got %v", login)
+	}
+	logins := fields["logins"].([]interface{})
+	if logins[0].(map[string]interface{})["pass"] != logger.Redacted {
+		t.Errorf("Expected the structs in the slice to be redacted, got %v", logins)
+	}
+}
+
+func TestRedactPatterns(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{Redaction: logger.RedactionSettings{
+		Patterns:    []string{logger.PatternBearerToken, logger.PatternCardNumber, logger.PatternEmail},
+		Replacement: "***",
+	}})
+
+	log.Context(logger.Fields{
+		"header": "Bearer eyJhbGciOiJIUzI1NiJ9.e30.sig",
+		"error":  errors.New("charging 4111 1111 1111 1111 failed"),
+		"count":  3,
+	}).Warn("Sent a receipt to ada@example.com")
+
+	entry := sink.entries[0]
+	if entry.Message != "Sent a receipt to ***" {
+		t.Errorf("Expected the email to be redacted, got %q", entry.Message)
+	}
+	if entry.Fields["header"] != "***" {
+		t.Errorf("Expected the bearer token to be redacted, got %v", entry.Fields["header"])
+	}
+	if entry.Fields["error"] != "charging *** failed" {
+		t.Errorf("Expected the card number to be redacted, got %v", entry.Fields["error"])
+	}
+	if entry.Fields["count"] != 3 {
+		t.Errorf("Expected other fields to be kept, got %v", entry.Fields["count"])
+	}
+}
+
+func TestSensitive(t *testing.T) {
+	secret := logger.Sensitive("hunter2")
+	formatted := fmt.Sprintf("%v %+v %#v %s %q", secret, secret, secret, secret, secret)
+	if formatted != "[REDACTED] [REDACTED] [REDACTED] [REDACTED] [REDACTED]" {
+		t.Errorf("Expected every verb to be redacted, got %q", formatted)
+	}
+	b, _ := json.Marshal(map[string]interface{}{"password": secret})
+	if string(b) != `{"password":"[REDACTED]"}` {
+		t.Errorf("Expected the JSON value to be redacted, got %s", b)
+	}
+
+	log, sink := newSinkLog(t, logger.Settings{Redaction: logger.RedactionSettings{Patterns: []string{logger.PatternEmail}}})
+	log.Context(logger.Fields{"password": secret}).Info("Changed password")
+	if sink.entries[0].Fields["password"] != logger.Redacted {
+		t.Errorf("Expected the sensitive value to be redacted, got %v", sink.entries[0].Fields["password"])
+	}
+}
+
+func TestRedactInvalidPattern(t *testing.T) {
+	_, err := logger.New(logger.Settings{
+		Output:    logger.Stdiscard{},
+		Redaction: logger.RedactionSettings{Patterns: []string{"(unclosed"}},
+	})
+	if err != logger.ErrLogInvalidPattern {
+		t.Errorf("Expected ErrLogInvalidPattern, got %v", err)
+	}
+}
@@ -0,0 +1,423 @@
+package test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+// collector is an httptest stand-in for a log collector. It answers with the
+// statuses in fail before accepting requests.
+type collector struct {
+	sync.Mutex
+	server   *httptest.Server
+	fail     []int
+	attempts int
+	bodies   []string
+	headers  []http.Header
+}
+
+func newCollector(fail ...int) *collector {
+	c := &collector{fail: fail}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = gz
+		}
+		b, _ := ioutil.ReadAll(body)
+
+		c.Lock()
+		defer c.Unlock()
+		c.attempts++
+		if len(c.fail) > 0 {
+			w.WriteHeader(c.fail[0])
+			c.fail = c.fail[1:]
+			return
+		}
+		c.bodies = append(c.bodies, string(b))
+		c.headers = append(c.headers, r.Header)
+	}))
+	return c
+}
+
+func (c *collector) received() ([]string, int) {
+	c.Lock()
+	defer c.Unlock()
+	return append([]string(nil), c.bodies...), c.attempts
+}
+
+func newRemoteLog(t *testing.T, output logger.Remote) *logger.Log {
+	output.Level = "info"
+	if output.FlushInterval == 0 {
+		output.FlushInterval = time.Hour
+	}
+	output.RetryBackoff = time.Millisecond
+	log, err := logger.New(logger.Settings{Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+// jsonLines decodes a body of JSON lines.
+func jsonLines(t *testing.T, body string) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("Expected a JSON line, got %q", line)
+		}
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func TestRemoteBatches(t *testing.T) {
+	c := newCollector()
+	defer c.server.Close()
+
+	log := newRemoteLog(t, logger.Remote{URL: c.server.URL, BatchSize: 3})
+	for i := 0; i < 7; i++ {
+		log.Context(logger.Fields{"n": i}).Info("shipped")
+	}
+	log.Flush()
+
+	bodies, _ := c.received()
+	if len(bodies) != 3 {
+		t.Fatalf("Expected 3 batches, got %d", len(bodies))
+	}
+	n := 0
+	for i, body := range bodies {
+		lines := jsonLines(t, body)
+		if expected := []int{3, 3, 1}[i]; len(lines) != expected {
+			t.Errorf("Expected %d entries in batch %d, got %d", expected, i, len(lines))
+		}
+		for _, line := range lines {
+			if line["msg"] != "shipped" || line["level"] != "info" || line["n"] != float64(n) {
+				t.Errorf("Expected entry %d in order, got %v", n, line)
+			}
+			n++
+		}
+	}
+	if ct := c.headers[0].Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected JSON lines, got %q", ct)
+	}
+}
+
+func TestRemoteFlushInterval(t *testing.T) {
+	c := newCollector()
+	defer c.server.Close()
+
+	log := newRemoteLog(t, logger.Remote{URL: c.server.URL, FlushInterval: 10 * time.Millisecond})
+	log.Info("soon")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if bodies, _ := c.received(); len(bodies) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the incomplete batch to be sent after the flush interval")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRemoteGzipAndHeaders(t *testing.T) {
+	c := newCollector()
+	defer c.server.Close()
+
+	log := newRemoteLog(t, logger.Remote{
+		URL:     c.server.URL,
+		Gzip:    true,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	})
+	log.Warn("compressed")
+	log.Flush()
+
+	bodies, _ := c.received()
+	if len(bodies) != 1 || jsonLines(t, bodies[0])[0]["msg"] != "compressed" {
+		t.Fatalf("Expected the decompressed entry, got %q", bodies)
+	}
+	if c.headers[0].Get("Authorization") != "Bearer secret" {
+		t.Errorf("Expected the configured headers, got %v", c.headers[0])
+	}
+}
+
+func TestRemoteRetries(t *testing.T) {
+	c := newCollector(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	defer c.server.Close()
+
+	log := newRemoteLog(t, logger.Remote{URL: c.server.URL})
+	log.Error("eventually")
+	log.Flush()
+
+	bodies, attempts := c.received()
+	if len(bodies) != 1 || attempts != 3 {
+		t.Errorf("Expected the batch to be sent on the third attempt, got %d bodies in %d attempts", len(bodies), attempts)
+	}
+}
+
+func TestRemoteRejected(t *testing.T) {
+	c := newCollector(http.StatusBadRequest)
+	defer c.server.Close()
+
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log := newRemoteLog(t, logger.Remote{URL: c.server.URL, SpoolDir: dir})
+	log.Error("malformed")
+	log.Flush()
+
+	if _, attempts := c.received(); attempts != 1 {
+		t.Errorf("Expected a rejected batch not to be retried, got %d attempts", attempts)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected a rejected batch not to be spooled, got %d files", len(files))
+	}
+}
+
+func TestRemoteSpool(t *testing.T) {
+	c := newCollector(http.StatusBadGateway, http.StatusBadGateway)
+	defer c.server.Close()
+
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	log := newRemoteLog(t, logger.Remote{URL: c.server.URL, SpoolDir: dir, MaxRetries: 1})
+	log.Info("during the outage")
+	log.Flush()
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("Expected the failed batch to be spooled, got %d files", len(files))
+	}
+
+	log.Info("after the outage")
+	log.Flush()
+
+	bodies, _ := c.received()
+	if len(bodies) != 2 {
+		t.Fatalf("Expected the new and the spooled batch, got %q", bodies)
+	}
+	if jsonLines(t, bodies[0])[0]["msg"] != "after the outage" || jsonLines(t, bodies[1])[0]["msg"] != "during the outage" {
+		t.Errorf("Expected the spooled batch to be resent after the new one, got %q", bodies)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected the spool to be emptied, got %d files", len(files))
+	}
+}
+
+func TestRemoteFormats(t *testing.T) {
+	c := newCollector()
+	defer c.server.Close()
+
+	log := newRemoteLog(t, logger.Remote{URL: c.server.URL, Format: logger.RemoteElasticsearch, Index: "logs"})
+	log.Info("indexed")
+	log.Flush()
+
+	log = newRemoteLog(t, logger.Remote{URL: c.server.URL, Format: logger.RemoteLoki, Labels: map[string]string{"app": "gia"}})
+	log.Info("pushed")
+	log.Flush()
+
+	bodies, _ := c.received()
+	if len(bodies) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(bodies))
+	}
+
+	bulk := jsonLines(t, bodies[0])
+	if len(bulk) != 2 || bulk[0]["index"].(map[string]interface{})["_index"] != "logs" || bulk[1]["msg"] != "indexed" {
+		t.Errorf("Expected an index action followed by the entry, got %v", bulk)
+	}
+
+	var push struct {
+		Streams []struct {
+			Stream map[string]string
+			Values [][2]string
+		}
+	}
+	if err := json.Unmarshal([]byte(bodies[1]), &push); err != nil {
+		t.Fatal(err)
+	}
+	if len(push.Streams) != 1 || push.Streams[0].Stream["app"] != "gia" || len(push.Streams[0].Values) != 1 {
+		t.Fatalf("Expected a single labelled stream, got %+v", push)
+	}
+	if !strings.Contains(push.Streams[0].Values[0][1], `"msg":"pushed"`) {
+		t.Errorf("Expected the entry as the value, got %q", push.Streams[0].Values[0][1])
+	}
+}
+
+func TestRemoteTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	lines := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	log := newRemoteLog(t, logger.Remote{URL: "tcp://" + l.Addr().String()})
+	log.Info("first")
+	log.Info("second")
+	log.Flush()
+
+	for _, expected := range []string{"first", "second"} {
+		select {
+		case line := <-lines:
+			if !strings.Contains(line, `"msg":"`+expected+`"`) {
+				t.Errorf("Expected %q, got %q", expected, line)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %q to be streamed", expected)
+		}
+	}
+}
+
+func TestRemoteInvalid(t *testing.T) {
+	outputs := map[string]logger.Remote{
+		"scheme": {URL: "ftp://logs.internal"},
+		"format": {URL: "http://logs.internal", Format: "xml"},
+	}
+	for name, output := range outputs {
+		if _, err := logger.New(logger.Settings{Output: output}); err == nil {
+			t.Errorf("Expected an error for the %s", name)
+		}
+	}
+}
+
+func TestRemoteElasticsearchItemFailures(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(b))
+		if len(bodies) == 1 {
+			io.WriteString(w, `{"errors":true,"items":[
+				{"index":{"status":201}},
+				{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}},
+				{"index":{"status":429,"error":{"type":"es_rejected_execution_exception"}}}]}`)
+			return
+		}
+		io.WriteString(w, `{"errors":false,"items":[{"index":{"status":201}}]}`)
+	}))
+	defer server.Close()
+
+	log := newRemoteLog(t, logger.Remote{URL: server.URL, Format: logger.RemoteElasticsearch, BatchSize: 3})
+	reported := capture(t, &os.Stderr, func() {
+		log.Info("indexed")
+		log.Info("malformed")
+		log.Info("throttled")
+		log.Flush()
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodies) != 2 {
+		t.Fatalf("Expected the throttled entry to be retried, got %q", bodies)
+	}
+	if retried := jsonLines(t, bodies[1]); len(retried) != 2 || retried[1]["msg"] != "throttled" {
+		t.Errorf("Expected only the throttled entry to be retried, got %v", retried)
+	}
+	if !strings.Contains(reported, "rejected 1 entries") || !strings.Contains(reported, "mapper_parsing_exception") {
+		t.Errorf("Expected the rejected entry to be reported, got %q", reported)
+	}
+}
+
+func TestRemoteClose(t *testing.T) {
+	c := newCollector()
+	defer c.server.Close()
+
+	before := runtime.NumGoroutine()
+	log := newRemoteLog(t, logger.Remote{URL: c.server.URL, FlushInterval: time.Millisecond})
+	log.Info("before close")
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if bodies, _ := c.received(); len(bodies) != 1 {
+		t.Errorf("Expected Close to send the buffered entries, got %q", bodies)
+	}
+
+	reported := capture(t, &os.Stderr, func() { log.Info("after close") })
+	if !strings.Contains(reported, logger.ErrLogClosed.Error()) {
+		t.Errorf("Expected writes after Close to be reported, got %q", reported)
+	}
+	if err := log.Close(); err != nil {
+		t.Errorf("Expected a second Close to do nothing, got %v", err)
+	}
+
+	// The idle connections of the client close on their own.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before+2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before+2 {
+		t.Errorf("Expected the sender and ticker to stop, %d goroutines before and %d after", before, n)
+	}
+}
+
+func TestRemoteConcurrentFlush(t *testing.T) {
+	c := newCollector()
+	defer c.server.Close()
+
+	log := newRemoteLog(t, logger.Remote{URL: c.server.URL, BatchSize: 1})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				log.Info("concurrent")
+				log.Flush()
+			}
+		}()
+	}
+	wg.Wait()
+	log.Close()
+
+	n := 0
+	bodies, _ := c.received()
+	for _, body := range bodies {
+		n += len(jsonLines(t, body))
+	}
+	if n != 160 {
+		t.Errorf("Expected every entry to be sent, got %d", n)
+	}
+}
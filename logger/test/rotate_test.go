@@ -0,0 +1,135 @@
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	log, err := logger.New(logger.Settings{Output: logger.Disk{
+		Path:       filepath.Join(dir, "app.log"),
+		Level:      "info",
+		MaxSize:    512,
+		MaxBackups: 2,
+		Compress:   true,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				log.Info(strings.Repeat("x", 64))
+			}
+		}()
+	}
+	wg.Wait()
+	log.Flush()
+
+	files, err := filepath.Glob(filepath.Join(dir, "app-*.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("Expected two compressed backups, got %v", files)
+	}
+	if uncompressed, _ := filepath.Glob(filepath.Join(dir, "app-*.log")); len(uncompressed) != 0 {
+		t.Errorf("Expected every backup to be compressed, got %v", uncompressed)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 512 {
+		t.Errorf("Expected the current file to stay within MaxSize, got %d bytes", info.Size())
+	}
+}
+
+func TestRotateByTime(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	log, err := logger.New(logger.Settings{Output: logger.Disk{
+		Path:        filepath.Join(dir, "app.log"),
+		RotateEvery: 50 * time.Millisecond,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Info("first period")
+	time.Sleep(60 * time.Millisecond)
+	log.Info("second period")
+	log.Flush()
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "app-*.log"))
+	if len(backups) != 1 {
+		t.Fatalf("Expected one backup, got %v", backups)
+	}
+	b, _ := ioutil.ReadFile(backups[0])
+	if !strings.Contains(string(b), "first period") {
+		t.Errorf("Expected the backup to hold the first period, got %s", b)
+	}
+}
+
+func TestRotateFlushWhileWriting(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	log, err := logger.New(logger.Settings{Output: logger.Disk{
+		Path:     filepath.Join(dir, "app.log"),
+		MaxSize:  256,
+		Compress: true,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				log.Info(strings.Repeat("x", 64))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				log.Flush()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if uncompressed, _ := filepath.Glob(filepath.Join(dir, "app-*.log")); len(uncompressed) != 0 {
+		t.Errorf("Expected Close to wait for every backup to be compressed, got %v", uncompressed)
+	}
+}
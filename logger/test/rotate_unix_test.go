@@ -0,0 +1,81 @@
+//go:build !windows
+// +build !windows
+
+package test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+func TestReopenOnSIGHUP(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+
+	log, err := logger.New(logger.Settings{Output: logger.Disk{Path: path, ReopenOnSIGHUP: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Info("before")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the file to be reopened after SIGHUP")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	log.Info("after")
+	b, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(b), "after") || strings.Contains(string(b), "before") {
+		t.Errorf("Expected only the later message in the reopened file, got %s", b)
+	}
+}
+
+func TestReopenOnSIGHUPStopsOnClose(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+
+	// Keep SIGHUP from terminating the test once the log stops handling it.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	log, err := logger.New(logger.Settings{Output: logger.Disk{Path: path, ReopenOnSIGHUP: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	<-signals
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the closed file not to be reopened, got %v", err)
+	}
+}
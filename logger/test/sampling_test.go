@@ -0,0 +1,200 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+// messages returns the messages the sink received, in order.
+func (s *recordingSink) messages() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	messages := make([]string, len(s.entries))
+	for i, entry := range s.entries {
+		messages[i] = entry.Message
+	}
+	return messages
+}
+
+func TestSamplingFirstThenEveryNth(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{Sampling: logger.SamplingSettings{
+		Levels: map[string]logger.Sampling{
+			"debug": {Interval: time.Hour, First: 3, Thereafter: 5},
+		},
+	}})
+
+	for i := 0; i < 20; i++ {
+		log.Debug("Evaluating static route")
+		log.Info("Request served")
+	}
+	log.Debug("Other route")
+
+	debug, info, other := 0, 0, 0
+	for _, message := range sink.messages() {
+		switch message {
+		case "Evaluating static route":
+			debug++
+		case "Request served":
+			info++
+		case "Other route":
+			other++
+		}
+	}
+
+	// The first 3 and then the 8th, 13th and 18th.
+	if debug != 6 {
+		t.Errorf("Expected 6 sampled debug messages, got %d", debug)
+	}
+	if info != 20 {
+		t.Errorf("Expected info messages not to be sampled, got %d", info)
+	}
+	if other != 1 {
+		t.Errorf("Expected messages to be sampled separately, got %d", other)
+	}
+}
+
+func TestSamplingIntervalResets(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{Sampling: logger.SamplingSettings{
+		Levels: map[string]logger.Sampling{
+			"info": {Interval: 50 * time.Millisecond, First: 1},
+		},
+	}})
+
+	log.Info("tick")
+	log.Info("tick")
+	time.Sleep(60 * time.Millisecond)
+	log.Info("tick")
+
+	if n := len(sink.messages()); n != 2 {
+		t.Errorf("Expected one message per interval, got %d", n)
+	}
+}
+
+func TestSamplingByModule(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{Sampling: logger.SamplingSettings{
+		Levels: map[string]logger.Sampling{
+			"info": {Interval: time.Hour, First: 1},
+		},
+		Modules: map[string]map[string]logger.Sampling{
+			"webserver":        {"info": {Interval: time.Hour, First: 2}},
+			"webserver.health": {},
+		},
+	}})
+
+	render := log.Named("webserver").Named("render")
+	health := log.Named("webserver").Named("health")
+	for i := 0; i < 5; i++ {
+		log.Info("root")
+		render.Info("render")
+		health.Info("health")
+	}
+
+	counts := map[string]int{}
+	for _, message := range sink.messages() {
+		counts[message]++
+	}
+	expected := map[string]int{"root": 1, "render": 2, "health": 5}
+	for message, n := range expected {
+		if counts[message] != n {
+			t.Errorf("Expected %d %q messages, got %d", n, message, counts[message])
+		}
+	}
+}
+
+func TestSamplingNeverDropsFatal(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{Sampling: logger.SamplingSettings{
+		Levels: map[string]logger.Sampling{
+			"panic": {Interval: time.Hour},
+		},
+	}})
+
+	for i := 0; i < 3; i++ {
+		func() {
+			defer func() { recover() }()
+			log.Panic("boom")
+		}()
+	}
+
+	if n := len(sink.messages()); n != 3 {
+		t.Errorf("Expected panic messages not to be sampled, got %d", n)
+	}
+}
+
+func TestDeduplication(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{Sampling: logger.SamplingSettings{DedupInterval: time.Hour}})
+
+	for i := 0; i < 42; i++ {
+		log.Context(logger.Fields{"path": "/static"}).Debug("Evaluating static route")
+	}
+	log.Info("Request served")
+	log.Info("Request served")
+	log.Flush()
+
+	expected := []string{
+		"Evaluating static route",
+		"Evaluating static route (repeated 41 times)",
+		"Request served",
+		"Request served (repeated 1 times)",
+	}
+	messages := sink.messages()
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %q, got %q", expected, messages)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], messages[i])
+		}
+	}
+
+	summary := sink.entries[1]
+	if summary.Level != logger.DebugLevel || summary.Fields["repeated"] != 41 || summary.Fields["path"] != "/static" {
+		t.Errorf("Expected the summary to keep the level and fields, got %+v", summary)
+	}
+}
+
+func TestDeduplicationWindowEnds(t *testing.T) {
+	log, sink := newSinkLog(t, logger.Settings{Sampling: logger.SamplingSettings{DedupInterval: 20 * time.Millisecond}})
+
+	log.Warn("disk almost full")
+	log.Warn("disk almost full")
+	log.Warn("disk almost full")
+
+	deadline := time.Now().Add(time.Second)
+	for len(sink.messages()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the summary when the window ends, got %q", sink.messages())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	log.Warn("disk almost full")
+	log.Flush()
+
+	expected := []string{"disk almost full", "disk almost full (repeated 2 times)", "disk almost full"}
+	messages := sink.messages()
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %q, got %q", expected, messages)
+	}
+	for i := range expected {
+		if messages[i] != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], messages[i])
+		}
+	}
+}
+
+func TestInvalidSampling(t *testing.T) {
+	settings := []logger.SamplingSettings{
+		{Levels: map[string]logger.Sampling{"loud": {Interval: time.Second}}},
+		{Levels: map[string]logger.Sampling{"info": {}}},
+		{Modules: map[string]map[string]logger.Sampling{"webserver": {"info": {Interval: time.Second, First: -1}}}},
+	}
+	for _, sampling := range settings {
+		_, err := logger.New(logger.Settings{Output: logger.Stdiscard{}, Sampling: sampling})
+		if err == nil {
+			t.Errorf("Expected an error for %+v", sampling)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+func TestFatalRunsHooksAndExits(t *testing.T) {
+	var codes []int
+	log, sink := newSinkLog(t, logger.Settings{ExitHandler: func(code int) { codes = append(codes, code) }})
+
+	var order []string
+	log.OnShutdown(func(context.Context) error {
+		order = append(order, "first")
+		return nil
+	})
+	log.Named("webserver").OnShutdown(func(context.Context) error {
+		order = append(order, "second")
+		return errors.New("still serving")
+	})
+
+	log.Fatal("Out of disk")
+
+	if len(codes) != 1 || codes[0] != 1 {
+		t.Fatalf("Expected the exit handler to be called with 1, got %v", codes)
+	}
+	if strings.Join(order, ",") != "second,first" {
+		t.Errorf("Expected the hooks to run in reverse order, got %v", order)
+	}
+	if !sink.flushed {
+		t.Error("Expected the outputs to be flushed before exiting")
+	}
+	messages := sink.messages()
+	if len(messages) != 2 || messages[0] != "Out of disk" || messages[1] != "Shutdown hook failed" {
+		t.Errorf("Expected the fatal message and the failed hook, got %v", messages)
+	}
+
+	log.Fatalf("Out of %s", "memory")
+	if len(codes) != 2 || len(order) != 2 {
+		t.Errorf("Expected the hooks to run once, got %v after %v", order, codes)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	log, _ := newSinkLog(t, logger.Settings{ShutdownTimeout: 10 * time.Millisecond})
+
+	var deadline time.Time
+	log.OnShutdown(func(ctx context.Context) error {
+		deadline, _ = ctx.Deadline()
+		<-ctx.Done()
+		return nil
+	})
+
+	start := time.Now()
+	log.Shutdown()
+	if deadline.Sub(start) > time.Second || time.Since(start) > time.Second {
+		t.Errorf("Expected the hooks to be bounded by the shutdown timeout, took %s", time.Since(start))
+	}
+}
+
+func TestPanicFlushes(t *testing.T) {
+	var codes []int
+	log, sink := newSinkLog(t, logger.Settings{ExitHandler: func(code int) { codes = append(codes, code) }})
+
+	defer func() {
+		if r := recover(); r != "Corrupt state" {
+			t.Errorf("Expected a panic with the message, got %v", r)
+		}
+		if !sink.flushed || len(codes) != 0 {
+			t.Errorf("Expected the outputs to be flushed without exiting, got %v", codes)
+		}
+	}()
+	log.Context(logger.Fields{"id": 1}).Panic("Corrupt state")
+}
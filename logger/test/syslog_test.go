@@ -0,0 +1,223 @@
+package test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+// rfc5424 matches a message with the fields of the test entry.
+var rfc5424 = regexp.MustCompile(`^<(\d+)>1 \S+ \S+ (\S+) \d+ - (\[.*\]|-) (.*)$`)
+
+func newSyslogLog(t *testing.T, output logger.Syslog) *logger.Log {
+	output.Level = "info"
+	output.AppName = "gia test"
+	log, err := logger.New(logger.Settings{Output: output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+// checkSyslogMessage checks a message logged by logSyslogMessage.
+func checkSyslogMessage(t *testing.T, msg string) {
+	m := rfc5424.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("Expected an RFC 5424 message, got %q", msg)
+	}
+	// local3 (19) * 8 + warning (4)
+	if m[1] != "156" {
+		t.Errorf("Expected priority 156, got %s", m[1])
+	}
+	if m[2] != "gia_test" {
+		t.Errorf("Expected the app name gia_test, got %s", m[2])
+	}
+	if m[3] != `[fields@32473 path="/static" quote="say \"hi\" \]"]` {
+		t.Errorf("Expected the fields as structured data, got %s", m[3])
+	}
+	if m[4] != "Slow request" {
+		t.Errorf("Expected the message, got %q", m[4])
+	}
+}
+
+func logSyslogMessage(log *logger.Log) {
+	log.Context(logger.Fields{"path": "/static", "quote": `say "hi" ]`}).Warn("Slow request")
+}
+
+// readFramed reads a message framed with its length from r.
+func readFramed(t *testing.T, r *bufio.Reader) string {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		t.Fatalf("Expected an octet count, got %q", length)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		t.Fatal(err)
+	}
+	return string(msg)
+}
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	log := newSyslogLog(t, logger.Syslog{Address: conn.LocalAddr().String(), Facility: "local3"})
+	logSyslogMessage(log)
+	log.Info("plain")
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyslogMessage(t, string(buf[:n]))
+
+	n, _, err = conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := rfc5424.FindStringSubmatch(string(buf[:n]))
+	if m == nil || m[1] != "158" || m[3] != "-" {
+		t.Errorf("Expected an info message without structured data, got %q", buf[:n])
+	}
+}
+
+// acceptOne accepts a connection, completing the handshake of TLS
+// connections, and returns a reader for it.
+func acceptOne(l net.Listener) chan *bufio.Reader {
+	accepted := make(chan *bufio.Reader, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if tlsConn, ok := conn.(*tls.Conn); ok {
+			tlsConn.Handshake()
+		}
+		accepted <- bufio.NewReader(conn)
+	}()
+	return accepted
+}
+
+func TestSyslogTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := acceptOne(l)
+
+	log := newSyslogLog(t, logger.Syslog{Network: "tcp", Address: l.Addr().String(), Facility: "local3"})
+	logSyslogMessage(log)
+	logSyslogMessage(log)
+
+	r := <-accepted
+	checkSyslogMessage(t, readFramed(t, r))
+	checkSyslogMessage(t, readFramed(t, r))
+}
+
+func TestSyslogClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := acceptOne(l)
+
+	log := newSyslogLog(t, logger.Syslog{Network: "tcp", Address: l.Addr().String(), Facility: "local3"})
+	logSyslogMessage(log)
+	r := <-accepted
+	checkSyslogMessage(t, readFramed(t, r))
+
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestSyslogTLS(t *testing.T) {
+	cert := selfSignedCertificate(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := acceptOne(l)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert.Leaf)
+	log := newSyslogLog(t, logger.Syslog{
+		Network:  "tls",
+		Address:  l.Addr().String(),
+		TLS:      &tls.Config{RootCAs: roots, ServerName: "localhost"},
+		Facility: "local3",
+	})
+	logSyslogMessage(log)
+
+	checkSyslogMessage(t, readFramed(t, <-accepted))
+}
+
+func TestSyslogInvalid(t *testing.T) {
+	outputs := map[string]logger.Syslog{
+		"network":  {Network: "carrier-pigeon"},
+		"facility": {Facility: "office"},
+		"refused":  {Network: "tcp", Address: "127.0.0.1:1"},
+	}
+	for name, output := range outputs {
+		if _, err := logger.New(logger.Settings{Output: output}); err == nil {
+			t.Errorf("Expected an error for the %s", name)
+		}
+	}
+}
+
+// selfSignedCertificate returns a certificate for localhost.
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
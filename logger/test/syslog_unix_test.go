@@ -0,0 +1,131 @@
+//go:build !windows
+// +build !windows
+
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+// listenUnixgram listens on a datagram socket in a temporary directory.
+func listenUnixgram(t *testing.T) (*net.UnixConn, string, func()) {
+	dir, err := ioutil.TempDir("", "logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	return conn, path, func() {
+		conn.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSyslogUnixgram(t *testing.T) {
+	conn, path, done := listenUnixgram(t)
+	defer done()
+
+	log := newSyslogLog(t, logger.Syslog{Network: "unixgram", Address: path, Facility: "local3"})
+	logSyslogMessage(log)
+
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSyslogMessage(t, string(buf[:n]))
+}
+
+// journalFields parses a datagram of the journald native protocol.
+func journalFields(t *testing.T, datagram []byte) map[string]string {
+	fields := map[string]string{}
+	for len(datagram) > 0 {
+		i := bytes.IndexByte(datagram, '\n')
+		if i < 0 {
+			t.Fatalf("Expected a newline terminated field, got %q", datagram)
+		}
+		line := string(datagram[:i])
+		datagram = datagram[i+1:]
+
+		if eq := bytes.IndexByte([]byte(line), '='); eq >= 0 {
+			fields[line[:eq]] = line[eq+1:]
+			continue
+		}
+		n := binary.LittleEndian.Uint64(datagram[:8])
+		fields[line] = string(datagram[8 : 8+n])
+		datagram = datagram[8+n+1:]
+	}
+	return fields
+}
+
+func TestJournald(t *testing.T) {
+	conn, path, done := listenUnixgram(t)
+	defer done()
+
+	log, err := logger.New(logger.Settings{
+		Output: logger.Journald{Level: "info", Socket: path, Identifier: "gia"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Context(logger.Fields{"request_id": 42, "message": "shadowed", "2fa": true}).Error("Login failed\nfor admin")
+
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"MESSAGE":           "Login failed\nfor admin",
+		"PRIORITY":          "3",
+		"SYSLOG_IDENTIFIER": "gia",
+		"REQUEST_ID":        "42",
+		"F_MESSAGE":         "shadowed",
+		"F_2FA":             "true",
+	}
+	fields := journalFields(t, buf[:n])
+	if len(fields) != len(expected) {
+		t.Errorf("Expected %v, got %v", expected, fields)
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("Expected %s=%q, got %q", k, v, fields[k])
+		}
+	}
+}
+
+func TestJournaldClose(t *testing.T) {
+	_, path, done := listenUnixgram(t)
+	defer done()
+
+	log, err := logger.New(logger.Settings{Output: logger.Journald{Socket: path}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournaldMissingSocket(t *testing.T) {
+	_, err := logger.New(logger.Settings{Output: logger.Journald{Socket: "/nonexistent/journal/socket"}})
+	if err == nil {
+		t.Error("Expected an error for a missing socket")
+	}
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+type point struct {
+	X, Y int
+}
+
+func TestTraceEvent(t *testing.T) {
+	var buf bytes.Buffer
+	log, _ := newSinkLog(t, logger.Settings{Trace: true, Tracer: logger.NewWriterTracer(&buf, false)})
+	log.Named("webserver").Trace("Matched route", "/users", 42)
+
+	header := regexp.MustCompile(`^TRCE \d\d:\d\d:\d\d\.\d{6} goroutine [1-9]\d* \S*tracer_test\.go:\d+ \[webserver\] Matched route\n`)
+	if !header.MatchString(buf.String()) {
+		t.Errorf("Expected the time, goroutine, caller and module, got %q", buf.String())
+	}
+	if !strings.HasSuffix(buf.String(), "\t* /users\n\t* 42\n") {
+		t.Errorf("Expected the messages, got %q", buf.String())
+	}
+}
+
+func TestTraceModules(t *testing.T) {
+	var buf bytes.Buffer
+	log, _ := newSinkLog(t, logger.Settings{Tracer: logger.NewWriterTracer(&buf, false), TraceModules: map[string]bool{"webserver": true, "webserver.router": false}})
+
+	log.Trace("root")
+	log.Named("webserver").Named("render").Trace("render")
+	log.Named("webserver").Named("router").Trace("router")
+	if !log.Named("webserver").Tracing() || log.Tracing() {
+		t.Error("Expected Tracing to follow the module settings")
+	}
+
+	log.SetModuleTracing("webserver.router", true)
+	log.ResetModuleTracing("webserver")
+	log.Named("webserver").Trace("webserver")
+	log.Named("webserver").Named("router").Trace("router again")
+
+	traced := regexp.MustCompile(`(?m) (\w+( again)?)$`).FindAllStringSubmatch(buf.String(), -1)
+	var titles []string
+	for _, m := range traced {
+		titles = append(titles, m[1])
+	}
+	if strings.Join(titles, ",") != "render,router again" {
+		t.Errorf("Expected only the enabled modules to be traced, got %v", titles)
+	}
+}
+
+func TestTraceDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	log, _ := newSinkLog(t, logger.Settings{Tracer: logger.NewWriterTracer(&buf, false)})
+	log.Trace("hidden", point{1, 2})
+	if buf.Len() != 0 || log.Tracing() {
+		t.Errorf("Expected nothing to be traced, got %q", buf.String())
+	}
+
+	log.SetTracing(true)
+	log.Trace("shown")
+	if !strings.Contains(buf.String(), "shown") {
+		t.Errorf("Expected tracing to be enabled at runtime, got %q", buf.String())
+	}
+}
+
+func TestTracePerLog(t *testing.T) {
+	var firstBuf, secondBuf bytes.Buffer
+	first, _ := newSinkLog(t, logger.Settings{Trace: true, Tracer: logger.NewWriterTracer(&firstBuf, false)})
+	newSinkLog(t, logger.Settings{Tracer: logger.NewWriterTracer(&secondBuf, false)})
+
+	first.Trace("still traced")
+	if !strings.Contains(firstBuf.String(), "still traced") {
+		t.Error("Expected creating another Log not to disable tracing")
+	}
+}
+
+func TestTraceDeep(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := logger.NewWriterTracer(&buf, true)
+	tracer.Trace("dump", []interface{}{&point{X: 1, Y: 2}})
+
+	if !strings.Contains(buf.String(), "(*test.point)") || !strings.Contains(buf.String(), "X: (int) 1") {
+		t.Errorf("Expected a deep dump with types, got %q", buf.String())
+	}
+}
+
+func BenchmarkTraceDisabled(b *testing.B) {
+	log, err := logger.New(logger.Settings{Output: logger.Stdiscard{}})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		log.Trace("disabled")
+	}
+}
+
+func TestTraceRedacted(t *testing.T) {
+	var buf bytes.Buffer
+	log, _ := newSinkLog(t, logger.Settings{
+		Trace:  true,
+		Tracer: logger.NewWriterTracer(&buf, false),
+		Redaction: logger.RedactionSettings{
+			Fields:   []string{"password"},
+			Patterns: []string{`\d{4}-\d{4}`},
+		},
+	})
+	log.Trace("Card 1234-5678", map[string]string{"password": "secret"}, logger.Sensitive("token"), "plain")
+
+	out := buf.String()
+	for _, leaked := range []string{"1234-5678", "secret", "token"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("Expected %q to be redacted, got %q", leaked, out)
+		}
+	}
+	if !strings.Contains(out, "plain") {
+		t.Errorf("Expected the other messages to be kept, got %q", out)
+	}
+}
@@ -1,6 +1,18 @@
 package logger
 
-import "fmt"
+import (
+  "bytes"
+  "fmt"
+  "io"
+  "runtime"
+  "strconv"
+  "strings"
+  "sync"
+  "sync/atomic"
+  "time"
+
+  "github.com/davecgh/go-spew/spew"
+)
 
 const (
   escape = "\x1b"
@@ -9,6 +21,9 @@ const (
   blue   = "1;34"
 )
 
+// traceTimeFormat is the default layout of the time of a trace.
+const traceTimeFormat = "15:04:05.000000"
+
 type (
 // Tracer accepts low-level debugging information and its implementations
 // decide what to do with the messages it receives
@@ -16,6 +31,25 @@ type (
     Trace(title string, messages []interface{})
   }
 
+// EventTracer is implemented by tracers which also want to know when, where
+// and on which goroutine Log.Trace was called. Log.Trace calls TraceEvent
+// instead of Trace for them.
+  EventTracer interface {
+    Tracer
+    TraceEvent(event TraceEvent)
+  }
+
+// TraceEvent is a call to Log.Trace. Caller is the file and line of the call
+// and Module the name of the named logger, if any.
+  TraceEvent struct {
+    Time      time.Time
+    Goroutine uint64
+    Caller    string
+    Module    string
+    Title     string
+    Messages  []interface{}
+  }
+
 // NilTracer implements the Tracer interface and is used for discarding traces.
 // This implementation is usually used in production to discard debug info.
   NilTracer struct{}
@@ -24,6 +58,32 @@ type (
 // trace information to stdout (standard output). This is useful when needing
 // verbose debug information.
   StdOutTracer struct{}
+
+// WriterTracer implements the EventTracer interface and writes traces to any
+// io.Writer, such as a file, one trace per Write. Create it with
+// NewWriterTracer.
+  WriterTracer struct {
+    mu  sync.Mutex
+    out io.Writer
+    // Deep dumps messages with spew, following pointers and showing types
+    // like Context.Dump, instead of formatting them with %+v.
+    Deep bool
+    // TimeFormat is the layout of the time of a trace. The default is
+    // 15:04:05.000000.
+    TimeFormat string
+  }
+
+// traceRegistry holds the tracer of a Log and whether tracing is enabled for
+// the Log and its named loggers.
+  traceRegistry struct {
+    sync.RWMutex
+    tracer  Tracer
+    enabled bool
+    modules map[string]bool
+    // active is 1 while tracing is enabled for the Log or any module, so
+    // Trace only costs an atomic load while tracing is disabled.
+    active  int32
+  }
 )
 
 // Trace for NilTracer will simply do nothing and return.
@@ -42,3 +102,211 @@ func (t StdOutTracer) Trace(title string, messages []interface{}) {
     }
   }
 }
+
+// TraceEvent for StdOutTracer outputs the trace like Trace, with the time,
+// goroutine and caller following TRCE.
+func (t StdOutTracer) TraceEvent(event TraceEvent) {
+  fmt.Printf("%s[%smTRCE%s[0m %s %s\n", escape, red, escape, event.Time.Format(traceTimeFormat), traceOrigin(event))
+  fmt.Printf("\t%s[%sm%s:%s[0m\n\n", escape, blue, event.Title, escape)
+  for i, m := range event.Messages {
+    fmt.Printf("\t\t%s[%sm* %s[0m%+v\n", escape, green, escape, m)
+    if i+1 == len(event.Messages) {
+      fmt.Printf("\n")
+    }
+  }
+}
+
+// NewWriterTracer returns a tracer writing to out. deep dumps messages with
+// spew.
+func NewWriterTracer(out io.Writer, deep bool) *WriterTracer {
+  return &WriterTracer{out: out, Deep: deep}
+}
+
+// Trace writes a trace without the time, goroutine and caller.
+func (t *WriterTracer) Trace(title string, messages []interface{}) {
+  t.write("", title, messages)
+}
+
+// TraceEvent writes the time, goroutine, caller and module of the trace
+// followed by its title and messages.
+func (t *WriterTracer) TraceEvent(event TraceEvent) {
+  timeFormat := t.TimeFormat
+  if timeFormat == "" {
+    timeFormat = traceTimeFormat
+  }
+  t.write(event.Time.Format(timeFormat) + " " + traceOrigin(event) + " ", event.Title, event.Messages)
+}
+
+func (t *WriterTracer) write(prefix string, title string, messages []interface{}) {
+  var b bytes.Buffer
+  b.WriteString("TRCE " + prefix + title + "\n")
+  for _, m := range messages {
+    if t.Deep {
+      b.WriteString(indent(spew.Sdump(m), "\t"))
+    } else {
+      fmt.Fprintf(&b, "\t* %+v\n", m)
+    }
+  }
+
+  t.mu.Lock()
+  defer t.mu.Unlock()
+
+  if _, err := t.out.Write(b.Bytes()); err != nil {
+    reportWriteError(err)
+  }
+}
+
+// traceOrigin describes the goroutine, caller and module of event.
+func traceOrigin(event TraceEvent) string {
+  origin := "goroutine " + strconv.FormatUint(event.Goroutine, 10) + " " + event.Caller
+  if event.Module != "" {
+    origin += " [" + event.Module + "]"
+  }
+  return origin
+}
+
+// indent prefixes every line of s.
+func indent(s string, prefix string) string {
+  lines := strings.SplitAfter(s, "\n")
+  for i, line := range lines {
+    if line != "" {
+      lines[i] = prefix + line
+    }
+  }
+  return strings.Join(lines, "")
+}
+
+func newTraceRegistry(settings Settings) *traceRegistry {
+  r := &traceRegistry{
+    tracer:  settings.Tracer,
+    enabled: settings.Trace,
+    modules: make(map[string]bool, len(settings.TraceModules)),
+  }
+  if r.tracer == nil {
+    r.tracer = StdOutTracer{}
+  }
+  for module, enabled := range settings.TraceModules {
+    r.modules[module] = enabled
+  }
+  r.update()
+
+  return r
+}
+
+// update stores whether tracing is enabled anywhere. It must be called with
+// the lock held, or before the registry is shared.
+func (r *traceRegistry) update() {
+  active := r.enabled
+  for _, enabled := range r.modules {
+    active = active || enabled
+  }
+  if active {
+    atomic.StoreInt32(&r.active, 1)
+  } else {
+    atomic.StoreInt32(&r.active, 0)
+  }
+}
+
+// on reports whether tracing is enabled for the named logger: the setting of
+// the closest module, "webserver" for "webserver.render", or of the Log.
+func (r *traceRegistry) on(name string) bool {
+  if atomic.LoadInt32(&r.active) == 0 {
+    return false
+  }
+
+  r.RLock()
+  defer r.RUnlock()
+
+  for name != "" {
+    if enabled, ok := r.modules[name]; ok {
+      return enabled
+    }
+    i := strings.LastIndex(name, ".")
+    if i < 0 {
+      break
+    }
+    name = name[:i]
+  }
+
+  return r.enabled
+}
+
+// Tracing reports whether Trace sends traces to the tracer for l, so callers
+// can skip preparing expensive arguments.
+func (l *Log) Tracing() bool {
+  return l.tracing.on(l.name)
+}
+
+// SetTracing enables or disables tracing for the Log and every named logger
+// without a setting of its own. It is safe to call while logging.
+func (l *Log) SetTracing(enabled bool) {
+  l.tracing.Lock()
+  defer l.tracing.Unlock()
+
+  l.tracing.enabled = enabled
+  l.tracing.update()
+}
+
+// SetModuleTracing enables or disables tracing for the named logger and its
+// children, for example "webserver" also covers "webserver.render".
+func (l *Log) SetModuleTracing(module string, enabled bool) {
+  l.tracing.Lock()
+  defer l.tracing.Unlock()
+
+  l.tracing.modules[module] = enabled
+  l.tracing.update()
+}
+
+// ResetModuleTracing removes the tracing setting of the named logger so it
+// follows its parent module or the Log again.
+func (l *Log) ResetModuleTracing(module string) {
+  l.tracing.Lock()
+  defer l.tracing.Unlock()
+
+  delete(l.tracing.modules, module)
+  l.tracing.update()
+}
+
+// trace hands a call to Trace to the tracer. Like write, it must be called
+// directly by the exported Trace method so the caller is found at a fixed
+// depth. The title and args are redacted as write redacts messages.
+func (l *Log) trace(title string, args []interface{}) {
+  if l.redactor != nil {
+    title = l.redactor.message(title)
+    args = l.redactor.values(args)
+  }
+
+  tracer := l.tracing.tracer
+  eventTracer, ok := tracer.(EventTracer)
+  if !ok {
+    tracer.Trace(title, args)
+    return
+  }
+
+  now := time.Now()
+  if l.location != nil {
+    now = now.In(l.location)
+  }
+  file, line := getCaller(3)
+  eventTracer.TraceEvent(TraceEvent{
+    Time:      now,
+    Goroutine: goroutineID(),
+    Caller:    shortenCaller(file) + ":" + strconv.Itoa(line),
+    Module:    l.name,
+    Title:     title,
+    Messages:  args,
+  })
+}
+
+// goroutineID returns the ID of the calling goroutine, read from the header
+// of its stack trace, "goroutine 18 [running]:".
+func goroutineID() uint64 {
+  var buf [64]byte
+  n := runtime.Stack(buf[:], false)
+  fields := bytes.Fields(buf[:n])
+  if len(fields) < 2 {
+    return 0
+  }
+  id, _ := strconv.ParseUint(string(fields[1]), 10, 64)
+  return id
+}
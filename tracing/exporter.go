@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+type (
+	// WriterExporter writes each span as a line of JSON and is intended for
+	// local development.
+	WriterExporter struct {
+		sync.Mutex
+		out    *bufio.Writer
+		closer io.Closer
+	}
+
+	// NilExporter discards every span.
+	NilExporter struct{}
+)
+
+// NewStdoutExporter returns an exporter writing spans to os.Stdout.
+func NewStdoutExporter() *WriterExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+// NewFileExporter returns an exporter appending spans to the file at path.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	e := NewWriterExporter(f)
+	e.closer = f
+	return e, nil
+}
+
+// NewWriterExporter returns an exporter writing spans to w.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{out: bufio.NewWriter(w)}
+}
+
+// ExportSpan writes the span as a single line of JSON.
+func (e *WriterExporter) ExportSpan(span SpanData) {
+	line, err := json.Marshal(span)
+	if err != nil {
+		return
+	}
+
+	e.Lock()
+	e.out.Write(line)
+	e.out.WriteByte('\n')
+	e.out.Flush()
+	e.Unlock()
+}
+
+// Flush writes any buffered spans.
+func (e *WriterExporter) Flush() error {
+	e.Lock()
+	defer e.Unlock()
+	return e.out.Flush()
+}
+
+// Close flushes and closes the underlying file, if any.
+func (e *WriterExporter) Close() error {
+	if err := e.Flush(); err != nil {
+		return err
+	}
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// ExportSpan for NilExporter does nothing.
+func (NilExporter) ExportSpan(SpanData) {}
+
+// Flush for NilExporter does nothing.
+func (NilExporter) Flush() error { return nil }
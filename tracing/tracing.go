@@ -0,0 +1,394 @@
+// Package tracing provides distributed tracing using the W3C Trace Context
+// headers. Spans are created by a Tracer, carried in a context.Context and
+// handed to a pluggable Exporter once they end.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+)
+
+const (
+	// TraceparentHeader carries the trace and parent span IDs.
+	TraceparentHeader = "traceparent"
+	// TracestateHeader carries vendor specific trace information.
+	TracestateHeader = "tracestate"
+
+	// FlagSampled is set when the trace is being recorded.
+	FlagSampled byte = 0x01
+
+	// SpanKindServer marks a span handling an incoming request.
+	SpanKindServer = "server"
+	// SpanKindInternal marks a span for work within a process.
+	SpanKindInternal = "internal"
+	// SpanKindClient marks a span for an outgoing request.
+	SpanKindClient = "client"
+
+	// StatusUnset is the status of a span that did not report an outcome.
+	StatusUnset = "unset"
+	// StatusOK is the status of a span that completed successfully.
+	StatusOK = "ok"
+	// StatusError is the status of a span that failed.
+	StatusError = "error"
+
+	// maxTracestateMembers is the limit of list members defined by the spec.
+	maxTracestateMembers = 32
+)
+
+var (
+	// ErrTraceparentInvalid is returned when a traceparent header can not be
+	// parsed.
+	ErrTraceparentInvalid = errors.New("Invalid traceparent header.")
+)
+
+type (
+	// TraceID identifies a trace across every service it touches.
+	TraceID [16]byte
+
+	// SpanID identifies a span within a trace.
+	SpanID [8]byte
+
+	// SpanContext is the portion of a span propagated between services.
+	SpanContext struct {
+		TraceID    TraceID
+		SpanID     SpanID
+		Flags      byte
+		TraceState string
+		// Remote is true when the context was extracted from a request.
+		Remote bool
+	}
+
+	// SpanData is the immutable record of an ended span handed to exporters.
+	SpanData struct {
+		Name         string                 `json:"name"`
+		Kind         string                 `json:"kind"`
+		TraceID      string                 `json:"traceId"`
+		SpanID       string                 `json:"spanId"`
+		ParentSpanID string                 `json:"parentSpanId,omitempty"`
+		TraceState   string                 `json:"traceState,omitempty"`
+		Start        time.Time              `json:"start"`
+		End          time.Time              `json:"end"`
+		DurationMs   float64                `json:"durationMs"`
+		Status       string                 `json:"status"`
+		StatusText   string                 `json:"statusText,omitempty"`
+		Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	}
+
+	// Exporter receives spans once they end. Implementations must be safe for
+	// concurrent use.
+	Exporter interface {
+		ExportSpan(span SpanData)
+		// Flush writes any buffered spans.
+		Flush() error
+	}
+
+	// Tracer creates spans and hands them to its Exporter.
+	Tracer struct {
+		exporter Exporter
+	}
+
+	// Span records a unit of work. A Span is safe for concurrent use.
+	Span struct {
+		sync.Mutex
+		tracer     *Tracer
+		name       string
+		kind       string
+		context    SpanContext
+		parent     SpanID
+		start      time.Time
+		end        time.Time
+		status     string
+		statusText string
+		attributes map[string]interface{}
+	}
+
+	spanKey struct{}
+)
+
+// NewTracer returns a Tracer exporting spans to the provided Exporter. A nil
+// exporter discards spans like NilExporter.
+func NewTracer(exporter Exporter) *Tracer {
+	if exporter == nil {
+		exporter = NilExporter{}
+	}
+	return &Tracer{exporter: exporter}
+}
+
+// Start begins a span. If parent is valid the span joins its trace, otherwise
+// a new sampled trace is started.
+func (t *Tracer) Start(name string, kind string, parent SpanContext) *Span {
+	s := &Span{
+		tracer:     t,
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		status:     StatusUnset,
+		attributes: make(map[string]interface{}),
+	}
+
+	if parent.IsValid() {
+		s.context.TraceID = parent.TraceID
+		s.context.Flags = parent.Flags
+		s.context.TraceState = parent.TraceState
+		s.parent = parent.SpanID
+	} else {
+		rand.Read(s.context.TraceID[:])
+		s.context.Flags = FlagSampled
+	}
+	rand.Read(s.context.SpanID[:])
+
+	return s
+}
+
+// Flush flushes the exporter.
+func (t *Tracer) Flush() error {
+	if t.exporter == nil {
+		return nil
+	}
+	return t.exporter.Flush()
+}
+
+// StartChild begins a span whose parent is this span.
+func (s *Span) StartChild(name string, kind string) *Span {
+	return s.tracer.Start(name, kind, s.Context())
+}
+
+// Context returns the SpanContext to propagate to child spans and services.
+func (s *Span) Context() SpanContext {
+	return s.context
+}
+
+// SetName replaces the name of the span, for example once the route of a
+// request is known.
+func (s *Span) SetName(name string) {
+	s.Lock()
+	s.name = name
+	s.Unlock()
+}
+
+// SetAttribute records a key/value pair on the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.Lock()
+	s.attributes[key] = value
+	s.Unlock()
+}
+
+// SetStatus records the outcome of the span.
+func (s *Span) SetStatus(status string, text string) {
+	s.Lock()
+	s.status = status
+	s.statusText = text
+	s.Unlock()
+}
+
+// End completes the span and exports it if the trace is sampled. Calling End
+// more than once has no effect.
+func (s *Span) End() {
+	s.Lock()
+	if !s.end.IsZero() {
+		s.Unlock()
+		return
+	}
+	s.end = time.Now()
+	data := s.data()
+	s.Unlock()
+
+	if s.context.IsSampled() && s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpan(data)
+	}
+}
+
+// Fields returns the trace and span IDs for use with logger.Context so log
+// entries can be correlated with traces.
+func (s *Span) Fields() logger.Fields {
+	return logger.Fields{
+		"traceId": s.context.TraceID.String(),
+		"spanId":  s.context.SpanID.String(),
+	}
+}
+
+// data returns a snapshot of the span. The caller must hold the lock.
+func (s *Span) data() SpanData {
+	attributes := make(map[string]interface{}, len(s.attributes))
+	for k, v := range s.attributes {
+		attributes[k] = v
+	}
+
+	d := SpanData{
+		Name:       s.name,
+		Kind:       s.kind,
+		TraceID:    s.context.TraceID.String(),
+		SpanID:     s.context.SpanID.String(),
+		TraceState: s.context.TraceState,
+		Start:      s.start,
+		End:        s.end,
+		DurationMs: float64(s.end.Sub(s.start)) / float64(time.Millisecond),
+		Status:     s.status,
+		StatusText: s.statusText,
+		Attributes: attributes,
+	}
+	if s.parent.IsValid() {
+		d.ParentSpanID = s.parent.String()
+	}
+
+	return d
+}
+
+// *****************************************************************************
+// Identifiers
+// *****************************************************************************
+
+// String returns the lowercase hex encoding of the trace ID.
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid returns false for the all zero trace ID.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// String returns the lowercase hex encoding of the span ID.
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid returns false for the all zero span ID.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// IsValid returns true if both the trace and span IDs are valid.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled returns true if the trace is being recorded.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagSampled == FlagSampled
+}
+
+// Traceparent returns the traceparent header value for the span context.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// *****************************************************************************
+// Propagation
+// *****************************************************************************
+
+// ParseTraceparent parses a traceparent header value. Versions newer than 00
+// are accepted as long as their leading fields follow the version 00 format.
+func ParseTraceparent(header string) (SpanContext, error) {
+	var sc SpanContext
+
+	header = strings.TrimSpace(header)
+	if len(header) < 55 {
+		return sc, ErrTraceparentInvalid
+	}
+
+	version, err := hex.DecodeString(header[0:2])
+	if err != nil || version[0] == 0xff || header[0:2] != strings.ToLower(header[0:2]) {
+		return sc, ErrTraceparentInvalid
+	}
+	if version[0] == 0 && len(header) != 55 {
+		return sc, ErrTraceparentInvalid
+	}
+	if len(header) > 55 && header[55] != '-' {
+		return sc, ErrTraceparentInvalid
+	}
+	if header[2] != '-' || header[35] != '-' || header[52] != '-' {
+		return sc, ErrTraceparentInvalid
+	}
+
+	if !decodeLowerHex(sc.TraceID[:], header[3:35]) ||
+		!decodeLowerHex(sc.SpanID[:], header[36:52]) {
+		return sc, ErrTraceparentInvalid
+	}
+	var flags [1]byte
+	if !decodeLowerHex(flags[:], header[53:55]) {
+		return sc, ErrTraceparentInvalid
+	}
+	sc.Flags = flags[0]
+
+	if !sc.IsValid() {
+		return sc, ErrTraceparentInvalid
+	}
+
+	return sc, nil
+}
+
+// decodeLowerHex decodes s into dst, rejecting uppercase hex as the spec
+// requires.
+func decodeLowerHex(dst []byte, s string) bool {
+	if s != strings.ToLower(s) {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// parseTracestate returns the tracestate header with empty members removed,
+// or an empty string if it exceeds the member limit or is malformed.
+func parseTracestate(header string) string {
+	members := []string{}
+	for _, member := range strings.Split(header, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+		if !strings.Contains(member, "=") {
+			return ""
+		}
+		members = append(members, member)
+	}
+	if len(members) > maxTracestateMembers {
+		return ""
+	}
+	return strings.Join(members, ",")
+}
+
+// Extract reads the span context from the traceparent and tracestate
+// headers. The second return value is false if no valid context was found.
+func Extract(header http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceparent(header.Get(TraceparentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.TraceState = parseTracestate(strings.Join(header[http.CanonicalHeaderKey(TracestateHeader)], ","))
+	sc.Remote = true
+	return sc, true
+}
+
+// Inject writes the span context to the traceparent and tracestate headers so
+// outgoing requests continue the trace.
+func Inject(header http.Header, sc SpanContext) {
+	if !sc.IsValid() {
+		return
+	}
+	header.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set(TracestateHeader, sc.TraceState)
+	} else {
+		header.Del(TracestateHeader)
+	}
+}
+
+// NewContext returns a copy of ctx carrying the span.
+func NewContext(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// FromContext returns the span carried by ctx or nil.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
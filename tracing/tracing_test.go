@@ -0,0 +1,89 @@
+package tracing_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/tracing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		header string
+		valid  bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		sc, err := tracing.ParseTraceparent(test.header)
+		if test.valid && err != nil {
+			t.Errorf("%q: unexpected error %v", test.header, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%q: expected an error", test.header)
+		}
+		if test.valid && sc.Traceparent()[3:52] != test.header[3:52] {
+			t.Errorf("%q: round trip produced %q", test.header, sc.Traceparent())
+		}
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := tracing.NewTracer(tracing.NewWriterExporter(&buf))
+
+	in := http.Header{}
+	in.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	in.Add("tracestate", "congo=t61rcWkgMzE")
+	in.Add("tracestate", "rojo=00f067aa0ba902b7")
+
+	parent, ok := tracing.Extract(in)
+	if !ok {
+		t.Fatal("Expected a valid span context")
+	}
+
+	span := tracer.Start("GET /", tracing.SpanKindServer, parent)
+	child := span.StartChild("handler", tracing.SpanKindInternal)
+
+	out := http.Header{}
+	tracing.Inject(out, child.Context())
+	if out.Get("tracestate") != "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7" {
+		t.Errorf("Unexpected tracestate %q", out.Get("tracestate"))
+	}
+
+	propagated, ok := tracing.Extract(out)
+	if !ok || propagated.TraceID != parent.TraceID || propagated.SpanID != child.Context().SpanID {
+		t.Errorf("Unexpected propagated context %+v", propagated)
+	}
+
+	child.End()
+	span.End()
+
+	var data tracing.SpanData
+	if err := json.NewDecoder(&buf).Decode(&data); err != nil {
+		t.Fatal("Error", err)
+	}
+	if data.Name != "handler" || data.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || data.ParentSpanID != span.Context().SpanID.String() {
+		t.Errorf("Unexpected exported span %+v", data)
+	}
+}
+
+func TestNilExporter(t *testing.T) {
+	tracer := tracing.NewTracer(nil)
+	tracer.Start("request", tracing.SpanKindServer, tracing.SpanContext{}).End()
+	if err := tracer.Flush(); err != nil {
+		t.Errorf("Expected a nil exporter to discard spans, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package webserver
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/tracing"
+)
+
+// AccessLogConventions configures the "Request complete" entry logged for
+// every request, at the debug level or, once a request takes longer than
+// RequestDurationWarning, at the warn level.
+type AccessLogConventions struct {
+	// Headers logs the request headers as the headers field.
+	Headers bool
+	// RedactHeaders lists the request headers, compared case-insensitively,
+	// whose values are logged as logger.Redacted.
+	RedactHeaders []string
+	// RedactQueryParams lists the query parameters, compared
+	// case-insensitively, whose values are logged as logger.Redacted.
+	RedactQueryParams []string
+}
+
+// logRequest logs the access log entry of a request served since start.
+func (s *Server) logRequest(w http.ResponseWriter, req *http.Request, span *tracing.Span, start time.Time) {
+	duration := time.Since(start)
+	conventions := s.settings.AccessLog
+
+	fields := logger.Fields{
+		"method":      req.Method,
+		"requestPath": req.URL.Path,
+		"duration":    duration.Seconds(),
+	}
+	if iw, ok := w.(*instrumentedResponseWriter); ok {
+		status := iw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		fields["status"] = status
+		fields["size"] = iw.size
+		fields["route"] = iw.route
+	}
+	if req.URL.RawQuery != "" {
+		fields["query"] = redactQuery(req.URL.Query(), conventions.RedactQueryParams)
+	}
+	if conventions.Headers {
+		fields["headers"] = redactHeaders(req.Header, conventions.RedactHeaders)
+	}
+
+	log := s.logger.Context(spanFields(span, fields))
+	if duration >= s.settings.RequestDurationWarning {
+		log.Warn("Request complete")
+	} else {
+		log.Debug("Request complete")
+	}
+}
+
+// redactQuery encodes query, sorted by parameter, with the values of the
+// redacted parameters replaced.
+func redactQuery(query url.Values, redacted []string) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		redact := containsFold(redacted, k)
+		for _, v := range query[k] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(k) + "=")
+			if redact {
+				b.WriteString(logger.Redacted)
+			} else {
+				b.WriteString(url.QueryEscape(v))
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// redactHeaders returns the values of header by name, with the values of the
+// redacted headers replaced.
+func redactHeaders(header http.Header, redacted []string) map[string]string {
+	headers := make(map[string]string, len(header))
+	for k, v := range header {
+		if containsFold(redacted, k) {
+			headers[k] = logger.Redacted
+		} else {
+			headers[k] = strings.Join(v, ", ")
+		}
+	}
+	return headers
+}
+
+// containsFold reports whether names contains name, ignoring case.
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package webserver_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Access log", func() {
+	var (
+		server *webserver.Server
+		log    *logger.MockLog
+	)
+
+	BeforeEach(func() {
+		var err error
+		log, err = logger.NewLogMock(logger.Settings{Output: logger.Stdout{Level: "debug"}})
+		Expect(err).NotTo(HaveOccurred())
+		server = webserver.New(log)
+		server.GET("/orders/{id}", func(ctx *context.Context) {
+			ctx.ResponseWriter.WriteHeader(http.StatusAccepted)
+		})
+	})
+
+	It("logs the completed request with redacted headers and query parameters", func() {
+		req := httptest.NewRequest(webserver.GET, "/orders/7?access_token=s3cret&page=2", nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		req.Header.Set("Cookie", "session=s3cret")
+		req.Header.Set("Accept", "text/html")
+		server.ServeHTTP(httptest.NewRecorder(), req)
+
+		Expect(log.HasEntry(logger.DebugLevel, "Request complete", logger.Fields{
+			"method":      "GET",
+			"requestPath": "/orders/7",
+			"route":       "/orders/{id}",
+			"status":      http.StatusAccepted,
+			"query":       "access_token=[REDACTED]&page=2",
+			"headers": map[string]string{
+				"Authorization": logger.Redacted,
+				"Cookie":        logger.Redacted,
+				"Accept":        "text/html",
+			},
+		})).To(BeTrue(), "%v", log.Entries())
+	})
+
+	It("warns about slow requests and honours configured parameters", func() {
+		conventions := webserver.Settings
+		conventions.RequestDurationWarning = time.Nanosecond
+		conventions.AccessLog = webserver.AccessLogConventions{RedactQueryParams: []string{"Page"}}
+		server = webserver.New(log, webserver.WithConventions(conventions))
+		server.GET("/slow", func(ctx *context.Context) {
+			time.Sleep(time.Millisecond)
+		})
+
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(webserver.GET, "/slow?page=2", nil))
+
+		entries := log.FindEntries(logger.WarnLevel, "Request complete", nil)
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Fields["query"]).To(Equal("page=[REDACTED]"))
+		Expect(entries[0].Fields).NotTo(HaveKey("headers"))
+	})
+})
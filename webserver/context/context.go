@@ -1,8 +1,10 @@
 package context
 
 import (
+	"html/template"
 	"net/http"
 
+	"github.com/go-gia/go-infrastructure/logger"
 	"github.com/go-gia/go-infrastructure/webserver/render"
 
 	"github.com/davecgh/go-spew/spew"
@@ -22,6 +24,9 @@ type Context struct {
 	BreakHandlerChain bool
 
 	renderer render.Renderer
+	// funcs holds request scoped template helpers bound by handlers such as
+	// the CSRF PreHandler.
+	funcs template.FuncMap
 
 	Input          *Input
 	Output         *Output
@@ -101,7 +106,12 @@ func (c *Context) HTML(output string) error {
 // HTMLTemplate renders the HTML view specified by it's filename omitting the file extension.
 func (c *Context) HTMLTemplate(name string, args interface{}) error {
 
-	content, err := render.HTML.Render(name, args)
+	var renderer render.Renderer = render.HTML
+	if c.renderer != nil {
+		renderer = c.renderer
+	}
+
+	content, err := renderer.RenderWithFuncs(name, c.funcs, args)
 	if err != nil {
 		return err
 	}
@@ -112,6 +122,32 @@ func (c *Context) HTMLTemplate(name string, args interface{}) error {
 	return nil
 }
 
+// SetRenderer replaces the renderer used by HTMLTemplate. By default the
+// package level render.HTML is used.
+func (c *Context) SetRenderer(r render.Renderer) {
+	c.renderer = r
+}
+
+// SetTemplateFuncs binds request scoped helper functions for any template
+// rendered with HTMLTemplate during this request. The names must already be
+// declared in render.Funcs.
+func (c *Context) SetTemplateFuncs(funcs template.FuncMap) {
+	if c.funcs == nil {
+		c.funcs = template.FuncMap{}
+	}
+	for name, fn := range funcs {
+		c.funcs[name] = fn
+	}
+}
+
+// Logger returns the logger of the request. For requests routed by the
+// webserver it carries the method, route, request path and client IP, along
+// with the request ID and trace IDs when present; handlers add their own
+// fields with With.
+func (c *Context) Logger() logger.ContextualLogger {
+	return logger.FromContext(c.Request.Context())
+}
+
 // Dump spews the provided value to the stdout and is useful for debugging.
 func (c *Context) Dump(v interface{}) {
 	spew.Dump(v)
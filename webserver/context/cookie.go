@@ -0,0 +1,262 @@
+package context
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// CookieConventions defines the defaults applied to cookies written through
+	// Output. The defaults are secure: cookies are scoped to the root path,
+	// hidden from JavaScript, only sent over HTTPS and not sent with cross-site
+	// requests other than top level navigation.
+	CookieConventions struct {
+		Path     string
+		Domain   string
+		MaxAge   int
+		Secure   bool
+		HTTPOnly bool
+		SameSite http.SameSite
+		// Keys lists the secrets used to sign and encrypt cookies. The first key
+		// signs and encrypts new cookies while every key is accepted when reading
+		// a cookie. Prepend a new key to rotate secrets and remove the old key
+		// once the cookies it issued have expired.
+		Keys [][]byte
+	}
+)
+
+// defaultCookies are copied into contexts created with New, NewInput or
+// NewOutput. A webserver.Server replaces them with its
+// webserver.Conventions.Cookies.
+var defaultCookies = CookieConventions{
+	Path:     "/",
+	Secure:   true,
+	HTTPOnly: true,
+	SameSite: http.SameSiteLaxMode,
+}
+
+var (
+	// ErrCookieNotFound is returned when the requested cookie is not present.
+	ErrCookieNotFound = errors.New("Cookie not found.")
+	// ErrCookieNoKeys is returned when signing or encryption is requested but
+	// CookieConventions.Keys is empty.
+	ErrCookieNoKeys = errors.New("No cookie keys configured.")
+	// ErrCookieInvalid is returned when a signed or encrypted cookie is
+	// malformed or was not produced by any of the configured keys.
+	ErrCookieInvalid = errors.New("Cookie signature or encryption is invalid.")
+)
+
+// cookieSeparator splits the value from its signature. It is not part of the
+// base64url alphabet so it never appears inside either half.
+const cookieSeparator = "."
+
+// newCookie returns a cookie populated with the conventional defaults.
+func (cc *CookieConventions) newCookie(name string, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     cc.Path,
+		Domain:   cc.Domain,
+		MaxAge:   cc.MaxAge,
+		Secure:   cc.Secure,
+		HttpOnly: cc.HTTPOnly,
+		SameSite: cc.SameSite,
+	}
+}
+
+// sign returns the HMAC-SHA256 of the cookie name and value using the key.
+// The name is included so a signed value can not be replayed under another
+// cookie name.
+func sign(key []byte, name string, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// encodeSigned returns the value and its signature using the primary key.
+func (cc *CookieConventions) encodeSigned(name string, value string) (string, error) {
+	if len(cc.Keys) == 0 {
+		return "", ErrCookieNoKeys
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	signature := base64.RawURLEncoding.EncodeToString(sign(cc.Keys[0], name, encoded))
+
+	return encoded + cookieSeparator + signature, nil
+}
+
+// decodeSigned verifies the signature against every configured key and
+// returns the original value.
+func (cc *CookieConventions) decodeSigned(name string, raw string) (string, error) {
+	if len(cc.Keys) == 0 {
+		return "", ErrCookieNoKeys
+	}
+
+	parts := strings.Split(raw, cookieSeparator)
+	if len(parts) != 2 {
+		return "", ErrCookieInvalid
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrCookieInvalid
+	}
+
+	for _, key := range cc.Keys {
+		if hmac.Equal(signature, sign(key, name, parts[0])) {
+			value, err := base64.RawURLEncoding.DecodeString(parts[0])
+			if err != nil {
+				return "", ErrCookieInvalid
+			}
+			return string(value), nil
+		}
+	}
+
+	return "", ErrCookieInvalid
+}
+
+// aead returns an AES-256-GCM cipher for the key. Keys of any length are
+// accepted and stretched with SHA-256.
+func aead(key []byte) (cipher.AEAD, error) {
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encodeEncrypted seals the value with the primary key. The cookie name is
+// authenticated as additional data.
+func (cc *CookieConventions) encodeEncrypted(name string, value string) (string, error) {
+	if len(cc.Keys) == 0 {
+		return "", ErrCookieNoKeys
+	}
+
+	gcm, err := aead(cc.Keys[0])
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(value), []byte(name))
+
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// decodeEncrypted opens the value with each configured key in turn.
+func (cc *CookieConventions) decodeEncrypted(name string, raw string) (string, error) {
+	if len(cc.Keys) == 0 {
+		return "", ErrCookieNoKeys
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return "", ErrCookieInvalid
+	}
+
+	for _, key := range cc.Keys {
+		gcm, err := aead(key)
+		if err != nil {
+			return "", err
+		}
+		if len(sealed) < gcm.NonceSize() {
+			return "", ErrCookieInvalid
+		}
+
+		nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+		value, err := gcm.Open(nil, nonce, ciphertext, []byte(name))
+		if err == nil {
+			return string(value), nil
+		}
+	}
+
+	return "", ErrCookieInvalid
+}
+
+// *****************************************************************************
+// Input
+// *****************************************************************************
+
+// SignedCookie returns the value of a cookie written by Output.SetSignedCookie.
+// An error is returned if the cookie is missing or the signature does not
+// match any of the configured keys.
+func (input *Input) SignedCookie(name string) (string, error) {
+	ck, err := input.Request.Cookie(name)
+	if err != nil {
+		return "", ErrCookieNotFound
+	}
+	return input.Cookies.decodeSigned(name, ck.Value)
+}
+
+// EncryptedCookie returns the value of a cookie written by
+// Output.SetEncryptedCookie. An error is returned if the cookie is missing or
+// can not be decrypted by any of the configured keys.
+func (input *Input) EncryptedCookie(name string) (string, error) {
+	ck, err := input.Request.Cookie(name)
+	if err != nil {
+		return "", ErrCookieNotFound
+	}
+	return input.Cookies.decodeEncrypted(name, ck.Value)
+}
+
+// *****************************************************************************
+// Output
+// *****************************************************************************
+
+// SetCookie writes a cookie to the client using the conventional defaults.
+// Cookies must be set before the response body is written.
+func (output *Output) SetCookie(name string, value string) {
+	output.WriteCookie(output.Cookies.newCookie(name, value))
+}
+
+// WriteCookie writes the provided cookie to the client as is and is useful
+// when the conventional defaults need to be overridden.
+func (output *Output) WriteCookie(cookie *http.Cookie) {
+	http.SetCookie(output.Context.ResponseWriter, cookie)
+}
+
+// DeleteCookie instructs the client to remove the named cookie.
+func (output *Output) DeleteCookie(name string) {
+	cookie := output.Cookies.newCookie(name, "")
+	cookie.MaxAge = -1
+	cookie.Expires = time.Unix(0, 0)
+	output.WriteCookie(cookie)
+}
+
+// SetSignedCookie writes a cookie whose value is signed with HMAC-SHA256. The
+// value is readable by the client but can not be altered without detection.
+func (output *Output) SetSignedCookie(name string, value string) error {
+	encoded, err := output.Cookies.encodeSigned(name, value)
+	if err != nil {
+		return err
+	}
+	output.WriteCookie(output.Cookies.newCookie(name, encoded))
+	return nil
+}
+
+// SetEncryptedCookie writes a cookie whose value is encrypted and
+// authenticated with AES-GCM so the client can neither read nor alter it.
+func (output *Output) SetEncryptedCookie(name string, value string) error {
+	encoded, err := output.Cookies.encodeEncrypted(name, value)
+	if err != nil {
+		return err
+	}
+	output.WriteCookie(output.Cookies.newCookie(name, encoded))
+	return nil
+}
@@ -0,0 +1,170 @@
+package context_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/webserver/context"
+)
+
+// keys returns the cookie keys named by names.
+func keys(names ...string) [][]byte {
+	keys := make([][]byte, len(names))
+	for i, name := range names {
+		keys[i] = []byte(name)
+	}
+	return keys
+}
+
+// writeCookie returns the cookie written by set through an Output using the
+// default conventions with keys.
+func writeCookie(t *testing.T, keys [][]byte, set func(*context.Output) error) *http.Cookie {
+	w := httptest.NewRecorder()
+	c := context.New(w, httptest.NewRequest("GET", "/", nil))
+	c.Output.Cookies.Keys = keys
+
+	if err := set(c.Output); err != nil {
+		t.Fatal("Error", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected one cookie, got %v", cookies)
+	}
+	return cookies[0]
+}
+
+// readInput returns an Input using the default conventions with keys for a
+// request carrying the cookie.
+func readInput(keys [][]byte, cookie *http.Cookie) *context.Input {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	input := context.NewInput(req)
+	input.Cookies.Keys = keys
+	return input
+}
+
+// tamper changes the first character of value.
+func tamper(value string) string {
+	if value[0] == 'A' {
+		return "B" + value[1:]
+	}
+	return "A" + value[1:]
+}
+
+func TestCookieRoundTrip(t *testing.T) {
+	current := keys("current")
+
+	signed := writeCookie(t, current, func(o *context.Output) error { return o.SetSignedCookie("session", "alice") })
+	if !signed.Secure || !signed.HttpOnly || signed.Path != "/" {
+		t.Errorf("Expected the conventional defaults, got %v", signed)
+	}
+	if value, err := readInput(current, signed).SignedCookie("session"); err != nil || value != "alice" {
+		t.Errorf("Expected signed value alice, got %q, %v", value, err)
+	}
+
+	encrypted := writeCookie(t, current, func(o *context.Output) error { return o.SetEncryptedCookie("session", "alice") })
+	if encrypted.Value == "alice" {
+		t.Error("Expected the encrypted value to differ from the plain value")
+	}
+	if value, err := readInput(current, encrypted).EncryptedCookie("session"); err != nil || value != "alice" {
+		t.Errorf("Expected encrypted value alice, got %q, %v", value, err)
+	}
+
+	if _, err := readInput(current, signed).SignedCookie("missing"); err != context.ErrCookieNotFound {
+		t.Errorf("Expected %v, got %v", context.ErrCookieNotFound, err)
+	}
+}
+
+func TestCookieTampered(t *testing.T) {
+	current := keys("current")
+
+	signed := writeCookie(t, current, func(o *context.Output) error { return o.SetSignedCookie("role", "user") })
+	encrypted := writeCookie(t, current, func(o *context.Output) error { return o.SetEncryptedCookie("role", "user") })
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		read   func(*context.Input) (string, error)
+	}{
+		{
+			name:   "signed value replaced",
+			cookie: &http.Cookie{Name: "role", Value: "YWRtaW4" + signed.Value[len("dXNlcg"):]},
+			read:   func(i *context.Input) (string, error) { return i.SignedCookie("role") },
+		},
+		{
+			name:   "signature missing",
+			cookie: &http.Cookie{Name: "role", Value: "dXNlcg"},
+			read:   func(i *context.Input) (string, error) { return i.SignedCookie("role") },
+		},
+		{
+			name:   "encrypted value altered",
+			cookie: &http.Cookie{Name: "role", Value: tamper(encrypted.Value)},
+			read:   func(i *context.Input) (string, error) { return i.EncryptedCookie("role") },
+		},
+		{
+			name:   "encrypted value truncated",
+			cookie: &http.Cookie{Name: "role", Value: "AAAA"},
+			read:   func(i *context.Input) (string, error) { return i.EncryptedCookie("role") },
+		},
+		{
+			name:   "signed cookie renamed",
+			cookie: &http.Cookie{Name: "admin", Value: signed.Value},
+			read:   func(i *context.Input) (string, error) { return i.SignedCookie("admin") },
+		},
+		{
+			name:   "encrypted cookie renamed",
+			cookie: &http.Cookie{Name: "admin", Value: encrypted.Value},
+			read:   func(i *context.Input) (string, error) { return i.EncryptedCookie("admin") },
+		},
+	}
+
+	for _, test := range tests {
+		if value, err := test.read(readInput(current, test.cookie)); err != context.ErrCookieInvalid {
+			t.Errorf("%s: expected %v, got %q, %v", test.name, context.ErrCookieInvalid, value, err)
+		}
+	}
+}
+
+func TestCookieKeyRotation(t *testing.T) {
+	old := keys("old")
+	signed := writeCookie(t, old, func(o *context.Output) error { return o.SetSignedCookie("session", "alice") })
+	encrypted := writeCookie(t, old, func(o *context.Output) error { return o.SetEncryptedCookie("session", "alice") })
+
+	rotated := keys("new", "old")
+	if value, err := readInput(rotated, signed).SignedCookie("session"); err != nil || value != "alice" {
+		t.Errorf("Expected the old key to verify after rotation, got %q, %v", value, err)
+	}
+	if value, err := readInput(rotated, encrypted).EncryptedCookie("session"); err != nil || value != "alice" {
+		t.Errorf("Expected the old key to decrypt after rotation, got %q, %v", value, err)
+	}
+
+	// New cookies use the new key, so they fail once only the old key is kept.
+	fresh := writeCookie(t, rotated, func(o *context.Output) error { return o.SetSignedCookie("session", "alice") })
+	if _, err := readInput(old, fresh).SignedCookie("session"); err != context.ErrCookieInvalid {
+		t.Errorf("Expected new cookies to be signed with the new key, got %v", err)
+	}
+
+	retired := keys("new")
+	if _, err := readInput(retired, signed).SignedCookie("session"); err != context.ErrCookieInvalid {
+		t.Errorf("Expected %v once the old key is removed, got %v", context.ErrCookieInvalid, err)
+	}
+}
+
+func TestCookieNoKeys(t *testing.T) {
+	c := context.New(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if err := c.Output.SetSignedCookie("session", "alice"); err != context.ErrCookieNoKeys {
+		t.Errorf("Expected %v, got %v", context.ErrCookieNoKeys, err)
+	}
+	if err := c.Output.SetEncryptedCookie("session", "alice"); err != context.ErrCookieNoKeys {
+		t.Errorf("Expected %v, got %v", context.ErrCookieNoKeys, err)
+	}
+
+	input := readInput(nil, &http.Cookie{Name: "session", Value: "value"})
+	if _, err := input.SignedCookie("session"); err != context.ErrCookieNoKeys {
+		t.Errorf("Expected %v, got %v", context.ErrCookieNoKeys, err)
+	}
+	if _, err := input.EncryptedCookie("session"); err != context.ErrCookieNoKeys {
+		t.Errorf("Expected %v, got %v", context.ErrCookieNoKeys, err)
+	}
+}
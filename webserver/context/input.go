@@ -28,13 +28,21 @@ type Input struct {
 	Format      string // html, xml, json, plain, etc...
 	RequestBody []byte
 	Request     *http.Request
+	// Cookies holds the conventions used to read signed and encrypted cookies.
+	Cookies *CookieConventions
+	// Proxies lists the networks whose forwarding headers are trusted when
+	// resolving the client IP, scheme, host and port. When nil no forwarding
+	// headers are trusted.
+	Proxies *TrustedProxies
 }
 
 // NewInput returns a new Webserver/context Input struct that provides
 // useful behavior for working with HTTP requests.
 func NewInput(req *http.Request) *Input {
+	cookies := defaultCookies
 	return &Input{
 		Request: req,
+		Cookies: &cookies,
 	}
 }
 
@@ -53,8 +61,15 @@ func (input *Input) URL() string {
 	return input.Request.URL.String()
 }
 
-// Scheme returns request scheme as "http" or "https".
+// Scheme returns request scheme as "http" or "https". The scheme reported by
+// a trusted proxy through Forwarded or X-Forwarded-Proto is preferred.
 func (input *Input) Scheme() string {
+	if input.fromTrustedProxy() {
+		if proto := input.forwardedProto(); proto == "http" || proto == "https" {
+			return proto
+		}
+	}
+
 	if input.Request.URL.Scheme != "" {
 		return input.Request.URL.Scheme
 	} else if input.Request.TLS == nil {
@@ -64,14 +79,22 @@ func (input *Input) Scheme() string {
 	}
 }
 
+// hostPort returns the Host requested by the client including the port if
+// one was provided. The host reported by a trusted proxy through Forwarded or
+// X-Forwarded-Host is preferred.
+func (input *Input) hostPort() string {
+	if input.fromTrustedProxy() {
+		if host := input.forwardedHost(); host != "" {
+			return host
+		}
+	}
+	return input.Request.Host
+}
+
 // Host returns host name. If the host info is unavailable localhost is returned.
 func (input *Input) Host() string {
-	if input.Request.Host != "" {
-		hostParts := strings.Split(input.Request.Host, ":")
-		if len(hostParts) > 0 {
-			return hostParts[0]
-		}
-		return input.Request.Host
+	if host, _ := splitHostPort(input.hostPort()); host != "" {
+		return host
 	}
 	return "localhost"
 }
@@ -117,28 +140,31 @@ func (input *Input) IsUpload() bool {
 }
 
 // IP returns the IP address of the client.
-// If this is a proxy request the first proxy IP is returned.
-// If an error occurs the local IPv4 127.0.0.1 address is returned.
+// If the request was forwarded by trusted proxies the address of the last
+// untrusted hop is returned, or UnknownIP if that hop is unknown or
+// obfuscated; forwarding headers sent by anyone else are ignored. If an error
+// occurs the local IPv4 127.0.0.1 address is returned.
 func (input *Input) IP() string {
-	ips := input.Proxy()
-	if len(ips) > 0 && ips[0] != "" {
-		return ips[0]
-	}
-	ip := strings.Split(input.Request.RemoteAddr, ":")
-	if len(ip) > 0 {
-		if ip[0] != "[" {
-			return ip[0]
-		}
+	ip, known := input.clientIP()
+	switch {
+	case !known:
+		return UnknownIP
+	case ip != nil:
+		return ip.String()
 	}
 	return "127.0.0.1"
 }
 
-// Proxy returns proxy client IPs as a slice of strings.
+// Proxy returns the X-Forwarded-For IPs as a slice of strings. The values are
+// supplied by the client and proxies and are not verified.
 func (input *Input) Proxy() []string {
-	if ips := input.Header("X-Forwarded-For"); ips != "" {
-		return strings.Split(ips, ",")
+	ips := []string{}
+	if header := input.Header("X-Forwarded-For"); header != "" {
+		for _, ip := range strings.Split(header, ",") {
+			ips = append(ips, strings.TrimSpace(ip))
+		}
 	}
-	return []string{}
+	return ips
 }
 
 // Refer returns http referrer header.
@@ -153,13 +179,18 @@ func (input *Input) SubDomains() string {
 	return strings.Join(parts[len(parts)-2:], ".")
 }
 
-// Port returns request client port.
-// when error or empty, return 80.
+// Port returns the port requested by the client.
+// When absent or invalid the default port of the scheme is returned.
 func (input *Input) Port() int {
-	parts := strings.Split(input.Request.Host, ":")
-	if len(parts) == 2 {
-		port, _ := strconv.Atoi(parts[1])
-		return port
+	_, port := splitHostPort(input.hostPort())
+	if port == "" && input.fromTrustedProxy() {
+		port = input.forwardedPort()
+	}
+	if p, err := strconv.Atoi(port); err == nil && p > 0 {
+		return p
+	}
+	if input.IsSecure() {
+		return 443
 	}
 	return 80
 }
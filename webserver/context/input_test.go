@@ -0,0 +1,175 @@
+package context_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/webserver/context"
+)
+
+func TestInputForwarding(t *testing.T) {
+	proxies, err := context.ParseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::/32", "192.0.2.1"})
+	if err != nil {
+		t.Fatal("Error", err)
+	}
+
+	tests := []struct {
+		name    string
+		header  string
+		remote  string
+		host    string
+		headers map[string]string
+		ip      string
+		scheme  string
+		hostOut string
+		port    int
+	}{
+		{
+			name:    "untrusted peer ignores forwarding headers",
+			remote:  "203.0.113.9:5000",
+			host:    "example.com",
+			headers: map[string]string{"X-Forwarded-For": "1.2.3.4", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "evil.com"},
+			ip:      "203.0.113.9",
+			scheme:  "http",
+			hostOut: "example.com",
+			port:    80,
+		},
+		{
+			name:    "ipv6 remote address",
+			remote:  "[2001:db9::1]:5000",
+			host:    "[::1]:8080",
+			ip:      "2001:db9::1",
+			scheme:  "http",
+			hostOut: "::1",
+			port:    8080,
+		},
+		{
+			name:    "trusted chain skips trusted hops and trims spaces",
+			remote:  "10.1.1.1:5000",
+			host:    "internal:8080",
+			headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.7 , 10.2.2.2", "X-Forwarded-Proto": "https", "X-Forwarded-Host": "example.com"},
+			ip:      "198.51.100.7",
+			scheme:  "https",
+			hostOut: "example.com",
+			port:    443,
+		},
+		{
+			name:    "forwarded header with ipv6 and port",
+			header:  context.HeaderForwarded,
+			remote:  "[2001:db8::2]:5000",
+			host:    "internal",
+			headers: map[string]string{"Forwarded": `for="[2001:db9::17]:4711";proto=https;host="example.com:8443", for=192.0.2.1`},
+			ip:      "2001:db9::17",
+			scheme:  "https",
+			hostOut: "example.com",
+			port:    8443,
+		},
+		{
+			name:    "all hops trusted returns the outermost",
+			remote:  "192.0.2.1:5000",
+			host:    "example.com",
+			headers: map[string]string{"X-Forwarded-For": "10.0.0.5", "X-Forwarded-Port": "8080"},
+			ip:      "10.0.0.5",
+			scheme:  "http",
+			hostOut: "example.com",
+			port:    8080,
+		},
+		{
+			name:    "client supplied forwarded elements are ignored",
+			header:  context.HeaderForwarded,
+			remote:  "10.1.1.1:5000",
+			host:    "internal",
+			headers: map[string]string{"Forwarded": `host=evil.com;proto=http, for=198.51.100.7;proto=https;host=example.com`},
+			ip:      "198.51.100.7",
+			scheme:  "https",
+			hostOut: "example.com",
+			port:    443,
+		},
+		{
+			name:    "forwarded header ignored when proxies append X-Forwarded-For",
+			remote:  "10.1.1.1:5000",
+			host:    "example.com",
+			headers: map[string]string{"Forwarded": "for=8.8.8.8;host=evil.com;proto=https", "X-Forwarded-For": "198.51.100.7"},
+			ip:      "198.51.100.7",
+			scheme:  "http",
+			hostOut: "example.com",
+			port:    80,
+		},
+		{
+			name:    "X-Forwarded headers ignored when proxies append Forwarded",
+			header:  context.HeaderForwarded,
+			remote:  "10.1.1.1:5000",
+			host:    "example.com",
+			headers: map[string]string{"Forwarded": "for=198.51.100.7", "X-Forwarded-For": "8.8.8.8", "X-Forwarded-Host": "evil.com", "X-Forwarded-Port": "8443"},
+			ip:      "198.51.100.7",
+			scheme:  "http",
+			hostOut: "example.com",
+			port:    80,
+		},
+		{
+			name:    "client supplied X-Forwarded values before the trusted hop are ignored",
+			remote:  "10.1.1.1:5000",
+			host:    "internal",
+			headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.7", "X-Forwarded-Proto": "http, https", "X-Forwarded-Host": "evil.com, example.com"},
+			ip:      "198.51.100.7",
+			scheme:  "https",
+			hostOut: "example.com",
+			port:    443,
+		},
+		{
+			name:    "unknown client behind a trusted proxy",
+			header:  context.HeaderForwarded,
+			remote:  "10.1.1.1:5000",
+			host:    "internal",
+			headers: map[string]string{"Forwarded": "for=unknown;proto=https;host=example.com, for=10.2.2.2"},
+			ip:      context.UnknownIP,
+			scheme:  "https",
+			hostOut: "example.com",
+			port:    443,
+		},
+		{
+			name:    "obfuscated client behind a trusted proxy",
+			header:  context.HeaderForwarded,
+			remote:  "10.1.1.1:5000",
+			host:    "example.com",
+			headers: map[string]string{"Forwarded": "for=_hidden, for=10.2.2.2"},
+			ip:      context.UnknownIP,
+			scheme:  "http",
+			hostOut: "example.com",
+			port:    80,
+		},
+	}
+
+	for _, test := range tests {
+		proxies.Header = test.header
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remote
+		req.Host = test.host
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+
+		input := context.NewInput(req)
+		input.Proxies = proxies
+
+		if ip := input.IP(); ip != test.ip {
+			t.Errorf("%s: expected IP %s but got %s", test.name, test.ip, ip)
+		}
+		if scheme := input.Scheme(); scheme != test.scheme {
+			t.Errorf("%s: expected scheme %s but got %s", test.name, test.scheme, scheme)
+		}
+		if host := input.Host(); host != test.hostOut {
+			t.Errorf("%s: expected host %s but got %s", test.name, test.hostOut, host)
+		}
+		if port := input.Port(); port != test.port {
+			t.Errorf("%s: expected port %d but got %d", test.name, test.port, port)
+		}
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	if _, err := context.ParseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected an error for an invalid proxy address")
+	}
+}
@@ -13,12 +13,16 @@ type Output struct {
 	Status      int
 	ContentType string
 	Context     *Context
+	// Cookies holds the conventions used to write cookies.
+	Cookies *CookieConventions
 }
 
 // NewOutput returns a new Output
 func NewOutput(c *Context) *Output {
+	cookies := defaultCookies
 	output := &Output{
 		Context: c,
+		Cookies: &cookies,
 	}
 	// 200 OK by default
 	output.Status = 200
@@ -0,0 +1,288 @@
+package context
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Header families appended by trusted proxies.
+const (
+	// HeaderXForwardedFor is the X-Forwarded-For header with the
+	// X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Port headers.
+	HeaderXForwardedFor = "X-Forwarded-For"
+	// HeaderForwarded is the RFC 7239 Forwarded header.
+	HeaderForwarded = "Forwarded"
+)
+
+// UnknownIP is returned by Input.IP when the client hop is unknown or
+// obfuscated, as in "Forwarded: for=unknown".
+const UnknownIP = "unknown"
+
+// TrustedProxies is a set of networks whose forwarding headers, such as
+// X-Forwarded-For and Forwarded, are believed. Requests from any other
+// address are treated as coming directly from the client.
+type TrustedProxies struct {
+	networks []*net.IPNet
+	// Header is the header family the trusted proxies append,
+	// HeaderXForwardedFor or HeaderForwarded. Headers of the other family
+	// are ignored since clients can send them through the proxies. The
+	// default is HeaderXForwardedFor.
+	Header string
+}
+
+// ParseTrustedProxies returns TrustedProxies for the provided CIDR ranges. A
+// bare IPv4 or IPv6 address is accepted as a single host network.
+func ParseTrustedProxies(cidrs []string) (*TrustedProxies, error) {
+	tp := &TrustedProxies{}
+
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: cidr}
+			}
+			if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		tp.networks = append(tp.networks, network)
+	}
+
+	return tp, nil
+}
+
+// Contains returns true if the address belongs to a trusted network.
+func (tp *TrustedProxies) Contains(ip net.IP) bool {
+	if tp == nil || ip == nil {
+		return false
+	}
+	for _, network := range tp.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedElement is a single hop of a RFC 7239 Forwarded header.
+type forwardedElement struct {
+	For   string
+	Proto string
+	Host  string
+}
+
+// parseForwarded parses a RFC 7239 Forwarded header into its elements.
+func parseForwarded(header string) []forwardedElement {
+	elements := []forwardedElement{}
+
+	for _, element := range splitQuoted(header, ',') {
+		var e forwardedElement
+		for _, pair := range splitQuoted(element, ';') {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value := strings.TrimSpace(kv[1])
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			switch strings.ToLower(strings.TrimSpace(kv[0])) {
+			case "for":
+				e.For = value
+			case "proto":
+				e.Proto = strings.ToLower(value)
+			case "host":
+				e.Host = value
+			}
+		}
+		elements = append(elements, e)
+	}
+
+	return elements
+}
+
+// splitQuoted splits s by sep ignoring separators inside double quotes.
+func splitQuoted(s string, sep byte) []string {
+	parts := []string{}
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case '\\':
+			if quoted {
+				i++
+			}
+		case sep:
+			if !quoted {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(s[start:]); rest != "" {
+		parts = append(parts, rest)
+	}
+
+	return parts
+}
+
+// parseNode returns the IP address of a forwarding node such as
+// "192.0.2.43", "192.0.2.43:47011", "[2001:db8::17]:47011" or "2001:db8::17".
+// Obfuscated identifiers and "unknown" return nil.
+func parseNode(node string) net.IP {
+	node = strings.TrimSpace(node)
+	if ip := net.ParseIP(node); ip != nil {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return net.ParseIP(host)
+	}
+	return net.ParseIP(strings.Trim(node, "[]"))
+}
+
+// splitHostPort splits a Host header value into the host and port. The port is
+// empty if it was not provided.
+func splitHostPort(hostport string) (host string, port string) {
+	if host, port, err := net.SplitHostPort(hostport); err == nil {
+		return host, port
+	}
+	return strings.Trim(hostport, "[]"), ""
+}
+
+// remoteIP returns the address of the peer connected to the server.
+func (input *Input) remoteIP() net.IP {
+	return parseNode(input.Request.RemoteAddr)
+}
+
+// fromTrustedProxy returns true if the connected peer is a trusted proxy.
+func (input *Input) fromTrustedProxy() bool {
+	return input.Proxies.Contains(input.remoteIP())
+}
+
+// forwarded returns true if the trusted proxies append the Forwarded header.
+func (tp *TrustedProxies) forwarded() bool {
+	return tp != nil && tp.Header == HeaderForwarded
+}
+
+// forwardedChain returns the addresses recorded by proxies ordered from the
+// client towards the server, read from the header family the trusted proxies
+// append.
+func (input *Input) forwardedChain() []net.IP {
+	chain := []net.IP{}
+
+	if input.Proxies.forwarded() {
+		for _, e := range parseForwarded(input.Header("Forwarded")) {
+			chain = append(chain, parseNode(e.For))
+		}
+		return chain
+	}
+
+	for _, node := range input.Proxy() {
+		chain = append(chain, parseNode(node))
+	}
+	return chain
+}
+
+// clientHop walks the forwarding chain from the server towards the client and
+// returns the chain with the index of the first hop which is not a trusted
+// proxy, or of the outermost hop if every hop is trusted. The entry at the
+// index was added by a trusted proxy; everything before it is supplied by the
+// client. The index is -1 if the connected peer is not trusted or the chain
+// is empty.
+func (input *Input) clientHop() (int, []net.IP) {
+	if !input.fromTrustedProxy() {
+		return -1, nil
+	}
+
+	chain := input.forwardedChain()
+	if len(chain) == 0 {
+		return -1, chain
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		// An obfuscated or unknown hop ends what we can verify.
+		if chain[i] == nil || !input.Proxies.Contains(chain[i]) {
+			return i, chain
+		}
+	}
+
+	return 0, chain
+}
+
+// clientIP returns the address of the client: the first hop from the server
+// which is not a trusted proxy. known is false if that hop is unknown or
+// obfuscated; the hops after it are trusted proxies and not the client.
+func (input *Input) clientIP() (ip net.IP, known bool) {
+	i, chain := input.clientHop()
+	if i < 0 {
+		return input.remoteIP(), true
+	}
+	return chain[i], chain[i] != nil
+}
+
+// forwardedProto returns the scheme reported by a trusted proxy.
+func (input *Input) forwardedProto() string {
+	if input.Proxies.forwarded() {
+		return input.forwardedElement().Proto
+	}
+	return strings.ToLower(input.forwardedValue("X-Forwarded-Proto"))
+}
+
+// forwardedHost returns the Host reported by a trusted proxy.
+func (input *Input) forwardedHost() string {
+	if input.Proxies.forwarded() {
+		return input.forwardedElement().Host
+	}
+	return input.forwardedValue("X-Forwarded-Host")
+}
+
+// forwardedPort returns the port reported by a trusted proxy through
+// X-Forwarded-Port. The Forwarded header reports the port with the host.
+func (input *Input) forwardedPort() string {
+	if input.Proxies.forwarded() {
+		return ""
+	}
+	return input.forwardedValue("X-Forwarded-Port")
+}
+
+// forwardedElement returns the Forwarded element added by the trusted proxy
+// the client connected to.
+func (input *Input) forwardedElement() forwardedElement {
+	i, _ := input.clientHop()
+	if i < 0 {
+		return forwardedElement{}
+	}
+	return parseForwarded(input.Header("Forwarded"))[i]
+}
+
+// forwardedValue returns the value of an X-Forwarded-* header added by the
+// trusted proxy the client connected to. Values appended hop by hop like
+// X-Forwarded-For are read at the hop of the client; otherwise the last value
+// is used, which the nearest trusted proxy added.
+func (input *Input) forwardedValue(key string) string {
+	values := []string{}
+	if header := input.Header(key); header != "" {
+		for _, value := range strings.Split(header, ",") {
+			values = append(values, strings.TrimSpace(value))
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+
+	if i, chain := input.clientHop(); i >= 0 && len(chain) == len(values) {
+		return values[i]
+	}
+	return values[len(values)-1]
+}
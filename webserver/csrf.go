@@ -0,0 +1,133 @@
+package webserver
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"net/http"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+	"github.com/go-gia/go-infrastructure/webserver/render"
+)
+
+// CSRFConventions defines how cross-site request forgery tokens are issued
+// and verified.
+type CSRFConventions struct {
+	// CookieName is the cookie holding the token issued to the client.
+	CookieName string
+	// FieldName is the form field rendered by {{ csrfField }} and read from
+	// submitted forms.
+	FieldName string
+	// HeaderName is the request header read from AJAX requests.
+	HeaderName string
+}
+
+// defaultResponseCSRFForbidden is returned if the server is unable to render
+// the response using the configured SystemTemplate.
+const defaultResponseCSRFForbidden = `
+<html>
+  <head>
+    <title>403 Forbidden</title>
+    <style nonce="{{cspNonce}}">
+      body {
+        background-color:black;
+        color:white;
+        margin:20%;
+      }
+    </style>
+  </head>
+
+  <body>
+    <center>
+      <h1>Invalid or Missing CSRF Token</h1>
+    </center>
+  </body>
+</html>`
+
+// csrfTokenLength is the number of random bytes in a token.
+const csrfTokenLength = 32
+
+// CSRF returns a HandlerDef to use as a PreHandler on routes that render or
+// accept forms. It implements the double-submit pattern: a random token is
+// issued in a cookie and state changing requests must echo it back in the
+// CSRF.FieldName form field, or the CSRF.HeaderName header of the server's
+// conventions for AJAX requests. The token is bound to the {{ csrfField }} and
+// {{ csrfToken }} template functions. Failures reply with the
+// `onCSRFFailure` SystemTemplate and break the handler chain.
+func (s *Server) CSRF() HandlerDef {
+	return HandlerDef{
+		Alias:                 "CSRFProtection",
+		DocumentationMarkdown: "Rejects state changing requests without a valid CSRF token with 403 Forbidden.",
+		Handler:               s.csrfHandler,
+	}
+}
+
+func (s *Server) csrfHandler(c *context.Context) {
+	conventions := s.settings.CSRF
+
+	token := c.Input.Cookie(conventions.CookieName)
+	if token == "" {
+		var err error
+		token, err = newCSRFToken()
+		if err != nil {
+			s.logger.Context(logger.Fields{"error": err}).Error("Unable to generate CSRF token")
+			c.BreakHandlerChain = true
+			c.InternalError(nil)
+			return
+		}
+		c.Output.SetCookie(conventions.CookieName, token)
+	}
+
+	c.SetTemplateFuncs(render.CSRFFuncs(conventions.FieldName, token))
+
+	switch c.Input.Method() {
+	case GET, HEAD, OPTIONS, http.MethodTrace:
+		return
+	}
+
+	var submitted string
+	if c.Input.IsAjax() {
+		submitted = c.Input.Header(conventions.HeaderName)
+	} else {
+		submitted = c.Request.PostFormValue(conventions.FieldName)
+		if submitted == "" {
+			submitted = c.Input.Header(conventions.HeaderName)
+		}
+	}
+
+	if submitted != "" && subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) == 1 {
+		return
+	}
+
+	c.BreakHandlerChain = true
+	s.onCSRFFailure(c)
+}
+
+// onCSRFFailure replies to the request with an HTTP 403 forbidden error.
+func (s *Server) onCSRFFailure(c *context.Context) {
+	c.Output.Status = http.StatusForbidden
+
+	s.logger.Context(logger.Fields{
+		"method":      c.Input.Method(),
+		"requestPath": c.Request.URL.Path,
+		"statusCode":  403,
+	}).Warn("CSRF token verification failed")
+
+	template := s.settings.SystemTemplates["onCSRFFailure"]
+	err := c.HTMLTemplate(template, nil)
+	if err != nil {
+		s.logger.Context(logger.Fields{"template": template}).Debug("Unable to load configured onCSRFFailure template--serving default response")
+		c.Output.Body(withCSPNonce(c, defaultResponseCSRFForbidden))
+	}
+}
+
+// newCSRFToken returns a random URL safe token.
+func newCSRFToken() (string, error) {
+	b := make([]byte, csrfTokenLength)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
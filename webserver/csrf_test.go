@@ -0,0 +1,146 @@
+package webserver_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CSRF", func() {
+	var (
+		server *webserver.Server
+		views  string
+		served bool
+	)
+
+	write := func(name string, content string) {
+		path := filepath.Join(views, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	// post returns a form submission carrying the token in the cookie and
+	// the field.
+	post := func(cookie string, field string) *http.Request {
+		form := url.Values{}
+		if field != "" {
+			form.Set("_csrf", field)
+		}
+		req := httptest.NewRequest(webserver.POST, "/form", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "_csrf", Value: cookie})
+		}
+		return req
+	}
+
+	BeforeEach(func() {
+		var err error
+		views, err = ioutil.TempDir("", "views")
+		Expect(err).NotTo(HaveOccurred())
+		write("form.html", `<form>{{ csrfField }}</form>{{ csrfToken }}`)
+		write("errors/onCSRFFailure.html", `custom failure`)
+
+		log, err := logger.New(logger.Settings{Output: logger.Stdiscard{}})
+		Expect(err).NotTo(HaveOccurred())
+		server = webserver.New(log, webserver.WithTemplateDirectory(views+"/"))
+
+		served = false
+		for _, method := range []string{webserver.GET, webserver.POST} {
+			server.RegisterHandlerDef(webserver.HandlerDef{
+				Method:      method,
+				Path:        "/form",
+				PreHandlers: []webserver.HandlerDef{server.CSRF()},
+				Handler: func(c *context.Context) {
+					served = true
+					Expect(c.HTMLTemplate("form", nil)).To(Succeed())
+				},
+			})
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(views)
+	})
+
+	It("issues a token on safe methods and binds it to views", func() {
+		w := serve(httptest.NewRequest(webserver.GET, "/form", nil))
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		cookies := w.Result().Cookies()
+		Expect(cookies).To(HaveLen(1))
+		Expect(cookies[0].Name).To(Equal("_csrf"))
+		Expect(cookies[0].Value).NotTo(BeEmpty())
+		Expect(w.Body.String()).To(Equal(`<form><input type="hidden" name="_csrf" value="` + cookies[0].Value + `"></form>` + cookies[0].Value))
+	})
+
+	It("keeps the token of the client", func() {
+		req := httptest.NewRequest(webserver.GET, "/form", nil)
+		req.AddCookie(&http.Cookie{Name: "_csrf", Value: "token"})
+		w := serve(req)
+
+		Expect(w.Result().Cookies()).To(BeEmpty())
+		Expect(w.Body.String()).To(HaveSuffix("token"))
+	})
+
+	It("accepts the token in the form field", func() {
+		w := serve(post("token", "token"))
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(served).To(BeTrue())
+	})
+
+	It("accepts the token in the header of a form submission", func() {
+		req := post("token", "")
+		req.Header.Set("X-CSRF-Token", "token")
+
+		Expect(serve(req).Code).To(Equal(http.StatusOK))
+		Expect(served).To(BeTrue())
+	})
+
+	It("reads AJAX requests from the header only", func() {
+		req := post("token", "")
+		req.Header.Set("X-Requested-With", "XMLHttpRequest")
+		req.Header.Set("X-CSRF-Token", "token")
+		Expect(serve(req).Code).To(Equal(http.StatusOK))
+
+		req = post("token", "token")
+		req.Header.Set("X-Requested-With", "XMLHttpRequest")
+		Expect(serve(req).Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("rejects a mismatched token with the onCSRFFailure template", func() {
+		w := serve(post("token", "other"))
+
+		Expect(w.Code).To(Equal(http.StatusForbidden))
+		Expect(w.Body.String()).To(Equal("custom failure"))
+		Expect(served).To(BeFalse())
+	})
+
+	It("rejects a missing token with the built-in page without a template", func() {
+		Expect(os.Remove(filepath.Join(views, "errors", "onCSRFFailure.html"))).To(Succeed())
+
+		w := serve(post("", "token"))
+
+		Expect(w.Code).To(Equal(http.StatusForbidden))
+		Expect(w.Body.String()).To(ContainSubstring("Invalid or Missing CSRF Token"))
+		Expect(w.Body.String()).To(ContainSubstring("<style>"))
+		Expect(served).To(BeFalse())
+	})
+})
@@ -81,18 +81,18 @@ func (s *Server) RegisterHandlerDefs(h []HandlerDef) error {
 // RegisterHandlerDef accepts a HandlerDef and registers it's behavior with the
 // webserver.
 func (s *Server) RegisterHandlerDef(h HandlerDef) {
-	chain := []HandlerFunc{}
-	postChain := []HandlerFunc{}
+	chain := []namedHandler{}
+	postChain := []namedHandler{}
 
 	// Pre
 	for _, a := range h.PreHandlers {
-		chain = append(chain, a.Handler)
+		chain = append(chain, namedHandler{name: handlerName(a, "prehandler"), handler: a.Handler})
 	}
 	// Target
-	chain = append(chain, h.Handler)
+	chain = append(chain, namedHandler{name: handlerName(h, h.Method+" "+h.Path), handler: h.Handler})
 
 	for _, a := range h.PostHandlers {
-		postChain = append(postChain, a.Handler)
+		postChain = append(postChain, namedHandler{name: handlerName(a, "posthandler"), handler: a.Handler})
 	}
 
 	// Register
@@ -110,7 +110,7 @@ func (s *Server) RegisterHandlerDef(h HandlerDef) {
 	case PATCH:
 		fallthrough
 	case POST:
-		s.Handle(h.Method, h.Path, chain, postChain)
+		s.handle(h.Method, h.Path, chain, postChain)
 
 	case "":
 	// do nothing--middleware only
@@ -125,6 +125,15 @@ func (s *Server) RegisterHandlerDef(h HandlerDef) {
 	s.HandlerDef[h.Method+":"+h.Path] = h
 }
 
+// handlerName returns the Alias of the HandlerDef or the fallback if the
+// HandlerDef is anonymous.
+func handlerName(h HandlerDef, fallback string) string {
+	if h.Alias != "" {
+		return h.Alias
+	}
+	return fallback
+}
+
 type optionsMetadata struct {
 	get            bool
 	put            bool
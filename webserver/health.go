@@ -0,0 +1,261 @@
+package webserver
+
+import (
+	gocontext "context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+)
+
+const (
+	// HealthPass reports a check, or the service, as healthy.
+	HealthPass = "pass"
+	// HealthWarn reports the service as degraded because a non-critical check
+	// failed.
+	HealthWarn = "warn"
+	// HealthFail reports a check, or the service, as unhealthy.
+	HealthFail = "fail"
+)
+
+type (
+	// HealthConventions configures the opt-in health endpoints.
+	HealthConventions struct {
+		// HealthPath runs every check.
+		HealthPath string
+		// ReadinessPath runs every check and fails while the server shuts down.
+		ReadinessPath string
+		// LivenessPath runs only the checks flagged as Liveness.
+		LivenessPath string
+		// CheckTimeout is used for checks that do not declare a Timeout.
+		CheckTimeout time.Duration
+		// ShutdownDelay is how long Shutdown reports not ready before it stops
+		// accepting connections, giving load balancers time to react.
+		ShutdownDelay time.Duration
+	}
+
+	// HealthCheck describes a named dependency check.
+	HealthCheck struct {
+		// Name identifies the check in results and logs.
+		Name string
+		// Check returns an error if the dependency is unhealthy. The context is
+		// cancelled once Timeout elapses.
+		Check func(gocontext.Context) error
+		// Timeout overrides HealthConventions.CheckTimeout.
+		Timeout time.Duration
+		// Critical checks fail the endpoint; non-critical checks only degrade it
+		// to a warning.
+		Critical bool
+		// Liveness includes the check on the LivenessPath.
+		Liveness bool
+	}
+
+	// HealthCheckResult is the outcome of one check.
+	HealthCheckResult struct {
+		Status   string  `json:"status"`
+		Critical bool    `json:"critical"`
+		Latency  string  `json:"latency"`
+		Millis   float64 `json:"latencyMs"`
+		Error    string  `json:"error,omitempty"`
+	}
+
+	// HealthReport is the JSON body returned by the health endpoints.
+	HealthReport struct {
+		Status string                       `json:"status"`
+		Checks map[string]HealthCheckResult `json:"checks"`
+	}
+
+	// healthRegistry holds the registered checks and their last state.
+	healthRegistry struct {
+		sync.RWMutex
+		checks     map[string]HealthCheck
+		lastStatus map[string]string
+		shutdown   int32
+	}
+)
+
+// ErrHealthCheckTimeout is reported when a check does not finish in time.
+var ErrHealthCheckTimeout = errors.New("Health check timed out.")
+
+// RegisterHealthCheck adds, or replaces, a named check used by the health
+// endpoints.
+func (s *Server) RegisterHealthCheck(check HealthCheck) {
+	s.health.Lock()
+	defer s.health.Unlock()
+
+	s.health.checks[check.Name] = check
+}
+
+// EnableHealthEndpoints registers the HealthPath, ReadinessPath and
+// LivenessPath routes configured in the server's Health conventions. Empty
+// paths are skipped.
+func (s *Server) EnableHealthEndpoints() {
+	conventions := s.settings.Health
+
+	if conventions.HealthPath != "" {
+		s.RegisterHandlerDef(HandlerDef{
+			Alias:                 "Health",
+			Method:                GET,
+			Path:                  conventions.HealthPath,
+			DocumentationMarkdown: "Runs every registered health check.",
+			Handler: func(c *context.Context) {
+				s.writeHealthReport(c, s.CheckHealth(false))
+			},
+		})
+	}
+
+	if conventions.ReadinessPath != "" {
+		s.RegisterHandlerDef(HandlerDef{
+			Alias:                 "Readiness",
+			Method:                GET,
+			Path:                  conventions.ReadinessPath,
+			DocumentationMarkdown: "Runs every registered health check and fails while the server is shutting down.",
+			Handler: func(c *context.Context) {
+				report := s.CheckHealth(false)
+				if atomic.LoadInt32(&s.health.shutdown) == 1 {
+					report.Status = HealthFail
+				}
+				s.writeHealthReport(c, report)
+			},
+		})
+	}
+
+	if conventions.LivenessPath != "" {
+		s.RegisterHandlerDef(HandlerDef{
+			Alias:                 "Liveness",
+			Method:                GET,
+			Path:                  conventions.LivenessPath,
+			DocumentationMarkdown: "Runs the health checks flagged for liveness.",
+			Handler: func(c *context.Context) {
+				s.writeHealthReport(c, s.CheckHealth(true))
+			},
+		})
+	}
+}
+
+// CheckHealth runs the registered checks concurrently and returns their
+// results. If livenessOnly is true only checks flagged as Liveness are run.
+func (s *Server) CheckHealth(livenessOnly bool) HealthReport {
+	s.health.RLock()
+	checks := make([]HealthCheck, 0, len(s.health.checks))
+	for _, check := range s.health.checks {
+		if livenessOnly && !check.Liveness {
+			continue
+		}
+		checks = append(checks, check)
+	}
+	s.health.RUnlock()
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+
+	results := make([]HealthCheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+			results[i] = runHealthCheck(check, s.settings.Health.CheckTimeout)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := HealthReport{
+		Status: HealthPass,
+		Checks: make(map[string]HealthCheckResult, len(checks)),
+	}
+	for i, check := range checks {
+		result := results[i]
+		report.Checks[check.Name] = result
+		s.logHealthTransition(check.Name, result)
+
+		if result.Status == HealthPass {
+			continue
+		}
+		if check.Critical {
+			report.Status = HealthFail
+		} else if report.Status == HealthPass {
+			report.Status = HealthWarn
+		}
+	}
+
+	return report
+}
+
+// runHealthCheck executes the check, abandoning it once its timeout elapses.
+func runHealthCheck(check HealthCheck, defaultTimeout time.Duration) HealthCheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrHealthCheckTimeout
+	}
+	latency := time.Since(start)
+
+	result := HealthCheckResult{
+		Status:   HealthPass,
+		Critical: check.Critical,
+		Latency:  latency.String(),
+		Millis:   float64(latency) / float64(time.Millisecond),
+	}
+	if err != nil {
+		result.Status = HealthFail
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// logHealthTransition logs a check result when it differs from the last one.
+func (s *Server) logHealthTransition(name string, result HealthCheckResult) {
+	s.health.Lock()
+	previous, seen := s.health.lastStatus[name]
+	s.health.lastStatus[name] = result.Status
+	s.health.Unlock()
+
+	if seen && previous == result.Status {
+		return
+	}
+
+	fields := logger.Fields{
+		"check":     name,
+		"status":    result.Status,
+		"previous":  previous,
+		"critical":  result.Critical,
+		"latencyMs": result.Millis,
+	}
+	if result.Status == HealthPass {
+		s.logger.Context(fields).Info("Health check state changed")
+		return
+	}
+	fields["error"] = result.Error
+	s.logger.Context(fields).Warn("Health check state changed")
+}
+
+// writeHealthReport replies with the report as JSON. Failing reports reply
+// with 503 Service Unavailable.
+func (s *Server) writeHealthReport(c *context.Context, report HealthReport) {
+	if report.Status == HealthFail {
+		c.Output.Status = http.StatusServiceUnavailable
+	}
+	c.Output.Header("Cache-Control", "no-store")
+	c.Output.JSON(report, false)
+}
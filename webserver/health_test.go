@@ -0,0 +1,129 @@
+package webserver_test
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health", func() {
+	var server *webserver.Server
+
+	get := func(path string) (int, webserver.HealthReport) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(webserver.GET, path, nil))
+
+		var report webserver.HealthReport
+		Expect(json.Unmarshal(w.Body.Bytes(), &report)).To(Succeed())
+		return w.Code, report
+	}
+
+	BeforeEach(func() {
+		log, err := logger.New(logger.Settings{Output: logger.Stdiscard{}})
+		Expect(err).NotTo(HaveOccurred())
+
+		conventions := webserver.Settings
+		conventions.Health.ShutdownDelay = 0
+
+		server = webserver.New(log, webserver.WithConventions(conventions))
+		server.EnableHealthEndpoints()
+		server.RegisterHealthCheck(webserver.HealthCheck{
+			Name:     "database",
+			Critical: true,
+			Liveness: true,
+			Check:    func(gocontext.Context) error { return nil },
+		})
+	})
+
+	It("passes when every check passes", func() {
+		code, report := get("/healthz")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(report.Status).To(Equal(webserver.HealthPass))
+		Expect(report.Checks).To(HaveKey("database"))
+	})
+
+	It("warns when a non-critical check fails", func() {
+		server.RegisterHealthCheck(webserver.HealthCheck{
+			Name:  "cache",
+			Check: func(gocontext.Context) error { return errors.New("unreachable") },
+		})
+
+		code, report := get("/healthz")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(report.Status).To(Equal(webserver.HealthWarn))
+		Expect(report.Checks["cache"].Error).To(Equal("unreachable"))
+	})
+
+	It("fails when a critical check times out", func() {
+		server.RegisterHealthCheck(webserver.HealthCheck{
+			Name:     "slow",
+			Critical: true,
+			Timeout:  time.Millisecond * 10,
+			Check: func(ctx gocontext.Context) error {
+				<-ctx.Done()
+				time.Sleep(time.Millisecond * 50)
+				return nil
+			},
+		})
+
+		code, report := get("/readyz")
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(report.Checks["slow"].Error).To(Equal(webserver.ErrHealthCheckTimeout.Error()))
+	})
+
+	It("only runs liveness checks on the liveness path", func() {
+		server.RegisterHealthCheck(webserver.HealthCheck{
+			Name:     "queue",
+			Critical: true,
+			Check:    func(gocontext.Context) error { return errors.New("down") },
+		})
+
+		code, report := get("/livez")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(report.Checks).NotTo(HaveKey("queue"))
+	})
+
+	It("fails readiness once shutdown begins", func() {
+		Expect(server.Shutdown(gocontext.Background())).To(Succeed())
+
+		code, _ := get("/readyz")
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+
+		code, _ = get("/healthz")
+		Expect(code).To(Equal(http.StatusOK))
+	})
+
+	It("is shut down by the shutdown hooks of its logger", func() {
+		log, err := logger.NewLogMock(logger.Settings{Output: logger.Stdiscard{}})
+		Expect(err).NotTo(HaveOccurred())
+		conventions := webserver.Settings
+		conventions.Health.ShutdownDelay = 0
+		server = webserver.New(log, webserver.WithConventions(conventions))
+
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			server.Start("127.0.0.1:0")
+		}()
+
+		Eventually(func() bool {
+			log.Shutdown()
+			select {
+			case <-stopped:
+				return true
+			default:
+				return false
+			}
+		}).Should(BeTrue())
+		Expect(server.Shutdown(gocontext.Background())).To(Succeed())
+	})
+})
@@ -0,0 +1,188 @@
+package webserver
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/webserver/context"
+	"github.com/go-gia/go-infrastructure/webserver/metrics"
+)
+
+// routeUnmatched labels requests which did not match a registered route so
+// that arbitrary URLs can not create new series.
+const routeUnmatched = "unmatched"
+
+// methodOther labels requests with a method other than the standard ones so
+// that arbitrary methods can not create new series.
+const methodOther = "OTHER"
+
+type (
+	// MetricsConventions configures the opt-in metrics subsystem.
+	MetricsConventions struct {
+		// Path is the route the metrics are exposed on.
+		Path string
+		// Namespace prefixes the name of every webserver metric.
+		Namespace string
+		// DurationBuckets are the latency histogram buckets in seconds.
+		DurationBuckets []float64
+		// SizeBuckets are the response size histogram buckets in bytes.
+		SizeBuckets []float64
+	}
+
+	// serverMetrics holds the request metrics recorded by a Server.
+	serverMetrics struct {
+		registry *metrics.Registry
+		requests *metrics.Counter
+		duration *metrics.Histogram
+		size     *metrics.Histogram
+		inFlight *metrics.Gauge
+	}
+
+	// instrumentedResponseWriter captures the status, size and matched route of
+	// a response.
+	instrumentedResponseWriter struct {
+		http.ResponseWriter
+		method string
+		status int
+		size   int
+		route  string
+	}
+)
+
+// EnableMetrics starts recording request counts, latencies, response sizes
+// and requests in flight and exposes them, in the Prometheus text format, on
+// the configured Metrics.Path. The returned Registry is where applications register
+// their own metrics to be exposed alongside the webserver's.
+func (s *Server) EnableMetrics() *metrics.Registry {
+	if s.metrics != nil {
+		return s.metrics.registry
+	}
+
+	conventions := s.settings.Metrics
+	prefix := ""
+	if conventions.Namespace != "" {
+		prefix = conventions.Namespace + "_"
+	}
+
+	registry := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: registry,
+		requests: registry.NewCounter(prefix+"http_requests_total",
+			"Total number of HTTP requests.", "method", "route", "status"),
+		duration: registry.NewHistogram(prefix+"http_request_duration_seconds",
+			"HTTP request latency in seconds.", conventions.DurationBuckets, "method", "route", "status"),
+		size: registry.NewHistogram(prefix+"http_response_size_bytes",
+			"HTTP response size in bytes.", conventions.SizeBuckets, "method", "route", "status"),
+		inFlight: registry.NewGauge(prefix+"http_requests_in_flight",
+			"Number of HTTP requests currently being served.", "method"),
+	}
+
+	if conventions.Path != "" {
+		s.RegisterHandlerDef(HandlerDef{
+			Alias:                 "Metrics",
+			Method:                GET,
+			Path:                  conventions.Path,
+			DocumentationMarkdown: "Exposes webserver and application metrics in the Prometheus text exposition format.",
+			Handler: func(c *context.Context) {
+				c.Output.Header("Content-Type", metrics.ContentType)
+				c.ResponseWriter.WriteHeader(http.StatusOK)
+				registry.WriteTo(c.ResponseWriter)
+			},
+		})
+	}
+
+	s.metrics = m
+	return registry
+}
+
+// Metrics returns the Registry created by EnableMetrics or nil if metrics are
+// not enabled.
+func (s *Server) Metrics() *metrics.Registry {
+	if s.metrics == nil {
+		return nil
+	}
+	return s.metrics.registry
+}
+
+// instrument wraps the ResponseWriter to capture the status, size and route
+// of the response for the access log, metrics and tracing. The returned
+// function records the request and must be called once it is served.
+func (s *Server) instrument(w http.ResponseWriter, req *http.Request) (http.ResponseWriter, func()) {
+	method := methodLabel(req.Method)
+	iw := &instrumentedResponseWriter{ResponseWriter: w, method: method, route: routeUnmatched}
+
+	m := s.metrics
+	if m == nil {
+		return iw, func() {}
+	}
+
+	start := time.Now()
+	m.inFlight.Inc(method)
+
+	return iw, func() {
+		m.inFlight.Dec(method)
+
+		status := iw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		code := strconv.Itoa(status)
+
+		m.requests.Inc(method, iw.route, code)
+		m.duration.Observe(time.Since(start).Seconds(), method, iw.route, code)
+		m.size.Observe(float64(iw.size), method, iw.route, code)
+	}
+}
+
+// methodLabel returns the method, or methodOther if it is not a standard HTTP
+// method.
+func methodLabel(method string) string {
+	switch method {
+	case GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return methodOther
+}
+
+// setRoute records the route template which matched the request.
+func setRoute(w http.ResponseWriter, route string) {
+	if iw, ok := w.(*instrumentedResponseWriter); ok {
+		iw.route = route
+	}
+}
+
+func (w *instrumentedResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *instrumentedResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += n
+	return n, err
+}
+
+// Flush supports streaming responses when the underlying writer does.
+func (w *instrumentedResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack supports protocols such as websockets when the underlying writer
+// does.
+func (w *instrumentedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("ResponseWriter does not support hijacking.")
+}
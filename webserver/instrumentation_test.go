@@ -0,0 +1,39 @@
+package webserver_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	It("labels requests with the route template, status and a bounded method", func() {
+		log, err := logger.New(logger.Settings{Output: logger.Stdiscard{}})
+		Expect(err).NotTo(HaveOccurred())
+		server := webserver.New(log)
+		registry := server.EnableMetrics()
+		server.GET("/orders/{id}", func(ctx *context.Context) {
+			ctx.ResponseWriter.WriteHeader(http.StatusAccepted)
+		})
+
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(webserver.GET, "/orders/7", nil))
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(webserver.GET, "/orders/8", nil))
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/orders/7", nil))
+
+		var b bytes.Buffer
+		_, err = registry.WriteTo(&b)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(b.String()).To(ContainSubstring(`gia_http_requests_total{method="GET",route="/orders/{id}",status="202"} 2`))
+		Expect(b.String()).To(MatchRegexp(`gia_http_requests_total\{method="OTHER",route="unmatched",status="\d+"\} 1`))
+		Expect(b.String()).To(ContainSubstring(`gia_http_response_size_bytes_count{method="GET",route="/orders/{id}",status="202"} 2`))
+		Expect(b.String()).NotTo(ContainSubstring("BREW"))
+	})
+})
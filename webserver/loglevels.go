@@ -0,0 +1,126 @@
+package webserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+)
+
+type (
+	// LogLevelConventions configures the opt-in endpoint used to view and
+	// change log levels while the server runs.
+	LogLevelConventions struct {
+		// Path is the route levels are read from with GET and changed with PUT.
+		Path string
+	}
+
+	// LogLevels is the JSON body read and returned by the log level endpoint.
+	// On PUT an empty Level keeps the current level and an empty module level
+	// removes the override of that module.
+	LogLevels struct {
+		Level   string            `json:"level"`
+		Modules map[string]string `json:"modules"`
+	}
+)
+
+// ErrLogLevelsUnsupported is returned by EnableLogLevelEndpoint if the
+// server's logger does not implement logger.Leveler.
+var ErrLogLevelsUnsupported = errors.New("The server's logger does not support changing levels.")
+
+// EnableLogLevelEndpoint registers GET and PUT handlers on the LogLevels.Path
+// of the server's conventions. The endpoint changes how the whole process
+// logs, so protect it with preHandlers such as an authentication check.
+func (s *Server) EnableLogLevelEndpoint(preHandlers ...HandlerDef) error {
+	leveler, ok := s.root.(logger.Leveler)
+	if !ok {
+		return ErrLogLevelsUnsupported
+	}
+
+	path := s.settings.LogLevels.Path
+
+	s.RegisterHandlerDef(HandlerDef{
+		Alias:                 "LogLevels",
+		Method:                GET,
+		Path:                  path,
+		DocumentationMarkdown: "Returns the log level and the level of every overridden module.",
+		ResponseBodyExample:   LogLevels{Level: "warn", Modules: map[string]string{"webserver.render": "debug"}},
+		PreHandlers:           preHandlers,
+		Handler: func(c *context.Context) {
+			writeLogLevels(c, leveler)
+		},
+	})
+
+	s.RegisterHandlerDef(HandlerDef{
+		Alias:                 "SetLogLevels",
+		Method:                PUT,
+		Path:                  path,
+		DocumentationMarkdown: "Changes the log level and module overrides. An empty module level removes its override.",
+		RequestBodyExample:    LogLevels{Level: "info", Modules: map[string]string{"webserver.render": ""}},
+		PreHandlers:           preHandlers,
+		Handler: func(c *context.Context) {
+			s.setLogLevels(c, leveler)
+		},
+	})
+
+	return nil
+}
+
+func (s *Server) setLogLevels(c *context.Context, leveler logger.Leveler) {
+	var levels LogLevels
+	if err := json.Unmarshal(c.Input.RequestBody, &levels); err != nil {
+		c.Output.Status = http.StatusBadRequest
+		c.Output.JSON(map[string]string{"error": err.Error()}, false)
+		return
+	}
+
+	// Validate every level before applying any so a bad request changes
+	// nothing.
+	if err := validateLogLevels(levels); err != nil {
+		c.Output.Status = http.StatusBadRequest
+		c.Output.JSON(map[string]string{"error": err.Error()}, false)
+		return
+	}
+
+	if levels.Level != "" {
+		leveler.SetLevel(levels.Level)
+	}
+	for module, level := range levels.Modules {
+		leveler.SetModuleLevel(module, level)
+	}
+
+	s.logger.Context(logger.Fields{
+		"level":   levels.Level,
+		"modules": levels.Modules,
+		"ip":      c.Input.IP(),
+	}).Warn("Log levels changed")
+
+	writeLogLevels(c, leveler)
+}
+
+func validateLogLevels(levels LogLevels) error {
+	if levels.Level != "" {
+		if err := logger.ValidateLevel(levels.Level); err != nil {
+			return err
+		}
+	}
+	for _, level := range levels.Modules {
+		if level == "" {
+			continue
+		}
+		if err := logger.ValidateLevel(level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeLogLevels(c *context.Context, leveler logger.Leveler) {
+	c.Output.Header("Cache-Control", "no-store")
+	c.Output.JSON(LogLevels{
+		Level:   leveler.Level(),
+		Modules: leveler.ModuleLevels(),
+	}, false)
+}
@@ -0,0 +1,98 @@
+package webserver_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// moduleSink records the module of every entry it receives.
+type moduleSink struct {
+	sync.Mutex
+	modules []interface{}
+}
+
+func (s *moduleSink) Write(entry logger.Entry) error {
+	s.Lock()
+	defer s.Unlock()
+	s.modules = append(s.modules, entry.Fields["module"])
+	return nil
+}
+
+func (s *moduleSink) Flush() error { return nil }
+
+var _ = Describe("LogLevels", func() {
+	var (
+		server *webserver.Server
+		log    *logger.Log
+	)
+
+	request := func(method string, body string) (int, webserver.LogLevels) {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(method, "/admin/log-levels", bytes.NewBufferString(body)))
+
+		var levels webserver.LogLevels
+		json.Unmarshal(w.Body.Bytes(), &levels)
+		return w.Code, levels
+	}
+
+	BeforeEach(func() {
+		var err error
+		log, err = logger.New(logger.Settings{Output: logger.Stdiscard{}})
+		Expect(err).NotTo(HaveOccurred())
+
+		server = webserver.New(log)
+		Expect(server.EnableLogLevelEndpoint()).To(Succeed())
+	})
+
+	It("returns the current levels", func() {
+		Expect(log.SetModuleLevel("webserver.render", "info")).To(Succeed())
+
+		code, levels := request(webserver.GET, "")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(levels.Level).To(Equal("debug"))
+		Expect(levels.Modules).To(HaveKeyWithValue("webserver.render", "info"))
+	})
+
+	It("changes levels", func() {
+		code, levels := request(webserver.PUT, `{"level": "warn", "modules": {"webserver": "debug"}}`)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(levels.Level).To(Equal("warn"))
+		Expect(log.Named("webserver").Level()).To(Equal("debug"))
+	})
+
+	It("rejects invalid levels without changing any", func() {
+		code, _ := request(webserver.PUT, `{"level": "warn", "modules": {"webserver": "loud"}}`)
+		Expect(code).To(Equal(http.StatusBadRequest))
+		Expect(log.Level()).To(Equal("debug"))
+	})
+
+	It("requires a logger that supports levels", func() {
+		mock, err := logger.NewLogMock(logger.Settings{Output: logger.Stdout{}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(webserver.New(mock).EnableLogLevelEndpoint()).To(Equal(webserver.ErrLogLevelsUnsupported))
+	})
+
+	It("logs the server and renderer under their modules", func() {
+		sink := &moduleSink{}
+		log, err := logger.New(logger.Settings{Output: sink})
+		Expect(err).NotTo(HaveOccurred())
+
+		server := webserver.New(log)
+		server.RegisterHandlerDef(webserver.HandlerDef{Method: webserver.GET, Path: "/page"})
+		Expect(sink.modules).To(ContainElement("webserver"))
+
+		Expect(log.SetModuleLevel("webserver", "info")).To(Succeed())
+		sink.modules = nil
+		server.RegisterHandlerDef(webserver.HandlerDef{Method: webserver.GET, Path: "/other"})
+		Expect(sink.modules).To(BeEmpty())
+	})
+})
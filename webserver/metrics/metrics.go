@@ -0,0 +1,360 @@
+// Package metrics records counters, gauges and histograms and exposes them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ContentType is the media type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// labelSeparator joins label values into a series key. It can not appear in
+// valid UTF-8 so distinct label values never collide.
+const labelSeparator = "\xff"
+
+var (
+	// DefaultDurationBuckets are histogram buckets, in seconds, suitable for
+	// request latencies.
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are histogram buckets, in bytes, suitable for response
+	// sizes.
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+type (
+	// Registry holds metrics and writes them in the text exposition format.
+	Registry struct {
+		sync.RWMutex
+		metrics []metric
+		names   map[string]bool
+	}
+
+	// metric is implemented by every metric type held by a Registry.
+	metric interface {
+		write(w *bufio.Writer)
+	}
+
+	// desc describes a metric family.
+	desc struct {
+		name   string
+		help   string
+		kind   string
+		labels []string
+	}
+
+	// vec holds the series of a metric family keyed by label values.
+	vec struct {
+		desc
+		sync.RWMutex
+		series    map[string]*series
+		newSeries func(values []string) *series
+	}
+
+	// series is a single time series of a metric family.
+	series struct {
+		values []string
+		// value holds the float64 bits of a counter or gauge, or the sum of a
+		// histogram.
+		value   uint64
+		count   uint64
+		buckets []uint64
+	}
+
+	// Counter is a metric which only increases, such as a count of requests.
+	Counter struct{ vec }
+
+	// Gauge is a metric which can go up and down, such as requests in flight.
+	Gauge struct{ vec }
+
+	// Histogram samples observations, such as latencies, into buckets.
+	Histogram struct {
+		vec
+		upperBounds []float64
+	}
+)
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]bool),
+	}
+}
+
+// register adds the metric to the registry. Registering the same name twice
+// is a programming error and panics.
+func (r *Registry) register(name string, m metric) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.names[name] {
+		panic("metrics: duplicate metric name " + name)
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// NewCounter registers and returns a Counter with the provided label names.
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec(desc{name, help, "counter", labels}, nil)}
+	r.register(name, c)
+	return c
+}
+
+// NewGauge registers and returns a Gauge with the provided label names.
+func (r *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{vec: newVec(desc{name, help, "gauge", labels}, nil)}
+	r.register(name, g)
+	return g
+}
+
+// NewHistogram registers and returns a Histogram with the provided bucket
+// upper bounds and label names. The +Inf bucket is added automatically.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	bounds := append([]float64{}, buckets...)
+	sort.Float64s(bounds)
+
+	h := &Histogram{upperBounds: bounds}
+	h.vec = newVec(desc{name, help, "histogram", labels}, func(values []string) *series {
+		return &series{values: values, buckets: make([]uint64, len(bounds))}
+	})
+	r.register(name, h)
+	return h
+}
+
+// WriteTo writes every metric in the text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.RLock()
+	metrics := append([]metric{}, r.metrics...)
+	r.RUnlock()
+
+	cw := &countingWriter{w: w}
+	buf := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(buf)
+	}
+	err := buf.Flush()
+
+	return cw.n, err
+}
+
+func newVec(d desc, newSeries func(values []string) *series) vec {
+	if newSeries == nil {
+		newSeries = func(values []string) *series {
+			return &series{values: values}
+		}
+	}
+	return vec{
+		desc:      d,
+		series:    make(map[string]*series),
+		newSeries: newSeries,
+	}
+}
+
+// with returns the series for the label values, creating it if needed. A
+// mismatched number of label values is a programming error and panics.
+func (v *vec) with(values []string) *series {
+	if len(values) != len(v.labels) {
+		panic("metrics: " + v.name + " expects " + strconv.Itoa(len(v.labels)) + " label values")
+	}
+
+	key := strings.Join(values, labelSeparator)
+
+	v.RLock()
+	s, ok := v.series[key]
+	v.RUnlock()
+	if ok {
+		return s
+	}
+
+	v.Lock()
+	defer v.Unlock()
+	if s, ok = v.series[key]; !ok {
+		s = v.newSeries(append([]string{}, values...))
+		v.series[key] = s
+	}
+	return s
+}
+
+// sortedSeries returns a snapshot of the series ordered by label values.
+func (v *vec) sortedSeries() []*series {
+	v.RLock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]*series, len(keys))
+	for i, key := range keys {
+		result[i] = v.series[key]
+	}
+	v.RUnlock()
+
+	return result
+}
+
+// Inc adds one to the series with the provided label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.with(labelValues).add(1)
+}
+
+// Add adds a non-negative value to the series with the provided label values.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic("metrics: counter " + c.name + " can not decrease")
+	}
+	c.with(labelValues).add(value)
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	for _, s := range c.sortedSeries() {
+		writeSample(w, c.name, c.labels, s.values, "", "", s.load())
+	}
+}
+
+// Set sets the series with the provided label values.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	atomic.StoreUint64(&g.with(labelValues).value, math.Float64bits(value))
+}
+
+// Inc adds one to the series with the provided label values.
+func (g *Gauge) Inc(labelValues ...string) {
+	g.with(labelValues).add(1)
+}
+
+// Dec subtracts one from the series with the provided label values.
+func (g *Gauge) Dec(labelValues ...string) {
+	g.with(labelValues).add(-1)
+}
+
+// Add adds the value to the series with the provided label values.
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.with(labelValues).add(value)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	for _, s := range g.sortedSeries() {
+		writeSample(w, g.name, g.labels, s.values, "", "", s.load())
+	}
+}
+
+// Observe records a value in the series with the provided label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	s := h.with(labelValues)
+
+	for i, bound := range h.upperBounds {
+		if value <= bound {
+			atomic.AddUint64(&s.buckets[i], 1)
+			break
+		}
+	}
+	s.add(value)
+	atomic.AddUint64(&s.count, 1)
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	for _, s := range h.sortedSeries() {
+		var cumulative uint64
+		for i, bound := range h.upperBounds {
+			cumulative += atomic.LoadUint64(&s.buckets[i])
+			writeSample(w, h.name+"_bucket", h.labels, s.values, "le", formatFloat(bound), float64(cumulative))
+		}
+		count := atomic.LoadUint64(&s.count)
+		writeSample(w, h.name+"_bucket", h.labels, s.values, "le", "+Inf", float64(count))
+		writeSample(w, h.name+"_sum", h.labels, s.values, "", "", s.load())
+		writeSample(w, h.name+"_count", h.labels, s.values, "", "", float64(count))
+	}
+}
+
+// add atomically adds delta to the series value.
+func (s *series) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&s.value)
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&s.value, old, updated) {
+			return
+		}
+	}
+}
+
+// load atomically reads the series value.
+func (s *series) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.value))
+}
+
+func (d *desc) writeHeader(w *bufio.Writer) {
+	w.WriteString("# HELP " + d.name + " " + escapeHelp(d.help) + "\n")
+	w.WriteString("# TYPE " + d.name + " " + d.kind + "\n")
+}
+
+// writeSample writes one sample line. An extra label, such as the histogram
+// "le", is appended when extraName is not empty.
+func writeSample(w *bufio.Writer, name string, labels []string, values []string, extraName string, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(label + `="` + escapeLabel(values[i]) + `"`)
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,61 @@
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/webserver/metrics"
+)
+
+func TestExposition(t *testing.T) {
+	r := metrics.NewRegistry()
+
+	c := r.NewCounter("jobs_total", "Jobs processed.\nBy queue.", "queue")
+	c.Inc("email")
+	c.Add(2, `say "hi"`)
+
+	g := r.NewGauge("workers", "Active workers.")
+	g.Set(3)
+	g.Dec()
+
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(5, "/a")
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal("Error", err)
+	}
+
+	expected := `# HELP jobs_total Jobs processed.\nBy queue.
+# TYPE jobs_total counter
+jobs_total{queue="email"} 1
+jobs_total{queue="say \"hi\""} 2
+# HELP workers Active workers.
+# TYPE workers gauge
+workers 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 5.55
+latency_seconds_count{route="/a"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("Expected\n%s\nbut got\n%s", expected, buf.String())
+	}
+}
+
+func TestDuplicateNamePanics(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.NewCounter("dup", "First.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Registering a duplicate name should panic")
+		}
+	}()
+	r.NewGauge("dup", "Second.")
+}
@@ -0,0 +1,104 @@
+package webserver
+
+import (
+	"time"
+
+	"github.com/go-gia/go-infrastructure/webserver/render"
+)
+
+// Option configures a Server when it is created with New. Options are applied
+// in order on top of a copy of the package level Settings.
+type Option func(*Server)
+
+// WithConventions replaces the conventions of the server. The conventions
+// are copied so later changes to c do not affect the server.
+func WithConventions(c Conventions) Option {
+	return func(s *Server) {
+		s.settings = c.clone()
+	}
+}
+
+// WithRender replaces the rendering conventions of the server.
+func WithRender(c render.Conventions) Option {
+	return func(s *Server) {
+		s.settings.Render = &c
+	}
+}
+
+// WithTemplateDirectory sets the directory the server renders views from.
+func WithTemplateDirectory(dir string) Option {
+	return func(s *Server) {
+		s.settings.Render.TemplateDirectory = dir
+	}
+}
+
+// WithSystemTemplate overrides a SystemTemplates entry such as
+// `onMissingHandler`.
+func WithSystemTemplate(key string, path string) Option {
+	return func(s *Server) {
+		s.settings.SystemTemplates[key] = path
+	}
+}
+
+// WithStaticFiles registers a url and directory path to serve static files
+// from and enables the static file server. See Server.FILES.
+func WithStaticFiles(url string, path string) Option {
+	return func(s *Server) {
+		s.FILES(url, path)
+	}
+}
+
+// WithTrustedProxies sets the CIDR ranges, or single addresses, of proxies
+// whose forwarding headers are trusted.
+func WithTrustedProxies(cidrs ...string) Option {
+	return func(s *Server) {
+		s.settings.TrustedProxies = append([]string{}, cidrs...)
+	}
+}
+
+// WithCookieKeys sets the keys used to sign and encrypt cookies. The first key
+// signs and encrypts new cookies; every key is accepted when reading.
+func WithCookieKeys(keys ...[]byte) Option {
+	return func(s *Server) {
+		s.settings.Cookies.Keys = keys
+	}
+}
+
+// WithRequestDurationWarning sets the duration after which requests are
+// flagged as slow.
+func WithRequestDurationWarning(d time.Duration) Option {
+	return func(s *Server) {
+		s.settings.RequestDurationWarning = d
+	}
+}
+
+// clone returns a copy of the conventions which shares no maps, slices or
+// pointers with the original.
+func (c Conventions) clone() Conventions {
+	r := render.Settings
+	if c.Render != nil {
+		r = *c.Render
+	}
+	c.Render = &r
+
+	systemTemplates := make(map[string]string, len(c.SystemTemplates))
+	for k, v := range c.SystemTemplates {
+		systemTemplates[k] = v
+	}
+	c.SystemTemplates = systemTemplates
+
+	staticDir := make(map[string]string, len(c.staticDir))
+	for k, v := range c.staticDir {
+		staticDir[k] = v
+	}
+	c.staticDir = staticDir
+
+	c.TrustedProxies = append([]string{}, c.TrustedProxies...)
+	c.Cookies.Keys = append([][]byte{}, c.Cookies.Keys...)
+	c.Metrics.DurationBuckets = append([]float64{}, c.Metrics.DurationBuckets...)
+	c.Metrics.SizeBuckets = append([]float64{}, c.Metrics.SizeBuckets...)
+	c.AccessLog.RedactHeaders = append([]string{}, c.AccessLog.RedactHeaders...)
+	c.AccessLog.RedactQueryParams = append([]string{}, c.AccessLog.RedactQueryParams...)
+
+	return c
+}
@@ -3,11 +3,18 @@ package render
 
 import (
 	"bytes"
+	"errors"
 	"html/template"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/go-gia/go-infrastructure/logger"
 )
 
 type (
@@ -20,21 +27,78 @@ type (
 		CacheTemplates     bool
 		DelimPrefix        string
 		DelimSuffix        string
+		// Layout is the view every view is rendered into unless Layouts or the
+		// view itself names another, for example "layouts/base". Empty renders
+		// views on their own.
+		Layout string
+		// Layouts maps prefixes of view names to their layout, for example
+		// {"admin/": "layouts/admin"}. The longest matching prefix wins.
+		Layouts map[string]string
+		// PartialsDirectory is the directory, relative to TemplateDirectory,
+		// whose templates are loaded with every view. A partial is included
+		// by its path without the extension, {{template "partials/header" .}}.
+		PartialsDirectory string
 	}
 
 	// Renderer is an interface type that different renderers should implement
 	Renderer interface {
-		Render(args ...interface{}) ([]byte, error)
+		Render(view string, args ...interface{}) ([]byte, error)
+		RenderWithFuncs(view string, funcs template.FuncMap, args ...interface{}) ([]byte, error)
 	}
 
+	// HTMLRenderer renders HTML views using its own Conventions and template
+	// cache so several webservers in one process can render from different
+	// directories.
+	HTMLRenderer struct {
+		Conventions
+		registry *templateRegistry
+		// logger receives the messages of the renderer, the global logrus
+		// logger is used until SetLogger is called.
+		logger logger.Logger
+	}
+
+	// entryLogger is the part of a logrus entry and of a
+	// logger.ContextualLogger the renderer logs with.
+	entryLogger interface {
+		Debug(args ...interface{})
+		Error(args ...interface{})
+	}
+
+	// html renders using the package Settings and is kept for applications
+	// that do not need more than one renderer.
 	html struct{}
 
 	templateRegistry struct {
 		sync.RWMutex
+		// templates are keyed by the set of files they are composed of.
 		templates map[string]*template.Template
+		// compositions are the files composed for each view.
+		compositions map[string]*composition
+		// declaration matches layout comments written with delims.
+		declaration *regexp.Regexp
+		delims      [2]string
+	}
+
+	// composition is the set of files a view is parsed from: the partials,
+	// the layouts from the outermost in and the view itself. root is the
+	// template that is executed, the outermost layout or the view.
+	composition struct {
+		key     string
+		root    string
+		names   []string
+		sources []string
 	}
 )
 
+// noLayout declared by a view renders it without the configured layout.
+const noLayout = "none"
+
+// maxLayoutDepth bounds how many layouts may wrap each other.
+const maxLayoutDepth = 16
+
+// ErrLayoutCycle is returned when the layouts of a view wrap each other.
+var ErrLayoutCycle = errors.New("The layouts of the view wrap each other.")
+
 const packagename = "webserver.render:"
 
 // Settings provides exported access to runtime configuration
@@ -46,68 +110,355 @@ var Settings = Conventions{
 	CacheTemplates:     true,
 	DelimPrefix:        "{{",
 	DelimSuffix:        "}}",
+	PartialsDirectory:  "partials/",
 }
 
 var (
 	tr templateRegistry
 	// HTML renderer which implements the Render method
 	HTML = html{}
+	// Funcs lists the helper functions available to every view. Helpers whose
+	// result depends on the request are declared here with a placeholder so
+	// views parse, and are bound per request through RenderWithFuncs.
+	Funcs = template.FuncMap{
+		"csrfField": func() template.HTML { return "" },
+		"csrfToken": func() string { return "" },
+		"cspNonce":  func() string { return "" },
+	}
 )
 
 func init() {
 	tr.templates = make(map[string]*template.Template)
+	tr.compositions = make(map[string]*composition)
+}
+
+// New returns a HTMLRenderer with the provided conventions and an empty
+// template cache.
+func New(conventions Conventions) *HTMLRenderer {
+	r := &HTMLRenderer{
+		Conventions: conventions,
+		registry: &templateRegistry{
+			templates:    make(map[string]*template.Template),
+			compositions: make(map[string]*composition),
+		},
+	}
+	r.layoutDeclaration()
+
+	return r
 }
 
 // Render executes a template returning the rendered byte array and error
 // While this method supports the Renderer interface only one args is allowed.
 func (r html) Render(view string, args ...interface{}) ([]byte, error) {
-	log.WithFields(log.Fields{"event": packagename + "Render", "view": view}).Debug("Rendering view")
+	return r.RenderWithFuncs(view, nil, args...)
+}
+
+// RenderWithFuncs executes a template like Render but binds the provided
+// request scoped helper functions, overriding any placeholders in Funcs.
+func (r html) RenderWithFuncs(view string, funcs template.FuncMap, args ...interface{}) ([]byte, error) {
+	renderer := HTMLRenderer{Conventions: Settings, registry: &tr}
+	return renderer.RenderWithFuncs(view, funcs, args...)
+}
+
+// SetLogger sends the messages of the renderer to log, such as a logger
+// named "webserver.render" so they can be given their own level.
+func (r *HTMLRenderer) SetLogger(log logger.Logger) {
+	r.logger = log
+}
+
+// entry returns the logger of the renderer carrying fields.
+func (r *HTMLRenderer) entry(fields logger.Fields) entryLogger {
+	if r.logger == nil {
+		return log.WithFields(log.Fields(fields))
+	}
+	return r.logger.Context(fields)
+}
 
-	file := Settings.TemplateDirectory + view + ".html"
-	return executeTemplate(file, args[0])
+// Render executes a template returning the rendered byte array and error
+// While this method supports the Renderer interface only one args is allowed.
+func (r *HTMLRenderer) Render(view string, args ...interface{}) ([]byte, error) {
+	return r.RenderWithFuncs(view, nil, args...)
+}
+
+// RenderWithFuncs executes a template like Render but binds the provided
+// request scoped helper functions, overriding any placeholders in Funcs.
+func (r *HTMLRenderer) RenderWithFuncs(view string, funcs template.FuncMap, args ...interface{}) ([]byte, error) {
+	r.entry(logger.Fields{"event": packagename + "Render", "view": view}).Debug("Rendering view")
+
+	return r.executeTemplate(view, funcs, args[0])
+}
+
+// CSRFFuncs returns the csrfField and csrfToken helpers bound to the token of
+// the current request. csrfField renders a hidden form input named fieldName.
+func CSRFFuncs(fieldName string, token string) template.FuncMap {
+	return template.FuncMap{
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` +
+				template.HTMLEscapeString(fieldName) + `" value="` +
+				template.HTMLEscapeString(token) + `">`)
+		},
+		"csrfToken": func() string { return token },
+	}
+}
+
+// NonceFuncs returns the cspNonce helper bound to the Content-Security-Policy
+// nonce of the current request. Use it on inline elements, for example
+// <script nonce="{{ cspNonce }}">.
+func NonceFuncs(nonce string) template.FuncMap {
+	return template.FuncMap{
+		"cspNonce": func() string { return nonce },
+	}
+}
+
+// SetCacheTemplates enables or disables template caching while the renderer
+// is in use. Disabling it discards the cached templates so edited views are
+// picked up on the next render.
+func (r *HTMLRenderer) SetCacheTemplates(enabled bool) {
+	r.registry.Lock()
+	defer r.registry.Unlock()
+
+	r.CacheTemplates = enabled
+	if !enabled {
+		r.registry.templates = make(map[string]*template.Template)
+		r.registry.compositions = make(map[string]*composition)
+	}
 }
 
 // executeTemplate ensures templates are cached
 // if caching is enabled.
-func executeTemplate(file string, data interface{}) (body []byte, err error) {
-	log.WithFields(log.Fields{"event": packagename + "Render", "file": file, "willCache": Settings.CacheTemplates}).Debug("Rendering template")
-
+func (r *HTMLRenderer) executeTemplate(view string, funcs template.FuncMap, data interface{}) (body []byte, err error) {
 	// Place a read lock on our registry
-	tr.RLock()
-	t, present := tr.templates[file]
-	tr.RUnlock()
+	r.registry.RLock()
+	cache := r.CacheTemplates
+	c, present := r.registry.compositions[view]
+	var t *template.Template
+	if present {
+		t, present = r.registry.templates[c.key]
+	}
+	r.registry.RUnlock()
+
+	r.entry(logger.Fields{"event": packagename + "Render", "view": view, "willCache": cache}).Debug("Rendering template")
 
 	// If the view is not already present in the registry
 	if !present {
-		log.WithFields(log.Fields{"event": packagename + "Render", "file": file}).Debug("Parsing template")
-
-		// Create a new template
-		t = template.New(filepath.Base(file))
+		r.entry(logger.Fields{"event": packagename + "Render", "view": view}).Debug("Parsing template")
 
-		// Enhance our template with custom format so we can reuse with JS libs?
-		t.Delims(Settings.DelimPrefix, Settings.DelimSuffix)
-		_, err = t.ParseFiles(file)
+		c, err = r.compose(view)
 		if err != nil {
-			log.WithFields(log.Fields{"event": packagename + "Render", "file": file, "error": err}).Error("Unable to parse template")
+			r.entry(logger.Fields{"event": packagename + "Render", "view": view, "error": err}).Error("Unable to compose template")
+			return
+		}
+		t, err = r.parse(c)
+		if err != nil {
+			r.entry(logger.Fields{"event": packagename + "Render", "view": view, "error": err}).Error("Unable to parse template")
 			return
 		}
 
-		if Settings.CacheTemplates {
-			log.WithFields(log.Fields{"event": packagename + "Render", "file": file}).Debug("Caching rendered template")
+		if cache {
+			r.entry(logger.Fields{"event": packagename + "Render", "view": view}).Debug("Caching rendered template")
 
-			tr.Lock()
-			tr.templates[file] = t
-			tr.Unlock()
+			r.registry.Lock()
+			r.registry.compositions[view] = &composition{key: c.key, root: c.root}
+			r.registry.templates[c.key] = t
+			r.registry.Unlock()
 		}
 	}
 
+	// Cached templates are never executed directly so they can always be
+	// cloned and bound to request scoped helpers.
+	t, err = t.Clone()
+	if err != nil {
+		r.entry(logger.Fields{"event": packagename + "Render", "view": view, "error": err}).Error("Unable to clone template")
+		return
+	}
+	if len(funcs) > 0 {
+		t.Funcs(funcs)
+	}
+
 	var buf bytes.Buffer
-	err = t.Execute(&buf, data)
+	err = t.ExecuteTemplate(&buf, c.root, data)
 	if err != nil {
-		log.WithFields(log.Fields{"event": packagename + "Render", "file": file, "error": err}).Debug("Unable to execute template")
+		r.entry(logger.Fields{"event": packagename + "Render", "view": view, "error": err}).Debug("Unable to execute template")
 
 		return
 	}
 
 	return buf.Bytes(), nil
 }
+
+// compose reads the view, the layouts wrapping it and the partials. The
+// layout is the one the view declares with a leading comment such as
+// {{/* layout: layouts/base */}}, or else the configured one. Layouts may
+// declare layouts of their own; a view declaring "none" has no layout.
+func (r *HTMLRenderer) compose(view string) (*composition, error) {
+	c := &composition{}
+
+	partials, err := r.partials()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range partials {
+		if name == view {
+			continue
+		}
+		if err := c.add(r.file(name), name); err != nil {
+			return nil, err
+		}
+	}
+
+	source, err := ioutil.ReadFile(r.file(view))
+	if err != nil {
+		return nil, err
+	}
+	layout := r.declaredLayout(source)
+	if layout == "" {
+		layout = r.configuredLayout(view)
+	}
+
+	c.root = view
+	wrapped := []string{view}
+	var layouts [][]byte
+	for layout != "" && layout != noLayout {
+		for _, name := range wrapped {
+			if name == layout {
+				return nil, ErrLayoutCycle
+			}
+		}
+		if len(wrapped) > maxLayoutDepth {
+			return nil, ErrLayoutCycle
+		}
+
+		b, err := ioutil.ReadFile(r.file(layout))
+		if err != nil {
+			return nil, err
+		}
+		layouts = append([][]byte{b}, layouts...)
+		wrapped = append([]string{layout}, wrapped...)
+		c.root = layout
+		layout = r.declaredLayout(b)
+	}
+
+	// The outermost layout is parsed first so the blocks it declares can be
+	// redefined by the layouts and the view it wraps.
+	for i, b := range layouts {
+		c.addSource(r.file(wrapped[i]), wrapped[i], b)
+	}
+	c.addSource(r.file(view), view, source)
+
+	return c, nil
+}
+
+// add reads file as the template name.
+func (c *composition) add(file string, name string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	c.addSource(file, name, b)
+	return nil
+}
+
+// addSource adds the contents of file as the template name and extends the
+// key with the file.
+func (c *composition) addSource(file string, name string, source []byte) {
+	c.names = append(c.names, name)
+	c.sources = append(c.sources, string(source))
+	if c.key != "" {
+		c.key += "\n"
+	}
+	c.key += file
+}
+
+// parse parses the templates of c, with the root template executing the
+// composed page.
+func (r *HTMLRenderer) parse(c *composition) (*template.Template, error) {
+	t := template.New(c.root).Funcs(Funcs)
+
+	// Enhance our template with custom format so we can reuse with JS libs?
+	t.Delims(r.DelimPrefix, r.DelimSuffix)
+	for i, name := range c.names {
+		target := t
+		if name != c.root {
+			target = t.New(name)
+		}
+		if _, err := target.Parse(c.sources[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// file returns the path of the view or layout name.
+func (r *HTMLRenderer) file(name string) string {
+	return r.TemplateDirectory + name + ".html"
+}
+
+// partials returns the names of the templates in PartialsDirectory, which
+// need not exist.
+func (r *HTMLRenderer) partials() ([]string, error) {
+	if r.PartialsDirectory == "" {
+		return nil, nil
+	}
+
+	root := r.TemplateDirectory + r.PartialsDirectory
+	var names []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".html" {
+			return nil
+		}
+		rel, err := filepath.Rel(r.TemplateDirectory, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, strings.TrimSuffix(filepath.ToSlash(rel), ".html"))
+		return nil
+	})
+	sort.Strings(names)
+
+	return names, err
+}
+
+// declaredLayout returns the layout named by a leading layout comment of
+// source, such as {{/* layout: layouts/base */}}.
+func (r *HTMLRenderer) declaredLayout(source []byte) string {
+	if m := r.layoutDeclaration().FindSubmatch(source); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// layoutDeclaration returns the pattern of layout comments for the
+// delimiters of the conventions, compiling it only when they change.
+func (r *HTMLRenderer) layoutDeclaration() *regexp.Regexp {
+	delims := [2]string{r.DelimPrefix, r.DelimSuffix}
+
+	r.registry.Lock()
+	defer r.registry.Unlock()
+
+	if r.registry.declaration == nil || r.registry.delims != delims {
+		r.registry.declaration = regexp.MustCompile(`^\s*` + regexp.QuoteMeta(delims[0]) +
+			`(?:- )?/\*\s*layout:\s*([^\s*]+)\s*\*/(?: -)?` + regexp.QuoteMeta(delims[1]))
+		r.registry.delims = delims
+	}
+
+	return r.registry.declaration
+}
+
+// configuredLayout returns the layout of the longest prefix of view in
+// Layouts, or else Layout.
+func (r *HTMLRenderer) configuredLayout(view string) string {
+	layout, longest := r.Layout, -1
+	for prefix, l := range r.Layouts {
+		if strings.HasPrefix(view, prefix) && len(prefix) > longest {
+			layout, longest = l, len(prefix)
+		}
+	}
+	return layout
+}
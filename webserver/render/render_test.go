@@ -0,0 +1,149 @@
+package render_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver/render"
+)
+
+// writeTemplates writes files, keyed by their path relative to a temporary
+// template directory, and returns the directory.
+func writeTemplates(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "render")
+	if err != nil {
+		t.Fatal("Error", err)
+	}
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal("Error", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal("Error", err)
+		}
+	}
+	return dir + "/"
+}
+
+func TestRenderLayouts(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layouts/base.html":    `<html><title>{{block "title" .}}Site{{end}}</title>{{template "partials/header" .}}{{block "content" .}}{{end}}</html>`,
+		"layouts/admin.html":   `{{/* layout: layouts/base */}}{{define "content"}}<admin>{{block "panel" .}}{{end}}</admin>{{end}}`,
+		"partials/header.html": `<header>{{.}}</header>`,
+		"home.html":            `{{define "title"}}Home{{end}}{{define "content"}}<p>{{.}}</p>{{end}}`,
+		"admin/users.html":     `{{define "panel"}}<users>{{.}}</users>{{end}}`,
+		"plain.html":           `{{- /* layout: none */ -}}<p>{{.}}</p>`,
+		"loop/a.html":          `{{/* layout: loop/b */}}a`,
+		"loop/b.html":          `{{/* layout: loop/a */}}b`,
+	})
+	defer os.RemoveAll(dir)
+
+	conventions := render.Settings
+	conventions.TemplateDirectory = dir
+	conventions.Layout = "layouts/base"
+	conventions.Layouts = map[string]string{"admin/": "layouts/admin"}
+	r := render.New(conventions)
+
+	tests := []struct {
+		view string
+		body string
+	}{
+		{view: "home", body: `<html><title>Home</title><header>x</header><p>x</p></html>`},
+		{view: "admin/users", body: `<html><title>Site</title><header>x</header><admin><users>x</users></admin></html>`},
+		{view: "plain", body: `<p>x</p>`},
+	}
+
+	for _, test := range tests {
+		body, err := r.Render(test.view, "x")
+		if err != nil {
+			t.Fatal("Error", test.view, err)
+		}
+		if string(body) != test.body {
+			t.Errorf("%s: expected %q, got %q", test.view, test.body, body)
+		}
+	}
+
+	if _, err := r.Render("loop/a", "x"); err != render.ErrLayoutCycle {
+		t.Errorf("expected %v, got %v", render.ErrLayoutCycle, err)
+	}
+}
+
+func TestRenderCachesCompositions(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layout.html": `<main>{{block "content" .}}{{end}}</main>`,
+		"view.html":   `{{/* layout: layout */}}{{define "content"}}{{.}}{{end}}`,
+	})
+	defer os.RemoveAll(dir)
+
+	conventions := render.Settings
+	conventions.TemplateDirectory = dir
+	r := render.New(conventions)
+
+	if body, err := r.Render("view", "cached"); err != nil || string(body) != "<main>cached</main>" {
+		t.Fatal("Error", string(body), err)
+	}
+
+	// The cached composition is rendered until caching is reset.
+	if err := ioutil.WriteFile(filepath.Join(dir, "layout.html"), []byte(`<section>{{block "content" .}}{{end}}</section>`), 0644); err != nil {
+		t.Fatal("Error", err)
+	}
+	if body, _ := r.Render("view", "cached"); !strings.HasPrefix(string(body), "<main>") {
+		t.Errorf("expected the cached layout, got %q", body)
+	}
+
+	r.SetCacheTemplates(false)
+	if body, _ := r.Render("view", "fresh"); string(body) != "<section>fresh</section>" {
+		t.Errorf("expected the changed layout, got %q", body)
+	}
+}
+
+func TestRenderLogsToLogger(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{"view.html": `{{.}}`})
+	defer os.RemoveAll(dir)
+
+	log, err := logger.NewLogMock(logger.Settings{Output: logger.Stdout{Level: "debug"}})
+	if err != nil {
+		t.Fatal("Error", err)
+	}
+
+	conventions := render.Settings
+	conventions.TemplateDirectory = dir
+	r := render.New(conventions)
+	r.SetLogger(log)
+
+	if _, err := r.Render("view", "x"); err != nil {
+		t.Fatal("Error", err)
+	}
+	if entries := log.FindEntries(logger.DebugLevel, "Rendering view", logger.Fields{"view": "view"}); len(entries) != 1 {
+		t.Errorf("Expected the renderer to log to its logger, got %v", entries)
+	}
+	if _, err := r.Render("missing", "x"); err == nil {
+		t.Fatal("Expected an error for a missing view")
+	}
+	if entries := log.FindEntries(logger.ErrorLevel, "Unable to compose template", logger.Fields{"view": "missing"}); len(entries) != 1 {
+		t.Errorf("Expected the error to be logged, got %v", entries)
+	}
+}
+
+func TestRenderLayoutDelimiters(t *testing.T) {
+	dir := writeTemplates(t, map[string]string{
+		"layout.html": `<main>[[block "content" .]][[end]]</main>`,
+		"view.html":   `[[/* layout: layout */]][[define "content"]][[.]][[end]]`,
+	})
+	defer os.RemoveAll(dir)
+
+	conventions := render.Settings
+	conventions.TemplateDirectory = dir
+	conventions.DelimPrefix = "[["
+	conventions.DelimSuffix = "]]"
+	r := render.New(conventions)
+
+	if body, err := r.Render("view", "x"); err != nil || string(body) != "<main>x</main>" {
+		t.Errorf("expected the layout declared with the delimiters, got %q, %v", body, err)
+	}
+}
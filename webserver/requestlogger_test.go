@@ -0,0 +1,55 @@
+package webserver_test
+
+import (
+	"net/http/httptest"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Request logger", func() {
+	var (
+		server *webserver.Server
+		log    *logger.MockLog
+	)
+
+	BeforeEach(func() {
+		var err error
+		log, err = logger.NewLogMock(logger.Settings{Output: logger.Stdout{Level: "info"}})
+		Expect(err).NotTo(HaveOccurred())
+		server = webserver.New(log)
+	})
+
+	It("carries the route and request metadata", func() {
+		server.GET("/users/{id}", func(ctx *context.Context) {
+			ctx.Logger().With(logger.Fields{"user": ctx.Input.ParamByName("id")}).Info("Loaded user")
+		})
+
+		req := httptest.NewRequest(webserver.GET, "/users/42", nil)
+		req.Header.Set("X-Request-Id", "abc123")
+		server.ServeHTTP(httptest.NewRecorder(), req)
+
+		Expect(log.HasEntry(logger.InfoLevel, "Loaded user", logger.Fields{
+			"method":      "GET",
+			"route":       "/users/{id}",
+			"requestPath": "/users/42",
+			"requestId":   "abc123",
+			"user":        "42",
+		})).To(BeTrue(), "%v", log.Entries())
+	})
+
+	It("reaches functions through the request context", func() {
+		audit := func(ctx *context.Context) {
+			logger.FromContext(ctx.Request.Context()).Warn("Audited")
+		}
+		server.GET("/audit", audit)
+
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(webserver.GET, "/audit", nil))
+
+		Expect(log.HasEntry(logger.WarnLevel, "Audited", logger.Fields{"route": "/audit"})).To(BeTrue())
+	})
+})
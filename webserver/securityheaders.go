@@ -0,0 +1,191 @@
+package webserver
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+	"github.com/go-gia/go-infrastructure/webserver/render"
+)
+
+// SecurityHeadersConventions defines the response headers applied by the
+// SecurityHeaders PreHandler. Empty values omit the header.
+type SecurityHeadersConventions struct {
+	// HSTSMaxAge sets Strict-Transport-Security on secure requests. Zero
+	// disables the header.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// ContentTypeNosniff sets X-Content-Type-Options to nosniff.
+	ContentTypeNosniff bool
+	FrameOptions       string
+	ReferrerPolicy     string
+	PermissionsPolicy  string
+	// ContentSecurityPolicy is the policy sent to the client. Each occurrence
+	// of CSPNoncePlaceholder is replaced with a nonce generated per request
+	// which templates reach through {{ cspNonce }}.
+	ContentSecurityPolicy string
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only so
+	// violations are reported but not enforced.
+	CSPReportOnly bool
+	// CSPReportPath is the path the CSPReport HandlerDef registers on. Once
+	// it is registered the path is appended to the policy as the report-uri.
+	CSPReportPath string
+}
+
+const (
+	// CSPNoncePlaceholder is replaced with the per request nonce in
+	// SecurityHeadersConventions.ContentSecurityPolicy.
+	CSPNoncePlaceholder = "{nonce}"
+	// CSPNonceKey is the context Dictionary key holding the per request nonce.
+	CSPNonceKey = "webserver.cspNonce"
+	// cspNonceLength is the number of random bytes in a nonce.
+	cspNonceLength = 16
+	// cspReportMaxBytes limits the size of violation reports that are read.
+	cspReportMaxBytes = 64 * 1024
+)
+
+// SecurityHeaders returns a HandlerDef to use as a PreHandler that applies
+// the headers configured in the server's SecurityHeaders conventions.
+func (s *Server) SecurityHeaders() HandlerDef {
+	return HandlerDef{
+		Alias:                 "SecurityHeaders",
+		DocumentationMarkdown: "Applies HSTS, X-Content-Type-Options, X-Frame-Options, Referrer-Policy, Permissions-Policy and Content-Security-Policy response headers.",
+		Handler:               s.securityHeadersHandler,
+	}
+}
+
+func (s *Server) securityHeadersHandler(c *context.Context) {
+	conventions := s.settings.SecurityHeaders
+
+	if conventions.HSTSMaxAge > 0 && c.Input.IsSecure() {
+		hsts := "max-age=" + strconv.FormatInt(int64(conventions.HSTSMaxAge/time.Second), 10)
+		if conventions.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if conventions.HSTSPreload {
+			hsts += "; preload"
+		}
+		c.Output.Header("Strict-Transport-Security", hsts)
+	}
+	if conventions.ContentTypeNosniff {
+		c.Output.Header("X-Content-Type-Options", "nosniff")
+	}
+	if conventions.FrameOptions != "" {
+		c.Output.Header("X-Frame-Options", conventions.FrameOptions)
+	}
+	if conventions.ReferrerPolicy != "" {
+		c.Output.Header("Referrer-Policy", conventions.ReferrerPolicy)
+	}
+	if conventions.PermissionsPolicy != "" {
+		c.Output.Header("Permissions-Policy", conventions.PermissionsPolicy)
+	}
+
+	policy := conventions.ContentSecurityPolicy
+	if policy == "" {
+		return
+	}
+
+	if strings.Contains(policy, CSPNoncePlaceholder) {
+		nonce, err := newCSPNonce()
+		if err != nil {
+			s.logger.Context(logger.Fields{"error": err}).Error("Unable to generate CSP nonce")
+			c.BreakHandlerChain = true
+			c.InternalError(nil)
+			return
+		}
+		policy = strings.Replace(policy, CSPNoncePlaceholder, nonce, -1)
+		c.Set(CSPNonceKey, nonce)
+		c.SetTemplateFuncs(render.NonceFuncs(nonce))
+	}
+
+	if conventions.CSPReportPath != "" && s.cspReport {
+		policy += "; report-uri " + conventions.CSPReportPath
+	}
+
+	if conventions.CSPReportOnly {
+		c.Output.Header("Content-Security-Policy-Report-Only", policy)
+	} else {
+		c.Output.Header("Content-Security-Policy", policy)
+	}
+}
+
+// CSPReport returns a HandlerDef which accepts Content-Security-Policy
+// violation reports on the configured SecurityHeaders.CSPReportPath and logs
+// them.
+func (s *Server) CSPReport() HandlerDef {
+	return HandlerDef{
+		Alias:                 "CSPReport",
+		Method:                POST,
+		Path:                  s.settings.SecurityHeaders.CSPReportPath,
+		DocumentationMarkdown: "Receives Content-Security-Policy violation reports from browsers and logs them.",
+		Handler:               s.cspReportHandler,
+	}
+}
+
+func (s *Server) cspReportHandler(c *context.Context) {
+	c.Output.Status = http.StatusNoContent
+
+	// The route limits the body to one byte more than is accepted.
+	body := c.Input.RequestBody
+	if len(body) > cspReportMaxBytes {
+		s.logger.Context(logger.Fields{"bytes": len(body)}).Warn("Discarding oversized CSP violation report")
+		c.Output.Body([]byte{})
+		return
+	}
+
+	var report interface{}
+	if err := json.Unmarshal(body, &report); err != nil {
+		s.logger.Context(logger.Fields{"error": err}).Debug("Unable to parse CSP violation report")
+		c.Output.Body([]byte{})
+		return
+	}
+
+	fields := logger.Fields{
+		"userAgent": c.Input.UserAgent(),
+		"ip":        c.Input.IP(),
+	}
+	// Browsers send a single {"csp-report": {...}} object or, with the
+	// Reporting API, an array of reports with a "body".
+	switch v := report.(type) {
+	case map[string]interface{}:
+		if r, ok := v["csp-report"]; ok {
+			fields["report"] = r
+		} else {
+			fields["report"] = v
+		}
+	default:
+		fields["report"] = v
+	}
+
+	s.logger.Context(fields).Warn("Content-Security-Policy violation reported")
+	c.Output.Body([]byte{})
+}
+
+// withCSPNonce returns a built-in page with the nonce of the request, if the
+// SecurityHeaders PreHandler generated one, in the nonce attributes of its
+// inline elements.
+func withCSPNonce(c *context.Context, page string) []byte {
+	nonce, _ := c.Get(CSPNonceKey).(string)
+	if nonce == "" {
+		return []byte(strings.Replace(page, ` nonce="{{cspNonce}}"`, "", -1))
+	}
+	return []byte(strings.Replace(page, "{{cspNonce}}", nonce, -1))
+}
+
+// newCSPNonce returns a random nonce in the URL safe base64 alphabet, which
+// templates write into attributes without escaping.
+func newCSPNonce() (string, error) {
+	b := make([]byte, cspNonceLength)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,153 @@
+package webserver_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Security headers", func() {
+	var (
+		server      *webserver.Server
+		log         *logger.MockLog
+		conventions webserver.Conventions
+		views       string
+	)
+
+	nonce := regexp.MustCompile(`'nonce-([^']+)'`)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, req)
+		return w
+	}
+
+	BeforeEach(func() {
+		var err error
+		log, err = logger.NewLogMock(logger.Settings{Output: logger.Stdout{Level: "debug"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		views, err = ioutil.TempDir("", "views")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(views, "page.html"), []byte(`<script nonce="{{ cspNonce }}"></script>`), 0644)).To(Succeed())
+
+		conventions = webserver.Settings
+		render := *conventions.Render
+		render.TemplateDirectory = views + "/"
+		conventions.Render = &render
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(views)
+	})
+
+	register := func() {
+		server = webserver.New(log, webserver.WithConventions(conventions))
+		server.RegisterHandlerDef(webserver.HandlerDef{
+			Method:      webserver.GET,
+			Path:        "/page",
+			PreHandlers: []webserver.HandlerDef{server.SecurityHeaders()},
+			Handler: func(c *context.Context) {
+				Expect(c.HTMLTemplate("page", nil)).To(Succeed())
+			},
+		})
+	}
+
+	It("applies the configured headers and binds the nonce to views", func() {
+		register()
+
+		req := httptest.NewRequest(webserver.GET, "https://example.com/page", nil)
+		w := serve(req)
+
+		Expect(w.Header().Get("Strict-Transport-Security")).To(Equal("max-age=31536000; includeSubDomains"))
+		Expect(w.Header().Get("X-Content-Type-Options")).To(Equal("nosniff"))
+		Expect(w.Header().Get("X-Frame-Options")).To(Equal("DENY"))
+		Expect(w.Header().Get("Referrer-Policy")).To(Equal("strict-origin-when-cross-origin"))
+		Expect(w.Header().Get("Permissions-Policy")).To(Equal("camera=(), microphone=(), geolocation=()"))
+
+		policy := w.Header().Get("Content-Security-Policy")
+		Expect(policy).NotTo(ContainSubstring(webserver.CSPNoncePlaceholder))
+		Expect(policy).NotTo(ContainSubstring("report-uri"))
+		m := nonce.FindStringSubmatch(policy)
+		Expect(m).NotTo(BeNil())
+		Expect(w.Body.String()).To(Equal(`<script nonce="` + m[1] + `"></script>`))
+
+		other := serve(httptest.NewRequest(webserver.GET, "https://example.com/page", nil))
+		Expect(other.Header().Get("Content-Security-Policy")).NotTo(Equal(policy))
+	})
+
+	It("omits HSTS on insecure requests", func() {
+		register()
+
+		w := serve(httptest.NewRequest(webserver.GET, "/page", nil))
+		Expect(w.Header()).NotTo(HaveKey("Strict-Transport-Security"))
+		Expect(w.Header().Get("Content-Security-Policy")).NotTo(BeEmpty())
+	})
+
+	It("reports without enforcing in report-only mode", func() {
+		conventions.SecurityHeaders.CSPReportOnly = true
+		register()
+
+		w := serve(httptest.NewRequest(webserver.GET, "/page", nil))
+		Expect(w.Header()).NotTo(HaveKey("Content-Security-Policy"))
+		Expect(w.Header().Get("Content-Security-Policy-Report-Only")).To(ContainSubstring("default-src 'self'"))
+	})
+
+	Context("with the report handler registered", func() {
+		BeforeEach(func() {
+			register()
+			server.RegisterHandlerDef(server.CSPReport())
+		})
+
+		It("adds the report-uri to the policy", func() {
+			w := serve(httptest.NewRequest(webserver.GET, "/page", nil))
+			Expect(w.Header().Get("Content-Security-Policy")).To(HaveSuffix("; report-uri /csp-report"))
+		})
+
+		It("logs violation reports", func() {
+			body := `{"csp-report": {"document-uri": "https://example.com/page", "violated-directive": "script-src"}}`
+			w := serve(httptest.NewRequest(webserver.POST, "/csp-report", strings.NewReader(body)))
+
+			Expect(w.Code).To(Equal(http.StatusNoContent))
+			entries := log.FindEntries(logger.WarnLevel, "Content-Security-Policy violation reported", nil)
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Fields["report"]).To(HaveKeyWithValue("violated-directive", "script-src"))
+		})
+
+		It("discards oversized reports without reading them", func() {
+			body := `{"csp-report": {"document-uri": "` + strings.Repeat("a", 128*1024) + `"}}`
+			w := serve(httptest.NewRequest(webserver.POST, "/csp-report", strings.NewReader(body)))
+
+			Expect(w.Code).To(Equal(http.StatusNoContent))
+			Expect(log.FindEntries(logger.WarnLevel, "Discarding oversized CSP violation report", logger.Fields{"bytes": 64*1024 + 1})).To(HaveLen(1))
+			Expect(log.FindEntries(logger.WarnLevel, "Content-Security-Policy violation reported", nil)).To(BeEmpty())
+		})
+	})
+
+	It("styles the built-in pages with the nonce of the policy", func() {
+		server = webserver.New(log, webserver.WithConventions(conventions))
+		server.RegisterHandlerDef(webserver.HandlerDef{
+			Method:      webserver.POST,
+			Path:        "/form",
+			PreHandlers: []webserver.HandlerDef{server.SecurityHeaders(), server.CSRF()},
+			Handler:     func(c *context.Context) {},
+		})
+
+		w := serve(httptest.NewRequest(webserver.POST, "/form", nil))
+		Expect(w.Code).To(Equal(http.StatusForbidden))
+		m := nonce.FindStringSubmatch(w.Header().Get("Content-Security-Policy"))
+		Expect(m).NotTo(BeNil())
+		Expect(w.Body.String()).To(ContainSubstring(`<style nonce="` + m[1] + `">`))
+	})
+})
@@ -0,0 +1,99 @@
+package webserver_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/webserver"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		log         logger.Logger
+		public      string
+		admin       string
+		publicFiles string
+		adminFiles  string
+	)
+
+	write := func(path string, content string) {
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+	}
+
+	get := func(s *webserver.Server, path string) (int, string) {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(webserver.GET, path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	BeforeEach(func() {
+		var err error
+		log, err = logger.New(logger.Settings{Output: logger.Stdiscard{}})
+		Expect(err).NotTo(HaveOccurred())
+
+		public, err = ioutil.TempDir("", "public")
+		Expect(err).NotTo(HaveOccurred())
+		admin, err = ioutil.TempDir("", "admin")
+		Expect(err).NotTo(HaveOccurred())
+
+		write(filepath.Join(public, "html", "index.html"), "public view")
+		write(filepath.Join(admin, "html", "index.html"), "admin view")
+
+		publicFiles = filepath.Join(public, "static")
+		adminFiles = filepath.Join(admin, "static")
+		write(filepath.Join(publicFiles, "app.css"), "public css")
+		write(filepath.Join(adminFiles, "app.css"), "admin css")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(public)
+		os.RemoveAll(admin)
+	})
+
+	It("keeps template directories and static roots separate between servers", func() {
+		render := func(c *context.Context) {
+			Expect(c.HTMLTemplate("index", nil)).To(Succeed())
+		}
+
+		publicServer := webserver.New(log,
+			webserver.WithTemplateDirectory(filepath.Join(public, "html")+"/"),
+			webserver.WithStaticFiles("/assets", publicFiles))
+		adminServer := webserver.New(log,
+			webserver.WithTemplateDirectory(filepath.Join(admin, "html")+"/"))
+		adminServer.FILES("assets", adminFiles)
+
+		publicServer.GET("/", render)
+		adminServer.GET("/", render)
+
+		_, body := get(publicServer, "/")
+		Expect(body).To(Equal("public view"))
+		_, body = get(adminServer, "/")
+		Expect(body).To(Equal("admin view"))
+
+		_, body = get(publicServer, "/assets/app.css")
+		Expect(body).To(Equal("public css"))
+		_, body = get(adminServer, "/assets/app.css")
+		Expect(body).To(Equal("admin css"))
+	})
+
+	It("does not enable the static file server of other servers", func() {
+		withFiles := webserver.New(log, webserver.WithStaticFiles("/assets", publicFiles))
+		withoutFiles := webserver.New(log)
+
+		code, _ := get(withFiles, "/assets/app.css")
+		Expect(code).To(Equal(http.StatusOK))
+		code, _ = get(withoutFiles, "/assets/app.css")
+		Expect(code).To(Equal(http.StatusNotFound))
+		Expect(webserver.Settings.EnableStaticFileServer).To(BeFalse())
+		Expect(withFiles.Settings().EnableStaticFileServer).To(BeTrue())
+	})
+})
@@ -0,0 +1,106 @@
+package webserver
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/tracing"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+)
+
+const (
+	// stagePre labels spans of PreHandlers.
+	stagePre = "pre"
+	// stageTarget labels the span of the primary HandlerFunc.
+	stageTarget = "target"
+	// stagePost labels spans of PostHandlers.
+	stagePost = "post"
+)
+
+// namedHandler pairs a HandlerFunc with the name used for its span.
+type namedHandler struct {
+	name    string
+	handler HandlerFunc
+}
+
+// EnableTracing starts a server span for every request, continuing any trace
+// received in the traceparent and tracestate headers, and a child span for
+// every handler in the pre, target and post chain. Handlers reach the active
+// span through tracing.FromContext(ctx.Request.Context()).
+func (s *Server) EnableTracing(exporter tracing.Exporter) *tracing.Tracer {
+	s.tracer = tracing.NewTracer(exporter)
+	return s.tracer
+}
+
+// startRequestSpan starts the server span for the request and returns the
+// request carrying it. The span is nil when tracing is disabled.
+func (s *Server) startRequestSpan(req *http.Request) (*http.Request, *tracing.Span) {
+	if s.tracer == nil {
+		return req, nil
+	}
+
+	parent, _ := tracing.Extract(req.Header)
+	span := s.tracer.Start(req.Method, tracing.SpanKindServer, parent)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.target", req.URL.Path)
+
+	return req.WithContext(tracing.NewContext(req.Context(), span)), span
+}
+
+// endRequestSpan records the route and status of the response and ends the
+// span.
+func (s *Server) endRequestSpan(span *tracing.Span, w http.ResponseWriter) {
+	if span == nil {
+		return
+	}
+
+	if iw, ok := w.(*instrumentedResponseWriter); ok {
+		status := iw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetName(iw.method + " " + iw.route)
+		span.SetAttribute("http.route", iw.route)
+		span.SetAttribute("http.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(tracing.StatusError, strconv.Itoa(status)+" "+http.StatusText(status))
+		}
+	}
+
+	span.End()
+}
+
+// runHandler executes the handler inside a child span of the request span.
+func runHandler(event *context.Context, h namedHandler, stage string) {
+	parent := tracing.FromContext(event.Request.Context())
+	if parent == nil {
+		h.handler(event)
+		return
+	}
+
+	span := parent.StartChild(h.name, tracing.SpanKindInternal)
+	span.SetAttribute("handler.stage", stage)
+
+	event.Request = event.Request.WithContext(tracing.NewContext(event.Request.Context(), span))
+	event.Input.Request = event.Request
+
+	h.handler(event)
+
+	// Keep any request or context the handler set and only restore the
+	// parent span for the handlers that follow.
+	event.Request = event.Request.WithContext(tracing.NewContext(event.Request.Context(), parent))
+	event.Input.Request = event.Request
+	span.End()
+}
+
+// spanFields returns the trace and span IDs to add to log entries.
+func spanFields(span *tracing.Span, fields logger.Fields) logger.Fields {
+	if span == nil {
+		return fields
+	}
+	for k, v := range span.Fields() {
+		fields[k] = v
+	}
+	return fields
+}
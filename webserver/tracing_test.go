@@ -0,0 +1,79 @@
+package webserver_test
+
+import (
+	gocontext "context"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/tracing"
+	"github.com/go-gia/go-infrastructure/webserver"
+	"github.com/go-gia/go-infrastructure/webserver/context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recordingExporter keeps the spans it receives.
+type recordingExporter struct {
+	sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (e *recordingExporter) ExportSpan(span tracing.SpanData) {
+	e.Lock()
+	defer e.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+func (e *recordingExporter) Flush() error { return nil }
+
+// span returns the recorded span named name.
+func (e *recordingExporter) span(name string) tracing.SpanData {
+	e.Lock()
+	defer e.Unlock()
+	for _, s := range e.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return tracing.SpanData{}
+}
+
+type requestKey struct{}
+
+var _ = Describe("Tracing", func() {
+	It("keeps context set by PreHandlers while restoring the request span", func() {
+		log, err := logger.New(logger.Settings{Output: logger.Stdiscard{}})
+		Expect(err).NotTo(HaveOccurred())
+		server := webserver.New(log)
+		exporter := &recordingExporter{}
+		server.EnableTracing(exporter)
+
+		var value interface{}
+		var parent string
+		server.RegisterHandlerDef(webserver.HandlerDef{
+			Alias:  "target",
+			Method: webserver.GET,
+			Path:   "/traced",
+			PreHandlers: []webserver.HandlerDef{{
+				Alias: "authenticate",
+				Handler: func(c *context.Context) {
+					c.Request = c.Request.WithContext(gocontext.WithValue(c.Request.Context(), requestKey{}, "alice"))
+				},
+			}},
+			Handler: func(c *context.Context) {
+				value = c.Input.Request.Context().Value(requestKey{})
+				parent = tracing.FromContext(c.Request.Context()).Context().SpanID.String()
+			},
+		})
+
+		server.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(webserver.GET, "/traced", nil))
+
+		Expect(value).To(Equal("alice"))
+		Expect(exporter.span("GET /traced").SpanID).NotTo(BeEmpty())
+		Expect(parent).To(Equal(exporter.span("target").SpanID))
+		Expect(exporter.span("target").ParentSpanID).To(Equal(exporter.span("GET /traced").SpanID))
+		Expect(exporter.span("authenticate").ParentSpanID).To(Equal(exporter.span("GET /traced").SpanID))
+	})
+})
@@ -5,15 +5,19 @@
 package webserver
 
 import (
+	gocontext "context"
 	"errors"
 	"net/http"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-gia/go-infrastructure/logger"
+	"github.com/go-gia/go-infrastructure/tracing"
 	"github.com/go-gia/go-infrastructure/webserver/context"
+	"github.com/go-gia/go-infrastructure/webserver/metrics"
 	"github.com/go-gia/go-infrastructure/webserver/render"
 	"github.com/gorilla/mux"
 )
@@ -42,7 +46,7 @@ const defaultResponse404 = `
 <html>
   <head>
     <title>404 Not Found</title>
-    <style>
+    <style nonce="{{cspNonce}}">
       body {
         background-color:black;
         color:white;
@@ -65,7 +69,7 @@ const defaultResponseDirectoryListingForbidden = `
 <html>
   <head>
     <title>403 Forbidden</title>
-    <style>
+    <style nonce="{{cspNonce}}">
       body {
         background-color:black;
         color:white;
@@ -94,7 +98,35 @@ type (
 		HandlerDef      map[string]HandlerDef
 		handlerDefMutex sync.Mutex
 
+		// trustedProxies are the networks whose forwarding headers are believed
+		trustedProxies *context.TrustedProxies
+
+		// health holds the registered health checks
+		health healthRegistry
+		// httpServer is the listener created by Start
+		httpServer *http.Server
+		// metrics is nil unless EnableMetrics has been called
+		metrics *serverMetrics
+		// tracer is nil unless EnableTracing has been called
+		tracer *tracing.Tracer
+		// cspReport is set once a POST route is registered on the
+		// SecurityHeaders.CSPReportPath
+		cspReport bool
+
+		// settings are the conventions owned by this server
+		settings Conventions
+		// renderer renders views using settings.Render
+		renderer *render.HTMLRenderer
+		// If we fail to find a configured onMissingHandler once we will stop looking
+		seekOnMissingHandler bool
+		// If we fail to find a configured onDirectoryListingForbiddenHandler once
+		// we will stop looking
+		seekOnDirectoryListingForbiddenHandler bool
+
+		// logger is named "webserver" when the logger passed to New supports
+		// named loggers, root is the logger passed to New
 		logger logger.Logger
+		root   logger.Logger
 	}
 
 	// Conventions defines our configuration.
@@ -113,6 +145,32 @@ type (
 		staticDir map[string]string
 		// Flag requests that take longer than N milliseconds. Default is 250ms (1/4th a second)
 		RequestDurationWarning time.Duration
+		// CSRF configures the tokens issued and verified by the CSRF PreHandler.
+		CSRF CSRFConventions
+		// SecurityHeaders configures the headers applied by the SecurityHeaders
+		// PreHandler.
+		SecurityHeaders SecurityHeadersConventions
+		// TrustedProxies lists the CIDR ranges, or single addresses, of proxies
+		// and load balancers whose forwarding headers, chosen by
+		// ForwardedHeader, are used to resolve the client IP, scheme, host
+		// and port.
+		TrustedProxies []string
+		// ForwardedHeader is the header family the trusted proxies append,
+		// context.HeaderXForwardedFor (the default) or context.HeaderForwarded.
+		// Headers of the other family are ignored.
+		ForwardedHeader string
+		// Health configures the opt-in health, readiness and liveness endpoints.
+		Health HealthConventions
+		// Metrics configures the opt-in request metrics.
+		Metrics MetricsConventions
+		// Cookies configures how cookies are written, signed and encrypted
+		// for every request the server handles. The Keys are empty by default;
+		// set them here or with WithCookieKeys.
+		Cookies context.CookieConventions
+		// LogLevels configures the opt-in endpoint for changing log levels.
+		LogLevels LogLevelConventions
+		// AccessLog configures the entry logged once a request is served.
+		AccessLog AccessLogConventions
 	}
 
 	// HandlerFunc is a request event handler and accepts a RequestContext
@@ -121,21 +179,60 @@ type (
 
 var (
 	// Settings allows a developer to override the conventional settings of the
-	// webserver.
+	// webserver. Each Server copies Settings when it is created by New, so
+	// changes made afterwards only apply to servers created later.
 	Settings = Conventions{
 		Render:                 &render.Settings,
 		EnableStaticFileServer: false,
 		SystemTemplates: map[string]string{
 			"onMissingHandler": "errors/onMissingHandler",
+			"onCSRFFailure":    "errors/onCSRFFailure",
 		},
 		staticDir:              make(map[string]string),
 		RequestDurationWarning: time.Second / 4,
+		CSRF: CSRFConventions{
+			CookieName: "_csrf",
+			FieldName:  "_csrf",
+			HeaderName: "X-CSRF-Token",
+		},
+		SecurityHeaders: SecurityHeadersConventions{
+			HSTSMaxAge:            365 * 24 * time.Hour,
+			HSTSIncludeSubdomains: true,
+			ContentTypeNosniff:    true,
+			FrameOptions:          "DENY",
+			ReferrerPolicy:        "strict-origin-when-cross-origin",
+			PermissionsPolicy:     "camera=(), microphone=(), geolocation=()",
+			ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'nonce-" + CSPNoncePlaceholder + "'; style-src 'self' 'nonce-" + CSPNoncePlaceholder + "'; object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+			CSPReportPath:         "/csp-report",
+		},
+		Health: HealthConventions{
+			HealthPath:    "/healthz",
+			ReadinessPath: "/readyz",
+			LivenessPath:  "/livez",
+			CheckTimeout:  time.Second * 2,
+			ShutdownDelay: time.Second * 5,
+		},
+		Metrics: MetricsConventions{
+			Path:            "/metrics",
+			Namespace:       "gia",
+			DurationBuckets: metrics.DefaultDurationBuckets,
+			SizeBuckets:     metrics.DefaultSizeBuckets,
+		},
+		Cookies: context.CookieConventions{
+			Path:     "/",
+			Secure:   true,
+			HTTPOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		LogLevels: LogLevelConventions{
+			Path: "/admin/log-levels",
+		},
+		AccessLog: AccessLogConventions{
+			Headers:           true,
+			RedactHeaders:     []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-CSRF-Token"},
+			RedactQueryParams: []string{"token", "access_token", "refresh_token", "api_key", "password", "secret"},
+		},
 	}
-	// If we fail to find a configured onMissingHandler once we will stop looking
-	seekOnMissingHandler = true
-	// If we fail to find a configured onDirectoryListingForbiddenHandler once we
-	// will stop looking
-	seekOnDirectoryListingForbiddenHandler = true
 
 	// ErrWebserverDuplicateMethod is thrown when there's a route that has duplicate methods (read: Two PUT requests on the same route)
 	ErrWebserverDuplicateMethod = errors.New("Duplicate Method on a route.")
@@ -153,14 +250,36 @@ var (
 	}
 )
 
-// New returns a new WebServer.
+// New returns a new WebServer. The server is configured with a copy of
+// Settings which the provided options may then adjust.
 func New(
-	logger logger.Logger) *Server {
+	log logger.Logger, options ...Option) *Server {
 
 	s := &Server{
-		logger:        logger,
+		logger:        log,
+		root:          log,
 		HandlerDef:    make(map[string]HandlerDef),
 		methodRouters: make(map[string]*mux.Router),
+		health: healthRegistry{
+			checks:     make(map[string]HealthCheck),
+			lastStatus: make(map[string]string),
+		},
+		settings:                               Settings.clone(),
+		seekOnMissingHandler:                   true,
+		seekOnDirectoryListingForbiddenHandler: true,
+	}
+
+	for _, option := range options {
+		option(s)
+	}
+	s.settings = s.settings.clone()
+	s.renderer = render.New(*s.settings.Render)
+	if named, ok := log.(*logger.Log); ok {
+		// Named loggers let the server and renderer be given their own level.
+		s.logger = named.Named("webserver")
+		s.renderer.SetLogger(named.Named("webserver.render"))
+	} else {
+		s.renderer.SetLogger(log)
 	}
 
 	// Be sure to setup at least one router. Additional method routers
@@ -170,33 +289,96 @@ func New(
 	// TODO We need to reset a default missing handler
 	// s.router.NotFound = s.onMissingHandler
 
+	if err := s.SetTrustedProxies(s.settings.TrustedProxies); err != nil {
+		s.logger.Context(logger.Fields{"error": err, "trustedProxies": s.settings.TrustedProxies}).Error("Invalid trusted proxy--forwarding headers will not be trusted")
+	}
+
 	return s
 }
 
+// Settings returns a copy of the conventions used by the server.
+func (s *Server) Settings() Conventions {
+	return s.settings.clone()
+}
+
+// SetTemplateCaching enables or disables the template cache of the server's
+// renderer without restarting it.
+func (s *Server) SetTemplateCaching(enabled bool) {
+	s.renderer.SetCacheTemplates(enabled)
+}
+
+// SetTrustedProxies replaces the CIDR ranges, or single addresses, of proxies
+// whose forwarding headers are trusted. If any entry is invalid an error is
+// returned and the current configuration is kept.
+func (s *Server) SetTrustedProxies(cidrs []string) error {
+	proxies, err := context.ParseTrustedProxies(cidrs)
+	if err != nil {
+		return err
+	}
+	proxies.Header = s.settings.ForwardedHeader
+	s.trustedProxies = proxies
+	return nil
+}
+
 // Start launches the webserver so that it begins listening and serving requests
-// on the desired address.
+// on the desired address. Start returns once Shutdown completes. Loggers
+// implementing logger.Shutdowner shut the server down before a Fatal message
+// exits the process.
 func (s *Server) Start(address string) {
-	if err := http.ListenAndServe(address, s); err != nil {
+	s.httpServer = &http.Server{Addr: address, Handler: s}
+	if shutdowner, ok := s.logger.(logger.Shutdowner); ok {
+		shutdowner.OnShutdown(s.Shutdown)
+	}
+	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		panic(err)
 	}
 }
 
+// Shutdown gracefully stops the webserver. The readiness endpoint fails
+// immediately and, after the configured Health.ShutdownDelay, the server stops
+// accepting connections and waits for active requests until ctx is done.
+// Only the first call has any effect.
+func (s *Server) Shutdown(ctx gocontext.Context) error {
+	if !atomic.CompareAndSwapInt32(&s.health.shutdown, 0, 1) {
+		return nil
+	}
+	s.logger.Context(logger.Fields{"delay": s.settings.Health.ShutdownDelay.String()}).Info("Webserver is shutting down")
+
+	select {
+	case <-time.After(s.settings.Health.ShutdownDelay):
+	case <-ctx.Done():
+	}
+
+	if s.httpServer == nil {
+		return nil
+	}
+	return s.httpServer.Shutdown(ctx)
+}
+
 // ServeHTTP handles all requests of our web server
 func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	starttick := time.Now() // TODO Look at ticker? Inside time package.
+	start := time.Now()
+
+	w, recordMetrics := s.instrument(w, req)
+	defer recordMetrics()
+
+	req, span := s.startRequestSpan(req)
+	defer s.endRequestSpan(span, w)
+	defer s.logRequest(w, req, span, start)
 
 	requestPath := req.URL.Path
 
-	s.logger.Context(logger.Fields{
+	s.logger.Context(spanFields(span, logger.Fields{
 		"requestPath": requestPath,
 		"method":      req.Method,
-	}).Debug("GO-GIA Webserver is receiving a request")
+	})).Debug("GO-GIA Webserver is receiving a request")
 
-	if Settings.EnableStaticFileServer {
-		for prefix, staticDir := range Settings.staticDir {
+	if s.settings.EnableStaticFileServer {
+		for prefix, staticDir := range s.settings.staticDir {
 			s.logger.Context(logger.Fields{"method": req.Method, "requestPath": requestPath}).Debug("Evaluating static route")
 
 			if strings.HasPrefix(requestPath, prefix) {
+				setRoute(w, prefix)
 				filePath := staticDir + requestPath[len(prefix):]
 				fileInfo, err := os.Stat(filePath)
 				if err != nil {
@@ -243,13 +425,6 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	router.ServeHTTP(w, req)
-
-	duration := time.Since(starttick)
-	if duration >= Settings.RequestDurationWarning {
-		//s.WarningLogger.Printf(logprefix+"Request complete; Path: %s; Duration: %fs", requestPath, duration.Seconds())
-	} else {
-		//s.DebugLogger.Printf(logprefix+"Request complete; Path: %s; Duration: %fs", requestPath, duration.Seconds())
-	}
 }
 
 // captureRequest builds a new Event to model a request/response handled
@@ -260,10 +435,35 @@ func (s *Server) captureRequest(
 	handlers []HandlerFunc) *context.Context {
 
 	event := context.New(w, req)
+	event.Input.Proxies = s.trustedProxies
+	event.Input.Cookies = &s.settings.Cookies
+	event.Output.Cookies = &s.settings.Cookies
+	event.SetRenderer(s.renderer)
 
 	return event
 }
 
+// attachRequestLogger stores a logger carrying the route and request metadata
+// in the request context, where handlers reach it through event.Logger() or
+// logger.FromContext.
+func (s *Server) attachRequestLogger(event *context.Context, route string) {
+	req := event.Request
+
+	fields := logger.Fields{
+		"method":      req.Method,
+		"route":       route,
+		"requestPath": req.URL.Path,
+		"clientIP":    event.Input.IP(),
+	}
+	if id := req.Header.Get("X-Request-Id"); id != "" {
+		fields["requestId"] = id
+	}
+	log := s.logger.Context(spanFields(tracing.FromContext(req.Context()), fields))
+
+	event.Request = req.WithContext(logger.NewContext(req.Context(), log))
+	event.Input.Request = event.Request
+}
+
 // onMissingHandler replies to the request with an HTTP 404 not found error.
 // This function is triggered when we are unable to match a route.
 func (s *Server) onMissingHandler(w http.ResponseWriter, req *http.Request) {
@@ -273,17 +473,17 @@ func (s *Server) onMissingHandler(w http.ResponseWriter, req *http.Request) {
 
 	s.logger.Context(logger.Fields{"method": req.Method, "requestPath": req.URL.Path, "statusCode": 404}).Debug("Handler not found")
 
-	if seekOnMissingHandler {
-		template := Settings.SystemTemplates["onMissingHandler"]
+	if s.seekOnMissingHandler {
+		template := s.settings.SystemTemplates["onMissingHandler"]
 		err := context.HTMLTemplate(template, nil)
 		if err != nil {
 			s.logger.Context(logger.Fields{"template": template}).Warn("Failed single attempt to load configured onMissingHandler template--serving default response")
-			seekOnMissingHandler = false
+			s.seekOnMissingHandler = false
 		}
 	}
 
-	if !seekOnMissingHandler {
-		context.Output.Body([]byte(defaultResponse404))
+	if !s.seekOnMissingHandler {
+		context.Output.Body(withCSPNonce(context, defaultResponse404))
 	}
 }
 
@@ -302,24 +502,39 @@ func (s *Server) onDirectoryListingForbiddenHandler(w http.ResponseWriter,
 		"statusCode":  403,
 	}).Debug("Directory listing forbidden")
 
-	if seekOnDirectoryListingForbiddenHandler {
-		template := Settings.SystemTemplates["onDirectoryListingForbiddenHandler"]
+	if s.seekOnDirectoryListingForbiddenHandler {
+		template := s.settings.SystemTemplates["onDirectoryListingForbiddenHandler"]
 		err := context.HTMLTemplate(template, nil)
 		if err != nil {
 			s.logger.Context(logger.Fields{
 				"template": template,
 			}).Warn("Failed single attempt to load configured onDirectoryListingForbiddenHandler template--serving default response")
-			seekOnDirectoryListingForbiddenHandler = false
+			s.seekOnDirectoryListingForbiddenHandler = false
 		}
 	}
 
-	if !seekOnDirectoryListingForbiddenHandler {
-		context.Output.Body([]byte(defaultResponseDirectoryListingForbidden))
+	if !s.seekOnDirectoryListingForbiddenHandler {
+		context.Output.Body(withCSPNonce(context, defaultResponseDirectoryListingForbidden))
 	}
 }
 
 // Handle registers HandlerFuncs with the webserver.
 func (s *Server) Handle(method string, path string, handlers []HandlerFunc, postHandlers []HandlerFunc) {
+	chain := make([]namedHandler, len(handlers))
+	for i, h := range handlers {
+		chain[i] = namedHandler{name: method + " " + path, handler: h}
+	}
+	postChain := make([]namedHandler, len(postHandlers))
+	for i, h := range postHandlers {
+		postChain[i] = namedHandler{name: "posthandler", handler: h}
+	}
+
+	s.handle(method, path, chain, postChain)
+}
+
+// handle registers named HandlerFuncs with the webserver. The names label the
+// span of each handler when tracing is enabled.
+func (s *Server) handle(method string, path string, handlers []namedHandler, postHandlers []namedHandler) {
 	router, ok := s.methodRouters[method]
 	if !ok {
 		router = mux.NewRouter()
@@ -327,21 +542,38 @@ func (s *Server) Handle(method string, path string, handlers []HandlerFunc, post
 	}
 	s.logger.Context(logger.Fields{"method": method, "path": path}).Debug("Registering Route")
 
+	// Violation reports are unauthenticated so their size is limited before
+	// the body is read.
+	var maxBodyBytes int64
+	if method == POST && path == s.settings.SecurityHeaders.CSPReportPath {
+		maxBodyBytes = cspReportMaxBytes + 1
+		s.cspReport = true
+	}
+
 	router.HandleFunc(path, func(w http.ResponseWriter, req *http.Request) {
-		event := s.captureRequest(w, req, handlers)
+		setRoute(w, path)
+		if maxBodyBytes > 0 && req.Body != nil {
+			req.Body = http.MaxBytesReader(w, req.Body, maxBodyBytes)
+		}
+		event := s.captureRequest(w, req, nil)
+		s.attachRequestLogger(event, path)
 		// Run through our handler chain
-		for _, h := range handlers {
+		for i, h := range handlers {
 			if event.BreakHandlerChain {
 				break
 			}
-			h(event)
+			stage := stagePre
+			if i == len(handlers)-1 {
+				stage = stageTarget
+			}
+			runHandler(event, h, stage)
 		}
 
 		// Run through any post handlers. These are not allowed to write
 		// to the client.
 		if postHandlers != nil {
 			for _, h := range postHandlers {
-				h(event)
+				runHandler(event, h, stagePost)
 			}
 		}
 	}).Methods(method)
@@ -349,17 +581,17 @@ func (s *Server) Handle(method string, path string, handlers []HandlerFunc, post
 
 // FILES registers a url and directory path to serve static files. The webserver
 // will serve all static files in any directories under these paths. Executing
-// this method enables the static file server flag.
+// this method enables the static file server flag of this server.
 func (s *Server) FILES(url string, path string) {
-	if !Settings.EnableStaticFileServer {
-		Settings.EnableStaticFileServer = true
+	if !s.settings.EnableStaticFileServer {
+		s.settings.EnableStaticFileServer = true
 	}
 
 	if !strings.HasPrefix(url, "/") {
 		url = "/" + url
 	}
 
-	Settings.staticDir[url] = path
+	s.settings.staticDir[url] = path
 }
 
 // GET is a convenience method for registering handlers